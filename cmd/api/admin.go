@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/storage"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+// adminBatchSize is how many rows the admin commands read at a time when they
+// step through a whole table.
+const adminBatchSize = 500
+
+// adminOptions holds the flags of the admin commands.
+type adminOptions struct {
+	dryRun bool
+	blobs  bool
+}
+
+// adminCommand is a maintenance task run with "api admin NAME". Along with its
+// own flags, each command takes the same flags and config as the server.
+type adminCommand struct {
+	name    string
+	summary string
+	flags   func(fs *flag.FlagSet, opts *adminOptions)
+	run     func(ctx context.Context, app *application, opts adminOptions) error
+}
+
+var adminCommands = []adminCommand{
+	{
+		name:    "reindex-search",
+		summary: "Rebuild the full text search and tag indexes",
+		run:     adminReindexSearch,
+	},
+	{
+		name:    "count-tags",
+		summary: "Count the notes using each tag in each workspace",
+		run:     adminCountTags,
+	},
+	{
+		name:    "verify",
+		summary: "Check every note in every workspace passes validation, and optionally that attachment blobs exist",
+		flags: func(fs *flag.FlagSet, opts *adminOptions) {
+			fs.BoolVar(&opts.blobs, "blobs", false, "Check the blob of every attachment is in storage")
+		},
+		run: adminVerify,
+	},
+}
+
+// runAdmin runs the admin command named by args[0] and returns the exit code.
+func runAdmin(args []string) int {
+	if len(args) == 0 {
+		adminUsage(os.Stderr)
+		return 2
+	}
+
+	var cmd *adminCommand
+	for i := range adminCommands {
+		if adminCommands[i].name == args[0] {
+			cmd = &adminCommands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown admin command %q\n\n", args[0])
+		adminUsage(os.Stderr)
+		return 2
+	}
+
+	var opts adminOptions
+	cfg, _, err := loadConfig(args[1:], func(fs *flag.FlagSet) {
+		fs.BoolVar(&opts.dryRun, "dry-run", false, "Report what would be done without changing anything")
+		if cmd.flags != nil {
+			cmd.flags(fs, &opts)
+		}
+	})
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	app := &application{
+		config: cfg,
+		db:     db,
+		models: data.NewModels(db),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, app, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+		return 1
+	}
+
+	return 0
+}
+
+func adminUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: api admin COMMAND [-dry-run] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range adminCommands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands read the same config as the server, so -db-dsn, -config and the")
+	fmt.Fprintln(w, "NOTEBOOK_* variables all apply.")
+}
+
+// adminReindexSearch rebuilds the search indexes one at a time. Each is rebuilt
+// concurrently, so the API can carry on writing notes meanwhile.
+func adminReindexSearch(ctx context.Context, app *application, opts adminOptions) error {
+	for _, index := range data.SearchIndexes {
+		if opts.dryRun {
+			fmt.Printf("would reindex %s\n", index)
+			continue
+		}
+
+		start := time.Now()
+
+		err := app.models.Schema.Reindex(ctx, index)
+		if err != nil {
+			return fmt.Errorf("reindexing %s: %w", index, err)
+		}
+
+		fmt.Printf("reindexed %s in %s\n", index, time.Since(start).Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// adminCountTags prints how many notes use each tag in each workspace. Tag
+// counts are worked out from the notes whenever they're asked for, so there is
+// nothing stored to go stale, and this only reads.
+func adminCountTags(ctx context.Context, app *application, opts adminOptions) error {
+	workspaces, err := app.models.Workspaces.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKSPACE\tTAG\tNOTES")
+
+	for _, ws := range workspaces {
+		tags, err := app.models.Notes.GetTags(data.WithWorkspace(ctx, ws.ID))
+		if err != nil {
+			return err
+		}
+
+		for _, tag := range tags {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", ws.Slug, tag.Tag, tag.Notes)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// adminVerify checks the notes in every workspace against ValidateNote, which finds notes
+// written before a rule was added or tightened, and with -blobs checks that the
+// blob of every attachment is still in storage. It only reads, and fails if any
+// problems were found.
+func adminVerify(ctx context.Context, app *application, opts adminOptions) error {
+	problems := 0
+
+	workspaces, err := app.models.Workspaces.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	notes := 0
+	for _, ws := range workspaces {
+		wsCtx := data.WithWorkspace(ctx, ws.ID)
+
+		var afterID int64
+		for {
+			batch, err := app.models.Notes.GetBatch(wsCtx, afterID, adminBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			for _, note := range batch {
+				v := validator.New()
+				if data.ValidateNote(v, note); !v.Valid() {
+					for _, e := range v.FieldErrors() {
+						fmt.Printf("note %d in %s: %s %s\n", note.ID, ws.Slug, e.Field, e.Message)
+						problems++
+					}
+				}
+			}
+
+			notes += len(batch)
+			afterID = batch[len(batch)-1].ID
+		}
+	}
+
+	fmt.Printf("checked %d notes in %d workspaces\n", notes, len(workspaces))
+
+	if opts.blobs {
+		blobs, err := openBlobStore(app.config)
+		if err != nil {
+			return err
+		}
+
+		attachments := 0
+		var afterID int64
+		for {
+			batch, err := app.models.Attachments.GetBatch(ctx, afterID, adminBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			for _, attachment := range batch {
+				r, err := blobs.Get(ctx, attachment.StorageKey)
+				switch {
+				case errors.Is(err, storage.ErrBlobNotFound):
+					fmt.Printf("attachment %d of note %d: blob %s is missing\n", attachment.ID, attachment.NoteID, attachment.StorageKey)
+					problems++
+				case err != nil:
+					return fmt.Errorf("checking attachment %d: %w", attachment.ID, err)
+				default:
+					r.Close()
+				}
+			}
+
+			attachments += len(batch)
+			afterID = batch[len(batch)-1].ID
+		}
+
+		fmt.Printf("checked %d attachments\n", attachments)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problems", problems)
+	}
+
+	return nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/storage"
+)
+
+// Media types that may be uploaded as attachments, matched against the sniffed
+// content of the file rather than whatever the client claims it is.
+var permittedAttachmentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/bmp",
+	"application/pdf",
+	"text/plain",
+}
+
+func (app *application) createAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Notes.Get(r.Context(), noteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	maxBytes := app.config.storage.maxAttachmentBytes
+
+	// allow a little room on top of the file itself for the multipart framing
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// skip ahead to the part named "file", ignoring any other form fields
+	var part *multipart.Part
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.Is(err, io.EOF):
+				app.badRequestResponse(w, r, errors.New(`body must contain a "file" part`))
+			case errors.As(err, &maxBytesError):
+				app.fileTooLargeResponse(w, r, maxBytes)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+		defer p.Close()
+
+		if p.FormName() == "file" {
+			part = p
+			break
+		}
+	}
+
+	// spool the upload to a temporary file while hashing it, stopping as soon as it
+	// goes over the limit instead of reading the whole thing
+	tmp, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(part, maxBytes+1))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.fileTooLargeResponse(w, r, maxBytes)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	if size > maxBytes {
+		app.fileTooLargeResponse(w, r, maxBytes)
+		return
+	}
+
+	if size == 0 {
+		app.badRequestResponse(w, r, errors.New("file must not be empty"))
+		return
+	}
+
+	// sniff the content type from the first 512 bytes of the file
+	sniff := make([]byte, 512)
+	n, err := tmp.ReadAt(sniff, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	contentType := http.DetectContentType(sniff[:n])
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !permittedAttachmentType(mediaType) {
+		app.unsupportedMediaTypeResponse(w, r, mediaType)
+		return
+	}
+
+	key, err := newStorageKey(noteID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.blobs.Put(r.Context(), key, tmp, size, contentType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	attachment := &data.Attachment{
+		NoteID:      noteID,
+		Filename:    cleanFilename(part.FileName()),
+		ContentType: contentType,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		StorageKey:  key,
+	}
+
+	err = app.models.Attachments.Insert(r.Context(), attachment)
+	if err != nil {
+		// don't leave an orphaned blob behind if the metadata could not be saved
+		app.deleteBlobs(key)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", workspacePath(r, fmt.Sprintf("/v1/notes/%d/attachments/%d", noteID, attachment.ID)))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": attachment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Notes.Get(r.Context(), noteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	attachments, err := app.models.Attachments.GetAllForNote(r.Context(), noteID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeList(w, r, "attachments", attachments, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	attachment, err := app.models.Attachments.Get(r.Context(), noteID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	blob, err := app.blobs.Get(r.Context(), attachment.StorageKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrBlobNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	// the headers are already gone at this point, so all we can do is log
+	if _, err := io.Copy(w, blob); err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	attachment, err := app.models.Attachments.Get(r.Context(), noteID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Attachments.Delete(r.Context(), noteID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.deleteBlobs(attachment.StorageKey)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "attachment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteBlobs removes blobs from the store in the background. The metadata is
+// already gone by the time this is called, so a failure only leaves an orphaned
+// blob behind and is logged rather than reported to the client.
+func (app *application) deleteBlobs(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		for _, key := range keys {
+			if err := app.blobs.Delete(ctx, key); err != nil {
+				app.logError(nil, err)
+			}
+		}
+	})
+}
+
+func permittedAttachmentType(mediaType string) bool {
+	for _, t := range permittedAttachmentTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// newStorageKey returns a random, unguessable key for a blob belonging to a note.
+func newStorageKey(noteID int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("notes/%d/%s", noteID, hex.EncodeToString(b)), nil
+}
+
+// cleanFilename strips any directories a client sent along with the file name.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	return name
+}
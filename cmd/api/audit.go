@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+// auditSource records where a request came from in its context, so that any
+// changes it makes are logged with its address and request id. There are no
+// accounts yet, so the actor is left empty.
+func (app *application) auditSource(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := data.WithAuditSource(r.Context(), data.AuditSource{
+			IP:        remoteIP(r.RemoteAddr),
+			RequestID: requestIDFromContext(r.Context()),
+		})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// remoteIP takes the port off a host:port address. X-Forwarded-For is not
+// trusted, since anyone can send it.
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// requireAuditAuth protects the audit log with basic auth. The route is only
+// registered when a password has been set.
+func (app *application) requireAuditAuth(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || !secureCompare(username, app.config.audit.username) || !secureCompare(password, app.config.audit.password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="audit", charset="UTF-8"`)
+			app.errorResponse(w, r, http.StatusUnauthorized, codeUnauthorized, "invalid or missing credentials for the audit log")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (app *application) listAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.AuditQuery
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Action = app.readString(qs, "action", "")
+	input.Actor = app.readString(qs, "actor", "")
+	input.RequestID = app.readString(qs, "request_id", "")
+	input.NoteID = int64(app.readInt(qs, "note_id", 0, v))
+	input.Since = app.readTime(qs, "since", v)
+	input.Until = app.readTime(qs, "until", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "-created_at"}
+
+	data.ValidateAuditQuery(v, input.AuditQuery)
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	events, metadata, err := app.models.Audit.GetAll(r.Context(), input.AuditQuery, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeList(w, r, "events", events, &metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listNoteActivityHandler lists the changes made to a note and everything on
+// it, newest first. The history of deleted notes is only in the audit log.
+func (app *application) listNoteActivityHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Notes.Get(r.Context(), noteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.Sort = app.readString(qs, "sort", "-created_at")
+	filters.SortSafelist = []string{"created_at", "-created_at"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	events, metadata, err := app.models.Audit.GetAll(r.Context(), data.AuditQuery{NoteID: noteID}, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeList(w, r, "events", events, &metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
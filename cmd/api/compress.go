@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// responses smaller than this aren't worth compressing, since the gzip header and
+// the CPU time cost more than they save
+const compressMinBytes = 1024
+
+// compressibleTypes are the content types worth compressing. Anything else, such
+// as images in attachments, is usually compressed already.
+var compressibleTypes = map[string]bool{
+	"application/json":         true,
+	"application/problem+json": true,
+	"application/x-ndjson":     true,
+	"application/xml":          true,
+	"application/javascript":   true,
+	"image/svg+xml":            true,
+}
+
+var gzipWriters = sync.Pool{
+	New: func() any {
+		gz, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return gz
+	},
+}
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		fw, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return fw
+	},
+}
+
+// compress compresses responses with gzip or deflate, whichever the client prefers
+// in its Accept-Encoding header. The body is held back until compressMinBytes have
+// been written, so small responses are sent as they are.
+func (app *application) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+
+		// ranges are of the uncompressed body, so those responses are left alone
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding, statusCode: http.StatusOK}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header, going by
+// the q-values given for each. It returns "" if the client accepts neither.
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if coding == "*" {
+			coding = "gzip"
+		}
+
+		// gzip wins a tie, since it's what everyone supports
+		if (coding == "gzip" || coding == "deflate") && (q > bestQ || q == bestQ && coding == "gzip") {
+			best, bestQ = coding, q
+		}
+	}
+
+	if bestQ == 0 {
+		return ""
+	}
+
+	return best
+}
+
+// compressResponseWriter buffers the start of a response until it knows whether
+// to compress it, then either compresses everything after that or passes it
+// straight through.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	statusCode    int
+	headerWritten bool // WriteHeader has been called by the handler
+	decided       bool // the header has gone out, compressed or not
+	buf           bytes.Buffer
+	cw            io.WriteCloser
+}
+
+func (cw *compressResponseWriter) WriteHeader(statusCode int) {
+	if cw.headerWritten {
+		return
+	}
+
+	// informational responses go straight out, and aren't the real status
+	if statusCode >= 100 && statusCode < 200 {
+		cw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	cw.statusCode = statusCode
+	cw.headerWritten = true
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	cw.headerWritten = true
+
+	if !cw.decided {
+		if !cw.compressible() {
+			cw.start(false)
+		} else {
+			cw.buf.Write(b)
+			if cw.buf.Len() >= compressMinBytes {
+				if err := cw.start(true); err != nil {
+					return 0, err
+				}
+			}
+			return len(b), nil
+		}
+	}
+
+	if cw.cw != nil {
+		return cw.cw.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// compressible reports whether the response can be compressed, going by the
+// headers the handler has set.
+func (cw *compressResponseWriter) compressible() bool {
+	h := cw.Header()
+
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	switch cw.statusCode {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || compressibleTypes[mediaType]
+}
+
+// start sends the header, then whatever has been buffered, compressing from here
+// on if asked to.
+func (cw *compressResponseWriter) start(compress bool) error {
+	cw.decided = true
+
+	if compress {
+		h := cw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+
+		switch cw.encoding {
+		case "gzip":
+			gz := gzipWriters.Get().(*gzip.Writer)
+			gz.Reset(cw.ResponseWriter)
+			cw.cw = gz
+		case "deflate":
+			fw := flateWriters.Get().(*flate.Writer)
+			fw.Reset(cw.ResponseWriter)
+			cw.cw = fw
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.cw != nil {
+		_, err = cw.cw.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+
+	return err
+}
+
+// Flush sends what has been written so far. A flush means the handler is
+// streaming, so a compressible response is compressed from here on whatever its
+// size so far.
+func (cw *compressResponseWriter) Flush() {
+	if !cw.decided {
+		cw.start(cw.headerWritten && cw.compressible())
+	}
+
+	if f, ok := cw.cw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// close finishes off the response once the handler has returned.
+func (cw *compressResponseWriter) close() {
+	if !cw.decided {
+		// the handler never wrote a body, or it was too small to compress
+		if !cw.headerWritten {
+			return
+		}
+		cw.start(false)
+	}
+
+	if cw.cw == nil {
+		return
+	}
+
+	cw.cw.Close()
+
+	switch w := cw.cw.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(w)
+	case *flate.Writer:
+		flateWriters.Put(w)
+	}
+	cw.cw = nil
+}
+
+// Unwrap lets http.ResponseController get at the underlying writer.
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
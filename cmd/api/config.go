@@ -0,0 +1,487 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is put in front of a setting's name to get its environment variable,
+// so db-max-open-conns is read from NOTEBOOK_DB_MAX_OPEN_CONNS.
+const envPrefix = "NOTEBOOK_"
+
+// envAliases are extra environment variables read for some settings, kept so
+// existing deployments carry on working.
+var envAliases = map[string][]string{
+	"addr":                  {"NOTEBOOK_PORT"},
+	"notify-webhook-secret": {"NOTEBOOK_WEBHOOK_SECRET"},
+}
+
+// secretSettings are redacted when the config is printed.
+var secretSettings = map[string]bool{
+	"db-dsn":                true,
+	"s3-access-key":         true,
+	"s3-secret-key":         true,
+	"notify-webhook-secret": true,
+	"smtp-password":         true,
+	"metrics-password":      true,
+	"audit-password":        true,
+	"cursor-secret":         true,
+}
+
+// Where the value of a setting came from, from lowest to highest precedence.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// configSetting is the effective value of one setting, as shown by config print.
+type configSetting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// newFlagSet defines every setting as a flag bound to a field of cfg. The flag
+// names double as the keys of the config file and, with envPrefix, the names of
+// the environment variables.
+func newFlagSet(cfg *config) *flag.FlagSet {
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+
+	fs.IntVar(&cfg.port, "addr", 4000, "Server port")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+
+	// Read the connection pool settings from command-line flags into the config struct.
+	// Notice the default values that we're using?
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	fs.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+
+	// Serve HTTPS directly when given a certificate, for running without a reverse
+	// proxy. The files are checked for changes so renewed certificates are used
+	// without a restart.
+	fs.StringVar(&cfg.tls.certFile, "tls-cert", "", "TLS certificate file, turns on HTTPS and HTTP/2")
+	fs.StringVar(&cfg.tls.keyFile, "tls-key", "", "TLS private key file")
+	fs.DurationVar(&cfg.tls.reloadInterval, "tls-reload-interval", time.Minute, "How often to check the certificate files for changes")
+	fs.IntVar(&cfg.tls.redirectPort, "tls-redirect-port", 0, "Port to redirect plain HTTP to HTTPS from (0 to turn off)")
+
+	// The gRPC API is served on its own port, with the same TLS settings as the
+	// JSON API.
+	fs.IntVar(&cfg.grpc.port, "grpc-port", 0, "Port to serve the gRPC API on (0 to turn off)")
+
+	// In development every request and response is checked against the OpenAPI
+	// document, and anything that doesn't match is logged.
+	fs.BoolVar(&cfg.openAPI.validate, "openapi-validate", true, "Check requests and responses against the OpenAPI document in development")
+
+	// Browsers are only allowed to call the API cross-origin from these origins, such
+	// as the frontend's.
+	fs.Var((*stringList)(&cfg.cors.trustedOrigins), "cors-trusted-origins", "Trusted CORS origins (space separated)")
+
+	// Pagination cursors are signed with this secret. Without one a random key is
+	// used, and cursors stop working when the server restarts.
+	fs.StringVar(&cfg.cursors.secret, "cursor-secret", "", "Secret used to sign pagination cursors")
+
+	// Where attachment blobs are kept, either a local directory or an S3 compatible
+	// bucket (such as MinIO for local development).
+	fs.StringVar(&cfg.storage.backend, "storage", "local", "Attachment storage backend (local|s3)")
+	fs.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory for attachments when using local storage")
+	fs.Int64Var(&cfg.storage.maxAttachmentBytes, "attachment-max-bytes", 25<<20, "Maximum size of a single attachment in bytes")
+	fs.StringVar(&cfg.storage.s3.Endpoint, "s3-endpoint", "", "S3 endpoint URL")
+	fs.StringVar(&cfg.storage.s3.Region, "s3-region", "us-east-1", "S3 region")
+	fs.StringVar(&cfg.storage.s3.Bucket, "s3-bucket", "", "S3 bucket for attachments")
+	fs.StringVar(&cfg.storage.s3.AccessKey, "s3-access-key", "", "S3 access key")
+	fs.StringVar(&cfg.storage.s3.SecretKey, "s3-secret-key", "", "S3 secret key")
+
+	// Reminders are polled for by a scheduler, and fired reminders are always sent to
+	// the in-process event bus. A webhook and email can be turned on as well.
+	fs.BoolVar(&cfg.reminders.enabled, "reminders", true, "Run the reminder scheduler")
+	fs.DurationVar(&cfg.reminders.interval, "reminders-interval", 30*time.Second, "How often to poll for due reminders")
+	fs.IntVar(&cfg.reminders.batchSize, "reminders-batch-size", 100, "Maximum number of reminders to fire per poll")
+	fs.StringVar(&cfg.webhook.url, "notify-webhook-url", "", "URL to POST fired reminders to")
+	fs.StringVar(&cfg.webhook.secret, "notify-webhook-secret", "", "Secret used to sign reminder webhooks")
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP host to email fired reminders and workspace invitations through")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 1025, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Notebook <no-reply@notebook.local>", "SMTP sender")
+	fs.StringVar(&cfg.smtp.recipient, "smtp-recipient", "", "Address to email fired reminders to")
+
+	fs.DurationVar(&cfg.invitations.ttl, "invitation-ttl", 7*24*time.Hour, "How long a workspace invitation can be accepted for")
+
+	// Metrics are served at /debug/metrics and /debug/vars when turned on, behind
+	// basic auth if a password is given.
+	fs.BoolVar(&cfg.metrics.enabled, "metrics", false, "Serve metrics at /debug/metrics and /debug/vars")
+	fs.StringVar(&cfg.metrics.username, "metrics-username", "metrics", "Basic auth username for the metrics endpoints")
+	fs.StringVar(&cfg.metrics.password, "metrics-password", "", "Basic auth password for the metrics endpoints")
+
+	// The audit log holds the contents of every change, so it is only served once a
+	// password has been set for it.
+	fs.StringVar(&cfg.audit.username, "audit-username", "admin", "Basic auth username for the audit log")
+	fs.StringVar(&cfg.audit.password, "audit-password", "", "Basic auth password for the audit log, which is not served without one")
+
+	// Traces can be printed, written to a file or sent to a collector over OTLP. The
+	// standard OTEL_EXPORTER_OTLP_* environment variables work as well.
+	fs.StringVar(&cfg.tracing.exporter, "trace-exporter", "none", "Where to send traces (none|stdout|file|otlp)")
+	fs.StringVar(&cfg.tracing.file, "trace-file", "traces.jsonl", "File to write traces to with the file exporter")
+	fs.StringVar(&cfg.tracing.otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP collector host and port, overriding OTEL_EXPORTER_OTLP_ENDPOINT (default localhost:4318)")
+	fs.BoolVar(&cfg.tracing.otlpInsecure, "otlp-insecure", false, "Send traces to the collector over plain HTTP")
+	fs.Float64Var(&cfg.tracing.sampleRatio, "trace-sample-ratio", 1, "Fraction of new traces to sample, from 0 to 1")
+
+	return fs
+}
+
+// loadConfig works out the configuration from, in increasing order of precedence,
+// the defaults, an optional YAML or TOML file given with -config (or
+// NOTEBOOK_CONFIG), NOTEBOOK_* environment variables and the command line flags
+// in args. Variables in a .env file are added to the environment first, without
+// replacing any that are already set. It returns the config along with where
+// each setting came from.
+//
+// commandFlags define extra flags for a subcommand, such as the admin commands.
+// They are only read from the command line, and aren't part of the config.
+func loadConfig(args []string, commandFlags ...func(*flag.FlagSet)) (config, []configSetting, error) {
+	var cfg config
+
+	err := loadDotEnvFile()
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	fs := newFlagSet(&cfg)
+
+	var configFile string
+	fs.StringVar(&configFile, "config", os.Getenv(envPrefix+"CONFIG"), "Path to a YAML or TOML config file")
+
+	// neither -config nor the command flags can be set from the file or environment
+	settingNames := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		settingNames[f.Name] = f.Name != "config"
+	})
+
+	for _, define := range commandFlags {
+		define(fs)
+	}
+
+	// flags are parsed first so that they can be left alone by the other layers
+	err = fs.Parse(args)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	sources := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = sourceFlag
+	})
+
+	var fileValues map[string]string
+	if configFile != "" {
+		fileValues, err = readConfigFile(configFile)
+		if err != nil {
+			return cfg, nil, err
+		}
+
+		for name := range fileValues {
+			if !settingNames[name] {
+				return cfg, nil, fmt.Errorf("%s: unknown setting %q", configFile, name)
+			}
+		}
+	}
+
+	var errs []error
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if !settingNames[f.Name] || sources[f.Name] == sourceFlag {
+			return
+		}
+
+		value, source := "", sourceDefault
+
+		if v, ok := fileValues[f.Name]; ok {
+			value, source = v, sourceFile
+		}
+
+		if v, ok := lookupEnv(f.Name); ok {
+			value, source = v, sourceEnv
+		}
+
+		sources[f.Name] = source
+		if source == sourceDefault {
+			return
+		}
+
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s from %s: %w", value, f.Name, source, err))
+		}
+	})
+
+	if err := errors.Join(errs...); err != nil {
+		return cfg, nil, err
+	}
+
+	v := validator.New()
+	if validateConfig(v, cfg); !v.Valid() {
+		return cfg, nil, configError(v)
+	}
+
+	var settings []configSetting
+	fs.VisitAll(func(f *flag.Flag) {
+		if !settingNames[f.Name] {
+			return
+		}
+
+		settings = append(settings, configSetting{
+			Name:   f.Name,
+			Value:  redactSetting(f.Name, f.Value.String()),
+			Source: sources[f.Name],
+		})
+	})
+
+	return cfg, settings, nil
+}
+
+// loadDotEnvFile adds the variables in .env to the environment. A missing file is
+// fine, since containers are normally given their environment directly.
+func loadDotEnvFile() error {
+	err := godotenv.Load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("loading .env file: %w", err)
+	}
+
+	return nil
+}
+
+// lookupEnv returns the environment variable for a setting, if set.
+func lookupEnv(name string) (string, bool) {
+	names := append([]string{envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))}, envAliases[name]...)
+
+	for _, key := range names {
+		if value, ok := os.LookupEnv(key); ok {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// readConfigFile reads a YAML or TOML file, chosen by its extension, into a map
+// of setting name to value. Sections are joined onto the names of the settings
+// in them, so db: {max-open-conns: 10} sets db-max-open-conns. Underscores can be
+// used in place of dashes.
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		return nil, fmt.Errorf("%s: config files must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flattenConfig(values, "", raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+func flattenConfig(values map[string]string, prefix string, raw map[string]any) error {
+	for key, value := range raw {
+		name := strings.ReplaceAll(strings.ToLower(key), "_", "-")
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			if err := flattenConfig(values, name, value); err != nil {
+				return err
+			}
+		case []any:
+			// lists are only used by stringList settings, which are space separated
+			items := make([]string, len(value))
+			for i, item := range value {
+				switch item.(type) {
+				case map[string]any, []any, nil:
+					return fmt.Errorf("setting %q must be a list of plain values", name)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, " ")
+		case nil:
+			return fmt.Errorf("setting %q must have a value", name)
+		case time.Duration:
+			values[name] = value.String()
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
+
+func validateConfig(v *validator.Validator, cfg config) {
+	v.Check(cfg.port >= 1 && cfg.port <= 65535, "addr", validator.CodeInvalid, "must be a port between 1 and 65535")
+	v.Check(validator.PermittedValue(cfg.env, "development", "staging", "production"), "env", validator.CodeNotPermitted, "must be development, staging or production")
+
+	v.Check((cfg.tls.certFile == "") == (cfg.tls.keyFile == ""), "tls-key", validator.CodeRequired, "must be provided along with tls-cert")
+	if cfg.tls.certFile != "" {
+		v.Check(cfg.tls.reloadInterval > 0, "tls-reload-interval", validator.CodeTooSmall, "must be greater than zero")
+		v.Check(cfg.tls.redirectPort >= 0 && cfg.tls.redirectPort <= 65535, "tls-redirect-port", validator.CodeInvalid, "must be a port between 1 and 65535, or 0")
+		v.Check(cfg.tls.redirectPort != cfg.port, "tls-redirect-port", validator.CodeInvalid, "must not be the same as addr")
+	}
+
+	v.Check(cfg.grpc.port >= 0 && cfg.grpc.port <= 65535, "grpc-port", validator.CodeInvalid, "must be a port between 1 and 65535, or 0")
+	if cfg.grpc.port != 0 {
+		v.Check(cfg.grpc.port != cfg.port, "grpc-port", validator.CodeInvalid, "must not be the same as addr")
+		v.Check(cfg.grpc.port != cfg.tls.redirectPort, "grpc-port", validator.CodeInvalid, "must not be the same as tls-redirect-port")
+	}
+
+	for _, origin := range cfg.cors.trustedOrigins {
+		u, err := url.Parse(origin)
+		ok := err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" && u.RawQuery == ""
+		v.Check(ok, "cors-trusted-origins", validator.CodeInvalidFormat, "must be origins such as https://notes.example.com, without a path")
+	}
+
+	v.Check(cfg.db.dsn != "", "db-dsn", validator.CodeRequired, "must be provided")
+	v.Check(cfg.db.maxOpenConns > 0, "db-max-open-conns", validator.CodeTooSmall, "must be greater than zero")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", validator.CodeTooSmall, "must not be negative")
+	d, err := time.ParseDuration(cfg.db.maxIdleTime)
+	v.Check(err == nil, "db-max-idle-time", validator.CodeInvalidFormat, "must be a duration such as 15m")
+	v.Check(err != nil || d >= 0, "db-max-idle-time", validator.CodeTooSmall, "must not be negative")
+
+	v.Check(validator.PermittedValue(cfg.storage.backend, "local", "s3"), "storage", validator.CodeNotPermitted, "must be local or s3")
+	v.Check(cfg.storage.maxAttachmentBytes > 0, "attachment-max-bytes", validator.CodeTooSmall, "must be greater than zero")
+	if cfg.storage.backend == "local" {
+		v.Check(cfg.storage.dir != "", "storage-dir", validator.CodeRequired, "must be provided")
+	}
+	if cfg.storage.backend == "s3" {
+		v.Check(cfg.storage.s3.Endpoint != "", "s3-endpoint", validator.CodeRequired, "must be provided")
+		v.Check(cfg.storage.s3.Bucket != "", "s3-bucket", validator.CodeRequired, "must be provided")
+	}
+
+	v.Check(cfg.reminders.interval > 0, "reminders-interval", validator.CodeTooSmall, "must be greater than zero")
+	v.Check(cfg.reminders.batchSize > 0, "reminders-batch-size", validator.CodeTooSmall, "must be greater than zero")
+	if cfg.webhook.url != "" {
+		u, err := url.Parse(cfg.webhook.url)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "notify-webhook-url", validator.CodeInvalidFormat, "must be an http or https URL")
+	}
+	v.Check(cfg.smtp.port >= 1 && cfg.smtp.port <= 65535, "smtp-port", validator.CodeInvalid, "must be a port between 1 and 65535")
+	if cfg.smtp.host != "" {
+		_, err := mail.ParseAddress(cfg.smtp.sender)
+		v.Check(err == nil, "smtp-sender", validator.CodeInvalidFormat, "must be an email address, optionally with a name as in Notebook <no-reply@example.com>")
+	}
+	v.Check(cfg.invitations.ttl > 0, "invitation-ttl", validator.CodeTooSmall, "must be greater than zero")
+
+	if cfg.metrics.password != "" {
+		v.Check(cfg.metrics.username != "", "metrics-username", validator.CodeRequired, "must be provided when a metrics password is set")
+	}
+	if cfg.audit.password != "" {
+		v.Check(cfg.audit.username != "", "audit-username", validator.CodeRequired, "must be provided when an audit password is set")
+	}
+
+	v.Check(validator.PermittedValue(cfg.tracing.exporter, "none", "stdout", "file", "otlp"), "trace-exporter", validator.CodeNotPermitted, "must be none, stdout, file or otlp")
+	v.Check(cfg.tracing.sampleRatio >= 0 && cfg.tracing.sampleRatio <= 1, "trace-sample-ratio", validator.CodeInvalid, "must be between 0 and 1")
+	if cfg.tracing.exporter == "file" {
+		v.Check(cfg.tracing.file != "", "trace-file", validator.CodeRequired, "must be provided")
+	}
+}
+
+// stringList is a flag holding a space separated list of values.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = strings.Fields(value)
+	return nil
+}
+
+// configError turns the validation errors into a single error, one setting per line.
+func configError(v *validator.Validator) error {
+	lines := []string{"invalid configuration:"}
+	for _, e := range v.FieldErrors() {
+		lines = append(lines, fmt.Sprintf("  %s: %s", e.Field, e.Message))
+	}
+
+	return errors.New(strings.Join(lines, "\n"))
+}
+
+// dsnPasswordRX matches the password in a key=value PostgreSQL DSN.
+var dsnPasswordRX = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// redactSetting hides the value of a secret setting. Only the password is hidden
+// in a DSN, since the rest is useful when checking the config.
+func redactSetting(name, value string) string {
+	if !secretSettings[name] || value == "" {
+		return value
+	}
+
+	if name != "db-dsn" {
+		return "xxxxx"
+	}
+
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		return u.String()
+	}
+
+	return dsnPasswordRX.ReplaceAllString(value, "${1}xxxxx")
+}
+
+// printConfig handles "api config print", writing out the effective config as YAML
+// with the source of each setting. The output can be used as a config file once
+// the redacted secrets are filled back in.
+func printConfig(args []string) int {
+	_, settings, err := loadConfig(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+
+	for _, s := range settings {
+		fmt.Printf("%s: %s # %s\n", s.Name, strconv.Quote(s.Value), s.Source)
+	}
+
+	return 0
+}
@@ -2,16 +2,70 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+// Codes for each kind of error response, so clients can branch on them without
+// parsing the messages. These are part of the API and must not change.
+const (
+	codeBadRequest           = "bad_request"
+	codeUnauthorized         = "unauthorized"
+	codePasswordRequired     = "password_required"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeEditConflict         = "edit_conflict"
+	codeIdempotencyKeyInUse  = "idempotency_key_in_use"
+	codeIdempotencyKeyReused = "idempotency_key_reused"
+	codeFileTooLarge         = "file_too_large"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeTooManyRequests      = "too_many_requests"
+	codeValidationFailed     = "validation_failed"
+	codeServerError          = "server_error"
 )
 
+// problem is an RFC 9457 problem details object, sent instead of the usual
+// {"error": ...} envelope to clients which accept application/problem+json. The
+// type, title and instance are filled in by problemResponse.
+type problem struct {
+	Status int
+	Code   string
+	Detail string
+	Errors []validator.FieldError
+}
+
+// problemType is the type URI of the problems with the given code.
+func problemType(code string) string {
+	return "urn:notes:problem:" + code
+}
+
 // Generic helper function for logging an error message
 func (app *application) logError(r *http.Request, err error) {
+	if r != nil {
+		if id := requestIDFromContext(r.Context()); id != "" {
+			fmt.Printf("request_id=%s %v\n", id, err)
+			return
+		}
+	}
+
 	fmt.Println(err)
 }
 
 // handles errors and respond back to the user as a JSON message
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code string, message any) {
+	if wantsProblem(r) {
+		detail, _ := message.(string)
+		app.problemResponse(w, r, problem{Status: status, Code: code, Detail: detail})
+		return
+	}
+
 	env := envelope{"error": message}
 
 	err := app.writeJSON(w, status, env, nil)
@@ -21,15 +75,83 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 	}
 }
 
+// problemResponse sends p as problem details, with the request id as the instance.
+func (app *application) problemResponse(w http.ResponseWriter, r *http.Request, p problem) {
+	env := envelope{
+		"type":   problemType(p.Code),
+		"title":  http.StatusText(p.Status),
+		"status": p.Status,
+		"detail": p.Detail,
+		"code":   p.Code,
+	}
+
+	if id := requestIDFromContext(r.Context()); id != "" {
+		env["instance"] = "urn:uuid:" + id
+	}
+
+	if p.Errors != nil {
+		env["errors"] = p.Errors
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", "application/problem+json")
+
+	err := app.writeJSON(w, p.Status, env, headers)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+// wantsProblem reports whether the client asked for problem details by listing
+// application/problem+json in its Accept header.
+func wantsProblem(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == "application/problem+json" {
+			return true
+		}
+	}
+
+	return false
+}
+
 // 400 BAD REQUEST
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+}
+
+// 401 UNAUTHORIZED
+// handles shared notes which need a password that was missing or wrong. The
+// WWW-Authenticate header lets browsers prompt for it.
+func (app *application) passwordRequiredResponse(w http.ResponseWriter, r *http.Request, attempted bool) {
+	message := "a password is required to view this note"
+	if attempted {
+		message = "the password provided is incorrect"
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="shared note", charset="UTF-8"`)
+	app.errorResponse(w, r, http.StatusUnauthorized, codePasswordRequired, message)
+}
+
+// 401 UNAUTHORIZED
+// handles requests to a workspace without the token of one of its members
+func (app *application) invalidTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="workspace"`)
+	app.errorResponse(w, r, http.StatusUnauthorized, codeUnauthorized, "invalid or missing workspace member token")
+}
+
+// 403 FORBIDDEN
+// handles members whose role doesn't allow what they asked to do
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your role in this workspace does not allow this"
+	app.errorResponse(w, r, http.StatusForbidden, codeForbidden, message)
 }
 
 // 404 NOT FOUND
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, http.StatusNotFound, codeNotFound, message)
 
 }
 
@@ -37,20 +159,73 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request)
 // handles issues where a client has made a request where the method is not supported for that resource
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, message)
+}
+
+// 400 BAD REQUEST
+// handles an Idempotency-Key sent again with a different request than the one it
+// was first used for
+func (app *application) idempotencyKeyReusedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this Idempotency-Key was already used for a different request"
+	app.errorResponse(w, r, http.StatusBadRequest, codeIdempotencyKeyReused, message)
+}
+
+// 409 STATUS CONFLICT
+// handles a request repeated with an Idempotency-Key while the first request with
+// it is still being handled
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with this Idempotency-Key is still being handled, please try again"
+	app.errorResponse(w, r, http.StatusConflict, codeIdempotencyKeyInUse, message)
 }
 
 // 409 STATUS CONFLICT
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	app.metrics.editConflicts.Inc()
+
 	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.errorResponse(w, r, http.StatusConflict, codeEditConflict, message)
+}
+
+// 413 CONTENT TOO LARGE
+// handles uploads which are over the size limit
+func (app *application) fileTooLargeResponse(w http.ResponseWriter, r *http.Request, limit int64) {
+	message := fmt.Sprintf("file must not be larger than %d bytes", limit)
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, codeFileTooLarge, message)
+}
+
+// 415 UNSUPPORTED MEDIA TYPE
+// handles uploads of a type that the server does not accept
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, mediaType string) {
+	message := fmt.Sprintf("files of type %s are not supported", mediaType)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, message)
 }
 
 // 422 UNPROCESSABLE ENTITY
-// Note that the errors parameter here has the type map[string]string, which is exactly
-// the same as the errors map contained in our Validator type.
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+// The usual response holds the validator's map of field to message. Problem details
+// list each error along with its code instead.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	if wantsProblem(r) {
+		app.problemResponse(w, r, problem{
+			Status: http.StatusUnprocessableEntity,
+			Code:   codeValidationFailed,
+			Detail: "one or more fields failed validation",
+			Errors: v.FieldErrors(),
+		})
+		return
+	}
+
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, codeValidationFailed, v.Errors)
+}
+
+// 429 TOO MANY REQUESTS
+// handles shared notes locked after too many wrong passwords, telling the client
+// when it can try again
+func (app *application) tooManyPasswordAttemptsResponse(w http.ResponseWriter, r *http.Request, until time.Time) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+
+	message := "too many wrong passwords have been tried for this link, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, codeTooManyRequests, message)
 }
 
 // 500 INTERNAL SERVER ERROR
@@ -59,5 +234,5 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 	app.logError(r, err)
 
 	message := "The server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, codeServerError, message)
 }
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// graphqlError is an error a resolver returns to the client as it is, with the
+// same code as the matching REST error in its extensions. Any other error from a
+// resolver is logged and reported as a server error.
+type graphqlError struct {
+	code    string
+	message string
+	fields  []validator.FieldError
+}
+
+func (e *graphqlError) Error() string {
+	return e.message
+}
+
+func (e *graphqlError) Extensions() map[string]any {
+	ext := map[string]any{"code": e.code}
+	if len(e.fields) > 0 {
+		ext["errors"] = e.fields
+	}
+
+	return ext
+}
+
+var errGraphQLNotFound = &graphqlError{code: codeNotFound, message: "the requested resource could not be found"}
+
+var errGraphQLForbidden = &graphqlError{code: codeForbidden, message: "your role in this workspace does not allow this"}
+
+// canEdit reports whether the caller can change notes. Viewers can send queries,
+// but not mutations.
+func canEdit(ctx context.Context) bool {
+	return data.RoleAtLeast(roleFromContext(ctx), data.RoleEditor)
+}
+
+func validationError(v *validator.Validator) error {
+	return &graphqlError{code: codeValidationFailed, message: "the request failed validation", fields: v.FieldErrors()}
+}
+
+// graphqlHandler serves POST /v1/graphql. The schema is built once, up front.
+func (app *application) graphqlHandler() http.HandlerFunc {
+	schema, err := app.newGraphQLSchema()
+	if err != nil {
+		// the schema is fixed, so this is a bug rather than something to recover from
+		panic(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Query         string         `json:"query"`
+			OperationName string         `json:"operationName"`
+			Variables     map[string]any `json:"variables"`
+		}
+
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+		if v.Check(input.Query != "", "query", validator.CodeRequired, "must be provided"); !v.Valid() {
+			app.failedValidationResponse(w, r, v)
+			return
+		}
+
+		if depth, fields, ok := graphqlQueryShape(input.Query); ok {
+			v.Check(depth <= maxGraphQLDepth, "query", validator.CodeTooLarge, fmt.Sprintf("must not nest fields more than %d levels deep", maxGraphQLDepth))
+			v.Check(fields <= maxGraphQLFields, "query", validator.CodeTooLarge, fmt.Sprintf("must not select more than %d fields", maxGraphQLFields))
+			if !v.Valid() {
+				app.failedValidationResponse(w, r, v)
+				return
+			}
+		}
+
+		// every request gets its own loaders, so nothing is cached between requests
+		ctx := context.WithValue(r.Context(), loadersContextKey, app.newLoaders())
+
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  input.Query,
+			VariableValues: input.Variables,
+			OperationName:  input.OperationName,
+			Context:        ctx,
+		})
+
+		env := envelope{"data": result.Data}
+		if len(result.Errors) > 0 {
+			env["errors"] = app.graphqlErrors(r, result.Errors)
+		}
+
+		// GraphQL reports errors in the body, so the status is 200 either way
+		err = app.writeJSON(w, http.StatusOK, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// Limits on the shape of a query, checked before it is run. Each level of nesting
+// can fan out into another batch of queries for every note in the level above,
+// so queries such as backlinks of backlinks of backlinks are turned away, as are
+// queries which repeat fields many times over with aliases. Introspection fields
+// only read the schema, so they don't count.
+const (
+	maxGraphQLDepth  = 6
+	maxGraphQLFields = 200
+)
+
+// graphqlQueryShape returns how deeply the fields of a query nest and how many
+// there are, with fragments expanded where they're spread. Counting stops once
+// either limit is passed. ok is false when the query can't be parsed, which is
+// left to graphql.Do to report.
+func graphqlQueryShape(query string) (depth, fields int, ok bool) {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return 0, 0, false
+	}
+
+	fragments := make(map[string]*ast.SelectionSet)
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok && frag.Name != nil {
+			fragments[frag.Name.Value] = frag.SelectionSet
+		}
+	}
+
+	var walk func(set *ast.SelectionSet, level int, spread map[string]bool)
+	walk = func(set *ast.SelectionSet, level int, spread map[string]bool) {
+		if set == nil || depth > maxGraphQLDepth || fields > maxGraphQLFields {
+			return
+		}
+
+		for _, sel := range set.Selections {
+			switch sel := sel.(type) {
+			case *ast.Field:
+				if sel.Name != nil && strings.HasPrefix(sel.Name.Value, "__") {
+					continue
+				}
+
+				fields++
+				depth = max(depth, level)
+				walk(sel.SelectionSet, level+1, spread)
+
+			case *ast.InlineFragment:
+				walk(sel.SelectionSet, level, spread)
+
+			case *ast.FragmentSpread:
+				// a fragment spreading itself is an error graphql.Do reports
+				name := sel.Name.Value
+				if spread[name] {
+					continue
+				}
+
+				spread[name] = true
+				walk(fragments[name], level, spread)
+				delete(spread, name)
+			}
+		}
+	}
+
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			walk(op.SelectionSet, 1, make(map[string]bool))
+		}
+	}
+
+	return depth, fields, true
+}
+
+// graphqlErrors gives each error the code of the matching REST error. Errors that
+// didn't come from the query itself or a graphqlError are logged, and their
+// details hidden from the client.
+func (app *application) graphqlErrors(r *http.Request, errs []gqlerrors.FormattedError) []gqlerrors.FormattedError {
+	for i, formatted := range errs {
+		// resolver errors are wrapped a couple of times on their way out
+		var err error = formatted
+		for {
+			if fe, ok := err.(gqlerrors.FormattedError); ok && fe.OriginalError() != nil {
+				err = fe.OriginalError()
+			} else if ge, ok := err.(*gqlerrors.Error); ok && ge.OriginalError != nil {
+				err = ge.OriginalError
+			} else {
+				break
+			}
+		}
+
+		var gqlErr *graphqlError
+
+		switch {
+		case errors.As(err, &gqlErr):
+			errs[i].Message = gqlErr.message
+			errs[i].Extensions = gqlErr.Extensions()
+		case isGraphQLQueryError(err):
+			// syntax and validation errors in the query
+			errs[i].Extensions = map[string]any{"code": codeBadRequest}
+		default:
+			app.logError(r, err)
+			errs[i].Message = "the server encountered a problem and could not process this field"
+			errs[i].Extensions = map[string]any{"code": codeServerError}
+		}
+	}
+
+	return errs
+}
+
+func isGraphQLQueryError(err error) bool {
+	switch err.(type) {
+	case *gqlerrors.Error, gqlerrors.FormattedError:
+		return true
+	}
+
+	return false
+}
+
+// readGraphQLID parses a note id from an ID argument.
+func readGraphQLID(value any) (int64, bool) {
+	s, _ := value.(string)
+
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (app *application) newGraphQLSchema() (graphql.Schema, error) {
+	itemType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Item",
+		Description: "An entry in the checklist of a note.",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: itemField(func(i *data.Item) any { return i.ID })},
+			"text":     &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: itemField(func(i *data.Item) any { return i.Text })},
+			"checked":  &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: itemField(func(i *data.Item) any { return i.Checked })},
+			"position": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: itemField(func(i *data.Item) any { return i.Position })},
+			"dueAt":    &graphql.Field{Type: graphql.DateTime, Resolve: itemField(func(i *data.Item) any { return i.DueAt })},
+		},
+	})
+
+	tagType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Tag",
+		Description: "A tag, along with how many notes have it.",
+		Fields: graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: tagField(func(t *data.TagCount) any { return t.Tag })},
+			"notes": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: tagField(func(t *data.TagCount) any { return t.Notes })},
+		},
+	})
+
+	noteType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Note",
+		Fields: graphql.Fields{
+			"id":            &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: noteField(func(n *data.Note) any { return n.ID })},
+			"createdAt":     &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: noteField(func(n *data.Note) any { return n.CreatedAt })},
+			"lastUpdatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: noteField(func(n *data.Note) any { return n.LastUpdateAt })},
+			"title":         &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: noteField(func(n *data.Note) any { return n.Title })},
+			"content":       &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: noteField(func(n *data.Note) any { return n.Content })},
+			"tags":          &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), Resolve: noteField(func(n *data.Note) any { return nonNilTags(n.Tags) })},
+			"pinned":        &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: noteField(func(n *data.Note) any { return n.Pinned })},
+			"archived":      &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: noteField(func(n *data.Note) any { return n.Archived })},
+			"color":         &graphql.Field{Type: graphql.String, Resolve: noteField(func(n *data.Note) any { return nullString(n.Color) })},
+			"remindAt":      &graphql.Field{Type: graphql.DateTime, Resolve: noteField(func(n *data.Note) any { return n.RemindAt })},
+			"recurrence":    &graphql.Field{Type: graphql.String, Resolve: noteField(func(n *data.Note) any { return nullString(n.Recurrence) })},
+			"version":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: noteField(func(n *data.Note) any { return n.Version })},
+		},
+	})
+
+	// the nested fields refer back to Note, so they're added once it exists
+	noteType.AddFieldConfig("items", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(itemType))),
+		Description: "The checklist of the note, in order.",
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			thunk := loadersFromContext(p.Context).items.Load(p.Context, p.Source.(*data.Note).ID)
+			return func() (any, error) {
+				items, err := thunk()
+				if items == nil {
+					items = []*data.Item{}
+				}
+				return items, err
+			}, nil
+		},
+	})
+
+	noteType.AddFieldConfig("backlinks", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(noteType))),
+		Description: "The notes which link to this one.",
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			thunk := loadersFromContext(p.Context).backlinks.Load(p.Context, p.Source.(*data.Note).ID)
+			return func() (any, error) {
+				notes, err := thunk()
+				if notes == nil {
+					notes = []*data.Note{}
+				}
+				return notes, err
+			}, nil
+		},
+	})
+
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "NoteConnection",
+		Description: "A page of notes. Pass nextCursor or prevCursor back as the cursor argument for the pages either side.",
+		Fields: graphql.Fields{
+			"nodes":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(noteType)))},
+			"totalCount": &graphql.Field{Type: graphql.Int, Description: "Only counted for pages picked by number."},
+			"nextCursor": &graphql.Field{Type: graphql.String},
+			"prevCursor": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	noteFields := func(required bool) graphql.InputObjectConfigFieldMap {
+		title := graphql.Input(graphql.String)
+		if required {
+			title = graphql.NewNonNull(graphql.String)
+		}
+
+		return graphql.InputObjectConfigFieldMap{
+			"title":      &graphql.InputObjectFieldConfig{Type: title},
+			"content":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"tags":       &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			"pinned":     &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+			"archived":   &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+			"color":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"remindAt":   &graphql.InputObjectFieldConfig{Type: graphql.DateTime, Description: "Send null to clear the reminder."},
+			"recurrence": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		}
+	}
+
+	createInputType := graphql.NewInputObject(graphql.InputObjectConfig{Name: "CreateNoteInput", Fields: noteFields(true)})
+	updateInputType := graphql.NewInputObject(graphql.InputObjectConfig{Name: "UpdateNoteInput", Fields: noteFields(false)})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"note": &graphql.Field{
+				Type: noteType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: app.resolveNote,
+			},
+			"notes": &graphql.Field{
+				Type:        graphql.NewNonNull(connectionType),
+				Description: "Lists notes, with the same filters as GET /v1/notes.",
+				Args: graphql.FieldConfigArgument{
+					"q":           &graphql.ArgumentConfig{Type: graphql.String},
+					"tags":        &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+					"archived":    &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+					"pinned":      &graphql.ArgumentConfig{Type: graphql.Boolean},
+					"pinnedFirst": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: true},
+					"sort":        &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "-last_updated_at"},
+					"page":        &graphql.ArgumentConfig{Type: graphql.Int},
+					"pageSize":    &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 20},
+					"cursor":      &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: app.resolveNotes,
+			},
+			"tags": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tagType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return app.models.Notes.GetTags(p.Context)
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createNote": &graphql.Field{
+				Type: graphql.NewNonNull(noteType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createInputType)},
+				},
+				Resolve: app.resolveCreateNote,
+			},
+			"updateNote": &graphql.Field{
+				Type:        graphql.NewNonNull(noteType),
+				Description: "Updates the fields given in input. Pass the version the change was based on to fail with an edit conflict if the note has changed since.",
+				Args: graphql.FieldConfigArgument{
+					"id":           &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"version":      &graphql.ArgumentConfig{Type: graphql.Int},
+					"input":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateInputType)},
+					"rewriteLinks": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+				},
+				Resolve: app.resolveUpdateNote,
+			},
+			"deleteNote": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.ID),
+				Description: "Deletes a note, returning its id.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: app.resolveDeleteNote,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func noteField(fn func(*data.Note) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return fn(p.Source.(*data.Note)), nil
+	}
+}
+
+func itemField(fn func(*data.Item) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return fn(p.Source.(*data.Item)), nil
+	}
+}
+
+func tagField(fn func(*data.TagCount) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return fn(p.Source.(*data.TagCount)), nil
+	}
+}
+
+// nullString turns the empty string used for unset text columns into null.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// stringsArg converts a list argument, which arrives as []any.
+func stringsArg(value any) []string {
+	list, ok := value.([]any)
+	if !ok {
+		return nil
+	}
+
+	s := make([]string, len(list))
+	for i, item := range list {
+		s[i], _ = item.(string)
+	}
+
+	return s
+}
+
+func (app *application) resolveNote(p graphql.ResolveParams) (any, error) {
+	id, ok := readGraphQLID(p.Args["id"])
+	if !ok {
+		return nil, nil
+	}
+
+	// going through the loader means a note asked for more than once in the same
+	// query is only fetched once
+	thunk := loadersFromContext(p.Context).notes.Load(p.Context, id)
+
+	return func() (any, error) {
+		note, err := thunk()
+		if err != nil || note == nil {
+			return nil, err
+		}
+		return note, nil
+	}, nil
+}
+
+func (app *application) resolveNotes(p graphql.ResolveParams) (any, error) {
+	var query data.NoteQuery
+	var filters data.Filters
+
+	v := validator.New()
+
+	query.Search, _ = p.Args["q"].(string)
+	query.Tags = stringsArg(p.Args["tags"])
+	query.Archived, _ = p.Args["archived"].(bool)
+	query.PinnedFirst, _ = p.Args["pinnedFirst"].(bool)
+	if pinned, ok := p.Args["pinned"].(bool); ok {
+		query.Pinned = &pinned
+	}
+
+	filters.Sort, _ = p.Args["sort"].(string)
+	filters.SortSafelist = noteSortSafelist
+	filters.PageSize, _ = p.Args["pageSize"].(int)
+
+	filters.Page = 1
+	if page, ok := p.Args["page"].(int); ok {
+		filters.Page = page
+	}
+
+	if token, ok := p.Args["cursor"].(string); ok && token != "" {
+		cursor, err := data.DecodeCursor(token, app.cursorKey)
+		if err != nil {
+			v.AddError("cursor", validator.CodeInvalid, "is not a valid cursor")
+		} else {
+			filters.Cursor = &cursor
+			v.Check(p.Args["page"] == nil, "page", validator.CodeInvalid, "must not be used with a cursor")
+			v.Check(cursor.Sort == filters.Sort && (cursor.Pinned != nil) == query.PinnedFirst,
+				"cursor", validator.CodeInvalid, "was made for a different sort or pinnedFirst")
+		}
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		return nil, validationError(v)
+	}
+
+	notes, metadata, err := app.models.Notes.GetAll(p.Context, query, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			v.AddError("cursor", validator.CodeInvalid, "is not a valid cursor")
+			return nil, validationError(v)
+		default:
+			return nil, err
+		}
+	}
+
+	connection := map[string]any{"nodes": notes}
+
+	if filters.Cursor == nil {
+		connection["totalCount"] = metadata.TotalRecords
+	}
+	if metadata.NextCursor != nil {
+		connection["nextCursor"] = metadata.NextCursor.Encode(app.cursorKey)
+	}
+	if metadata.PrevCursor != nil {
+		connection["prevCursor"] = metadata.PrevCursor.Encode(app.cursorKey)
+	}
+
+	return connection, nil
+}
+
+func (app *application) resolveCreateNote(p graphql.ResolveParams) (any, error) {
+	if !canEdit(p.Context) {
+		return nil, errGraphQLForbidden
+	}
+
+	input := p.Args["input"].(map[string]any)
+
+	note := &data.Note{}
+	applyNoteInput(note, input)
+
+	v := validator.New()
+	if data.ValidateNote(v, note); !v.Valid() {
+		return nil, validationError(v)
+	}
+
+	err := app.models.Notes.Insert(p.Context, note)
+	if err != nil {
+		return nil, err
+	}
+
+	app.noteCreated(note)
+
+	return note, nil
+}
+
+func (app *application) resolveUpdateNote(p graphql.ResolveParams) (any, error) {
+	if !canEdit(p.Context) {
+		return nil, errGraphQLForbidden
+	}
+
+	id, ok := readGraphQLID(p.Args["id"])
+	if !ok {
+		return nil, errGraphQLNotFound
+	}
+
+	note, err := app.models.Notes.Get(p.Context, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, errGraphQLNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	editConflict := &graphqlError{code: codeEditConflict, message: "unable to update the record due to an edit conflict, please try again"}
+
+	// the client's copy is out of date, so its changes would overwrite someone else's
+	if version, ok := p.Args["version"].(int); ok && int32(version) != note.Version {
+		app.metrics.editConflicts.Inc()
+		return nil, editConflict
+	}
+
+	oldTitle := note.Title
+	applyNoteInput(note, p.Args["input"].(map[string]any))
+
+	v := validator.New()
+	if data.ValidateNote(v, note); !v.Valid() {
+		return nil, validationError(v)
+	}
+
+	if rewriteLinks, _ := p.Args["rewriteLinks"].(bool); rewriteLinks {
+		_, err = app.models.Notes.UpdateAndRewriteLinks(p.Context, note, oldTitle)
+	} else {
+		err = app.models.Notes.Update(p.Context, note)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.metrics.editConflicts.Inc()
+			return nil, editConflict
+		default:
+			return nil, err
+		}
+	}
+
+	app.noteUpdated(note)
+
+	return note, nil
+}
+
+func (app *application) resolveDeleteNote(p graphql.ResolveParams) (any, error) {
+	if !canEdit(p.Context) {
+		return nil, errGraphQLForbidden
+	}
+
+	id, ok := readGraphQLID(p.Args["id"])
+	if !ok {
+		return nil, errGraphQLNotFound
+	}
+
+	err := app.deleteNote(p.Context, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, errGraphQLNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return id, nil
+}
+
+// applyNoteInput copies the fields present in a CreateNoteInput or UpdateNoteInput
+// onto note. A field sent as null is only meaningful for remindAt, which it clears.
+func applyNoteInput(note *data.Note, input map[string]any) {
+	if title, ok := input["title"].(string); ok {
+		note.Title = title
+	}
+
+	if content, ok := input["content"].(string); ok {
+		note.Content = content
+	}
+
+	if tags, ok := input["tags"]; ok && tags != nil {
+		note.Tags = stringsArg(tags)
+	}
+
+	if pinned, ok := input["pinned"].(bool); ok {
+		note.Pinned = pinned
+	}
+
+	if archived, ok := input["archived"].(bool); ok {
+		note.Archived = archived
+	}
+
+	if color, ok := input["color"].(string); ok {
+		note.Color = color
+	}
+
+	if remindAt, ok := input["remindAt"]; ok {
+		note.RemindAt = nil
+		if t, ok := remindAt.(time.Time); ok {
+			note.RemindAt = &t
+		}
+	}
+
+	if recurrence, ok := input["recurrence"].(string); ok {
+		note.Recurrence = recurrence
+	}
+}
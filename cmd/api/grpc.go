@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/notify"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	notesv1 "github.com/KevuTheDev/notes-backend-api/proto/notes/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// newGRPCServer returns the gRPC server for the notes.v1 API. It is served over
+// TLS when tlsConfig is set.
+func (app *application) newGRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(app.traceUnary, app.auditUnary, app.workspaceUnary),
+		grpc.ChainStreamInterceptor(app.traceStream, app.workspaceStream),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	notesv1.RegisterNotesServiceServer(srv, &notesServer{app: app})
+
+	// lets tools such as grpcurl list the services without the .proto files
+	reflection.Register(srv)
+
+	return srv
+}
+
+// serveGRPC runs the gRPC server on the grpc-port until it fails.
+func (app *application) serveGRPC(srv *grpc.Server) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", app.config.grpc.port))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Launching gRPC server on port %d...\n", app.config.grpc.port)
+
+	return srv.Serve(lis)
+}
+
+// traceUnary and traceStream give every call a server span, as traceRequests does
+// for HTTP requests, and turn a panic in a handler into an Internal error rather
+// than taking the whole server down.
+func (app *application) traceUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ any, err error) {
+	ctx, span := tracer.Start(ctx, info.FullMethod,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("rpc.system", "grpc"), attribute.String("rpc.method", info.FullMethod)),
+	)
+	defer func() { endSpan(span, err) }()
+	defer app.recoverGRPC(&err)
+
+	return handler(ctx, req)
+}
+
+func (app *application) traceStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx, span := tracer.Start(ss.Context(), info.FullMethod,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("rpc.system", "grpc"), attribute.String("rpc.method", info.FullMethod)),
+	)
+	defer func() { endSpan(span, err) }()
+	defer app.recoverGRPC(&err)
+
+	return handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+}
+
+// auditUnary records where a call came from for the audit log, as auditSource
+// does for HTTP requests. The request id is taken from the x-request-id metadata
+// when it's a UUID, and sent back in the response header.
+func (app *application) auditUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var source data.AuditSource
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get("x-request-id"); len(ids) > 0 && requestIDRX.MatchString(ids[0]) {
+			source.RequestID = ids[0]
+		}
+	}
+	if source.RequestID == "" {
+		source.RequestID = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", source.RequestID))
+
+	if p, ok := peer.FromContext(ctx); ok {
+		source.IP = remoteIP(p.Addr.String())
+	}
+
+	return handler(data.WithAuditSource(ctx, source), req)
+}
+
+// workspaceUnary and workspaceStream pick the workspace for a call from its
+// x-workspace metadata and check the bearer token in its authorization metadata,
+// as workspaceScope does for HTTP requests. Get, List and Watch calls need the
+// viewer role, and the rest the editor role.
+func (app *application) workspaceUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := app.grpcWorkspace(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (app *application) workspaceStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := app.grpcWorkspace(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+}
+
+func (app *application) grpcWorkspace(ctx context.Context, fullMethod string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	refs := md.Get("x-workspace")
+	if len(refs) == 0 || refs[0] == "" {
+		return ctx, nil
+	}
+
+	var token string
+	if auth := md.Get("authorization"); len(auth) > 0 {
+		if scheme, t, ok := strings.Cut(auth[0], " "); ok && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(t)
+		}
+	}
+
+	min := data.RoleEditor
+	method := path.Base(fullMethod)
+	if strings.HasPrefix(method, "Get") || strings.HasPrefix(method, "List") || strings.HasPrefix(method, "Watch") {
+		min = data.RoleViewer
+	}
+
+	ws, member, err := app.authorizeWorkspace(ctx, refs[0], token, min)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, status.Error(codes.NotFound, "the requested workspace could not be found")
+		case errors.Is(err, errInvalidToken):
+			return nil, status.Error(codes.Unauthenticated, errInvalidToken.Error())
+		case errors.Is(err, errForbidden):
+			return nil, status.Error(codes.PermissionDenied, "your role in this workspace does not allow this")
+		default:
+			app.logError(nil, err)
+			return nil, status.Error(codes.Internal, "the server encountered a problem and could not process your request")
+		}
+	}
+
+	ctx = data.WithWorkspace(ctx, ws.ID)
+	if member != nil {
+		ctx = context.WithValue(ctx, memberContextKey, member)
+		ctx = data.WithAuditActor(ctx, member.Email)
+	}
+
+	return ctx, nil
+}
+
+func (app *application) recoverGRPC(err *error) {
+	if p := recover(); p != nil {
+		app.logError(nil, fmt.Errorf("%s", p))
+		*err = status.Error(codes.Internal, "the server encountered a problem and could not process your request")
+	}
+}
+
+// tracedStream carries the context set up by an interceptor, such as the one with
+// the call's span, to the handler.
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+// notesServer implements notes.v1.NotesService on top of the same models as the
+// JSON API.
+type notesServer struct {
+	notesv1.UnimplementedNotesServiceServer
+	app *application
+}
+
+func (s *notesServer) CreateNote(ctx context.Context, req *notesv1.CreateNoteRequest) (*notesv1.Note, error) {
+	note := &data.Note{
+		Title:      req.GetTitle(),
+		Content:    req.GetContent(),
+		Tags:       req.GetTags(),
+		Pinned:     req.GetPinned(),
+		Archived:   req.GetArchived(),
+		Color:      req.GetColor(),
+		RemindAt:   timeFromProto(req.GetRemindAt()),
+		Recurrence: req.GetRecurrence(),
+	}
+
+	v := validator.New()
+	if data.ValidateNote(v, note); !v.Valid() {
+		return nil, grpcValidationError(v)
+	}
+
+	err := s.app.models.Notes.Insert(ctx, note)
+	if err != nil {
+		return nil, s.grpcError(err)
+	}
+
+	s.app.noteCreated(note)
+
+	return noteToProto(note), nil
+}
+
+func (s *notesServer) GetNote(ctx context.Context, req *notesv1.GetNoteRequest) (*notesv1.Note, error) {
+	note, err := s.app.models.Notes.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, s.grpcError(err)
+	}
+
+	return noteToProto(note), nil
+}
+
+// updatableNoteFields are the paths an UpdateNoteRequest's update_mask can name.
+var updatableNoteFields = []string{"title", "content", "tags", "pinned", "archived", "color", "remind_at", "recurrence"}
+
+func (s *notesServer) UpdateNote(ctx context.Context, req *notesv1.UpdateNoteRequest) (*notesv1.Note, error) {
+	v := validator.New()
+
+	input := req.GetNote()
+	paths := req.GetUpdateMask().GetPaths()
+
+	v.Check(input != nil, "note", validator.CodeRequired, "must be provided")
+	v.Check(len(paths) > 0, "update_mask", validator.CodeRequired, "must name at least one field")
+	for _, path := range paths {
+		v.Check(slices.Contains(updatableNoteFields, path), "update_mask", validator.CodeNotPermitted,
+			fmt.Sprintf("%q is not a field that can be updated", path))
+	}
+	if !v.Valid() {
+		return nil, grpcValidationError(v)
+	}
+
+	note, err := s.app.models.Notes.Get(ctx, input.GetId())
+	if err != nil {
+		return nil, s.grpcError(err)
+	}
+
+	// the client's copy is out of date, so its changes would overwrite someone else's
+	if input.GetVersion() != 0 && input.GetVersion() != note.Version {
+		return nil, s.grpcError(data.ErrEditConflict)
+	}
+
+	oldTitle := note.Title
+
+	for _, path := range paths {
+		switch path {
+		case "title":
+			note.Title = input.GetTitle()
+		case "content":
+			note.Content = input.GetContent()
+		case "tags":
+			note.Tags = input.GetTags()
+		case "pinned":
+			note.Pinned = input.GetPinned()
+		case "archived":
+			note.Archived = input.GetArchived()
+		case "color":
+			note.Color = input.GetColor()
+		case "remind_at":
+			// naming remind_at without setting it clears the reminder
+			note.RemindAt = timeFromProto(input.GetRemindAt())
+		case "recurrence":
+			note.Recurrence = input.GetRecurrence()
+		}
+	}
+
+	if data.ValidateNote(v, note); !v.Valid() {
+		return nil, grpcValidationError(v)
+	}
+
+	if req.GetRewriteLinks() {
+		_, err = s.app.models.Notes.UpdateAndRewriteLinks(ctx, note, oldTitle)
+	} else {
+		err = s.app.models.Notes.Update(ctx, note)
+	}
+	if err != nil {
+		return nil, s.grpcError(err)
+	}
+
+	s.app.noteUpdated(note)
+
+	return noteToProto(note), nil
+}
+
+func (s *notesServer) DeleteNote(ctx context.Context, req *notesv1.DeleteNoteRequest) (*emptypb.Empty, error) {
+	err := s.app.deleteNote(ctx, req.GetId())
+	if err != nil {
+		return nil, s.grpcError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *notesServer) ListNotes(ctx context.Context, req *notesv1.ListNotesRequest) (*notesv1.ListNotesResponse, error) {
+	query := data.NoteQuery{
+		Search:      req.GetQuery(),
+		Tags:        req.GetTags(),
+		Archived:    req.GetArchived(),
+		Pinned:      req.Pinned,
+		PinnedFirst: req.PinnedFirst == nil || *req.PinnedFirst,
+	}
+
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     int(req.GetPageSize()),
+		Sort:         req.GetSort(),
+		SortSafelist: noteSortSafelist,
+	}
+	if filters.PageSize == 0 {
+		filters.PageSize = 20
+	}
+	if filters.Sort == "" {
+		filters.Sort = "-last_updated_at"
+	}
+
+	v := validator.New()
+
+	if token := req.GetPageToken(); token != "" {
+		cursor, err := data.DecodeCursor(token, s.app.cursorKey)
+		if err != nil {
+			v.AddError("page_token", validator.CodeInvalid, "is not a valid page token")
+		} else {
+			filters.Cursor = &cursor
+			v.Check(cursor.Sort == filters.Sort && (cursor.Pinned != nil) == query.PinnedFirst,
+				"page_token", validator.CodeInvalid, "was made for a different sort or pinned_first")
+		}
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		return nil, grpcValidationError(v)
+	}
+
+	notes, metadata, err := s.app.models.Notes.GetAll(ctx, query, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			v.AddError("page_token", validator.CodeInvalid, "is not a valid page token")
+			return nil, grpcValidationError(v)
+		default:
+			return nil, s.grpcError(err)
+		}
+	}
+
+	resp := &notesv1.ListNotesResponse{
+		Notes: make([]*notesv1.Note, len(notes)),
+	}
+	for i, note := range notes {
+		resp.Notes[i] = noteToProto(note)
+	}
+
+	if filters.Cursor == nil {
+		resp.TotalSize = int32(metadata.TotalRecords)
+	}
+	if metadata.NextCursor != nil {
+		resp.NextPageToken = metadata.NextCursor.Encode(s.app.cursorKey)
+	}
+	if metadata.PrevCursor != nil {
+		resp.PrevPageToken = metadata.PrevCursor.Encode(s.app.cursorKey)
+	}
+
+	return resp, nil
+}
+
+// watchBuffer is how many changes can queue up for a WatchNotes stream before
+// the client is too far behind, and the stream is ended with ResourceExhausted so
+// the client knows to fetch the notes again.
+const watchBuffer = 64
+
+func (s *notesServer) WatchNotes(req *notesv1.WatchNotesRequest, stream notesv1.NotesService_WatchNotesServer) error {
+	changes, unsubscribe := s.app.changes.Subscribe(watchBuffer)
+	defer unsubscribe()
+
+	ids := req.GetNoteIds()
+	workspaceID := data.WorkspaceID(stream.Context())
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case change, ok := <-changes:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "the stream fell too far behind and missed changes, fetch the notes again and start a new watch")
+			}
+
+			if change.WorkspaceID != workspaceID || (len(ids) > 0 && !slices.Contains(ids, change.NoteID)) {
+				continue
+			}
+
+			if err := stream.Send(noteEventToProto(change)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcError maps an error from the models to a gRPC status. Anything unexpected
+// is logged and hidden from the client, like serverErrorResponse does.
+func (s *notesServer) grpcError(err error) error {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "the requested resource could not be found")
+	case errors.Is(err, data.ErrEditConflict):
+		s.app.metrics.editConflicts.Inc()
+		return status.Error(codes.Aborted, "unable to update the record due to an edit conflict, please try again")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		s.app.logError(nil, err)
+		return status.Error(codes.Internal, "the server encountered a problem and could not process your request")
+	}
+}
+
+// grpcValidationError turns the errors in v into an InvalidArgument status, with
+// a BadRequest detail holding a violation for each field.
+func grpcValidationError(v *validator.Validator) error {
+	br := &errdetails.BadRequest{}
+	for _, fe := range v.FieldErrors() {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field,
+			Description: fe.Message,
+		})
+	}
+
+	st, err := status.New(codes.InvalidArgument, "the request failed validation").WithDetails(br)
+	if err != nil {
+		// only fails if the detail can't be marshalled
+		panic(err)
+	}
+
+	return st.Err()
+}
+
+func noteToProto(note *data.Note) *notesv1.Note {
+	n := &notesv1.Note{
+		Id:            note.ID,
+		CreatedAt:     timestamppb.New(note.CreatedAt),
+		LastUpdatedAt: timestamppb.New(note.LastUpdateAt),
+		Title:         note.Title,
+		Content:       note.Content,
+		Tags:          note.Tags,
+		Pinned:        note.Pinned,
+		Archived:      note.Archived,
+		Color:         note.Color,
+		Recurrence:    note.Recurrence,
+		Version:       note.Version,
+	}
+	if note.RemindAt != nil {
+		n.RemindAt = timestamppb.New(*note.RemindAt)
+	}
+
+	return n
+}
+
+func noteEventToProto(change notify.NoteChange) *notesv1.NoteEvent {
+	event := &notesv1.NoteEvent{NoteId: change.NoteID}
+
+	switch change.Type {
+	case notify.NoteCreated:
+		event.Type = notesv1.NoteEvent_TYPE_CREATED
+	case notify.NoteUpdated:
+		event.Type = notesv1.NoteEvent_TYPE_UPDATED
+	case notify.NoteDeleted:
+		event.Type = notesv1.NoteEvent_TYPE_DELETED
+	}
+
+	if change.Note != nil {
+		event.Note = noteToProto(change.Note)
+	}
+
+	return event
+}
+
+// timeFromProto returns nil for an unset timestamp.
+func timeFromProto(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+
+	t := ts.AsTime()
+	return &t
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/importer"
+	"github.com/KevuTheDev/notes-backend-api/internal/notify"
+	notesv1 "github.com/KevuTheDev/notes-backend-api/proto/notes/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// newTestGRPC serves the gRPC API over an in-process listener, on top of a mock
+// database that each test sets its expected queries on.
+func newTestGRPC(t *testing.T) (notesv1.NotesServiceClient, sqlmock.Sqlmock, *application) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		db:         db,
+		models:     data.NewModels(db),
+		metrics:    newAppMetrics(db),
+		importJobs: importer.NewJobs(time.Hour),
+		events:     notify.NewBus(),
+		changes:    notify.NewChanges(),
+		workers:    newWorkerRegistry(),
+		cursorKey:  []byte("grpc test cursor key"),
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := app.newGRPCServer(nil)
+	go srv.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+		db.Close()
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return notesv1.NewNotesServiceClient(conn), mock, app
+}
+
+var testNoteColumns = []string{"id", "created_at", "last_updated_at", "title", "content", "tags", "pinned",
+	"archived", "color", "remind_at", "recurrence", "version", "workspace_id"}
+
+var testNoteTime = time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC)
+
+func testNoteRow(id int64, title string, version int32) []driver.Value {
+	return []driver.Value{id, testNoteTime, testNoteTime, title, "", "{}", false, false, "", nil, "", version, data.DefaultWorkspaceID}
+}
+
+func expectNoteRow(mock sqlmock.Sqlmock, query string, id int64, title string, version int32) {
+	mock.ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs(id, data.DefaultWorkspaceID).
+		WillReturnRows(sqlmock.NewRows(testNoteColumns).AddRow(testNoteRow(id, title, version)...))
+}
+
+func expectCreate(mock sqlmock.Sqlmock, id int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO notes")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "last_updated_at", "version"}).
+			AddRow(id, testNoteTime, testNoteTime, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM note_links")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_events")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func wantCode(t *testing.T, err error, code codes.Code) *status.Status {
+	t.Helper()
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != code {
+		t.Fatalf("got error %v, want code %s", err, code)
+	}
+	return st
+}
+
+func TestGRPCNoteLifecycle(t *testing.T) {
+	client, mock, _ := newTestGRPC(t)
+	ctx := context.Background()
+
+	// create
+	expectCreate(mock, 1)
+
+	note, err := client.CreateNote(ctx, &notesv1.CreateNoteRequest{Title: "Groceries", Tags: []string{"home"}})
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+	if note.GetId() != 1 || note.GetTitle() != "Groceries" || note.GetVersion() != 1 {
+		t.Errorf("CreateNote returned %v", note)
+	}
+
+	// get
+	expectNoteRow(mock, "FROM notes WHERE id = $1 AND workspace_id = $2", 1, "Groceries", 1)
+
+	note, err = client.GetNote(ctx, &notesv1.GetNoteRequest{Id: 1})
+	if err != nil {
+		t.Fatalf("GetNote: %v", err)
+	}
+	if note.GetId() != 1 || note.GetTitle() != "Groceries" {
+		t.Errorf("GetNote returned %v", note)
+	}
+
+	// update, only changing the fields named in the mask
+	expectNoteRow(mock, "FROM notes WHERE id = $1 AND workspace_id = $2", 1, "Groceries", 1)
+	mock.ExpectBegin()
+	expectNoteRow(mock, "FROM notes WHERE id = $1 AND workspace_id = $2 FOR UPDATE", 1, "Groceries", 1)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE notes")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "last_updated_at"}).AddRow(2, testNoteTime))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM note_links")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_events")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	note, err = client.UpdateNote(ctx, &notesv1.UpdateNoteRequest{
+		Note:       &notesv1.Note{Id: 1, Version: 1, Title: "Shopping", Content: "ignored"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateNote: %v", err)
+	}
+	if note.GetTitle() != "Shopping" || note.GetContent() != "" || note.GetVersion() != 2 {
+		t.Errorf("UpdateNote returned %v", note)
+	}
+
+	// list
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) OVER()")).
+		WillReturnRows(sqlmock.NewRows(append([]string{"count"}, testNoteColumns...)).
+			AddRow(append([]driver.Value{2}, testNoteRow(2, "Later", 1)...)...).
+			AddRow(append([]driver.Value{2}, testNoteRow(1, "Shopping", 2)...)...))
+
+	list, err := client.ListNotes(ctx, &notesv1.ListNotesRequest{})
+	if err != nil {
+		t.Fatalf("ListNotes: %v", err)
+	}
+	if len(list.GetNotes()) != 2 || list.GetTotalSize() != 2 || list.GetNextPageToken() != "" {
+		t.Errorf("ListNotes returned %v", list)
+	}
+
+	// delete
+	mock.ExpectBegin()
+	expectNoteRow(mock, "FROM notes WHERE id = $1 AND workspace_id = $2 FOR UPDATE", 1, "Shopping", 2)
+	mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM note_attachments")).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key"}))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM notes WHERE id = $1")).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_events")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if _, err := client.DeleteNote(ctx, &notesv1.DeleteNoteRequest{Id: 1}); err != nil {
+		t.Fatalf("DeleteNote: %v", err)
+	}
+}
+
+func TestGRPCNotFound(t *testing.T) {
+	client, mock, _ := newTestGRPC(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM notes WHERE id = $1 AND workspace_id = $2")).
+		WithArgs(int64(42), data.DefaultWorkspaceID).
+		WillReturnRows(sqlmock.NewRows(testNoteColumns))
+
+	_, err := client.GetNote(context.Background(), &notesv1.GetNoteRequest{Id: 42})
+	wantCode(t, err, codes.NotFound)
+
+	// ids below 1 are turned away without a query
+	_, err = client.DeleteNote(context.Background(), &notesv1.DeleteNoteRequest{Id: 0})
+	wantCode(t, err, codes.NotFound)
+}
+
+func TestGRPCUpdateConflict(t *testing.T) {
+	client, mock, _ := newTestGRPC(t)
+
+	// the note has moved on to version 3 since the client read it
+	expectNoteRow(mock, "FROM notes WHERE id = $1 AND workspace_id = $2", 1, "Groceries", 3)
+
+	_, err := client.UpdateNote(context.Background(), &notesv1.UpdateNoteRequest{
+		Note:       &notesv1.Note{Id: 1, Version: 2, Title: "Shopping"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+	})
+	wantCode(t, err, codes.Aborted)
+}
+
+func TestGRPCValidation(t *testing.T) {
+	client, _, _ := newTestGRPC(t)
+
+	_, err := client.CreateNote(context.Background(), &notesv1.CreateNoteRequest{Color: "plaid", Tags: []string{"a", "a"}})
+	st := wantCode(t, err, codes.InvalidArgument)
+
+	var fields []string
+	for _, detail := range st.Details() {
+		br, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			t.Fatalf("unexpected detail %T", detail)
+		}
+		for _, fv := range br.GetFieldViolations() {
+			if fv.GetDescription() == "" {
+				t.Errorf("violation for %s has no description", fv.GetField())
+			}
+			fields = append(fields, fv.GetField())
+		}
+	}
+
+	for _, want := range []string{"title", "tags", "color"} {
+		found := false
+		for _, field := range fields {
+			found = found || field == want
+		}
+		if !found {
+			t.Errorf("no field violation for %s in %v", want, fields)
+		}
+	}
+}
+
+func TestGRPCWatchNotes(t *testing.T) {
+	client, mock, app := newTestGRPC(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchNotes(ctx, &notesv1.WatchNotesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan *notesv1.NoteEvent)
+	go func() {
+		defer close(events)
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			events <- event
+		}
+	}()
+
+	// the server subscribes some time after the stream is opened, so changes to
+	// a note that doesn't exist are published until one makes it through
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+subscribed:
+	for {
+		select {
+		case <-events:
+			break subscribed
+		case <-ticker.C:
+			app.changes.Publish(notify.NoteChange{Type: notify.NoteUpdated, NoteID: -1, WorkspaceID: data.DefaultWorkspaceID})
+		case <-ctx.Done():
+			t.Fatal("the watch never started")
+		}
+	}
+
+	// a change in another workspace is not sent
+	app.changes.Publish(notify.NoteChange{Type: notify.NoteDeleted, NoteID: 99, WorkspaceID: data.DefaultWorkspaceID + 1})
+
+	expectCreate(mock, 7)
+
+	if _, err := client.CreateNote(ctx, &notesv1.CreateNoteRequest{Title: "Watched"}); err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+
+	for event := range events {
+		if event.GetNoteId() == -1 {
+			continue
+		}
+
+		if event.GetType() != notesv1.NoteEvent_TYPE_CREATED || event.GetNoteId() != 7 || event.GetNote().GetTitle() != "Watched" {
+			t.Errorf("got event %v, want the created note", event)
+		}
+		return
+	}
+
+	t.Fatal("the stream ended without the created note")
+}
@@ -1,19 +1,194 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/migrations"
+)
+
+const (
+	statusOK       = "ok"
+	statusDegraded = "degraded"
 )
 
+// how long the readiness check waits on the database before calling it down
+const readinessTimeout = 2 * time.Second
+
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	components, ready := app.readiness(r.Context())
+
+	status := "available"
+	code := http.StatusOK
+	if !ready {
+		status = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+
 	env := envelope{
-		"status":      "available",
+		"status":      status,
 		"environment": app.config.env,
 		"version":     version,
+		"components":  components,
 	}
 
 	// Write Json
-	err := app.writeJSON(w, http.StatusOK, env, nil)
+	err := app.writeJSON(w, code, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// liveness only says the process is up and serving requests. It deliberately
+// doesn't look at the database, so an outage there doesn't get the API restarted.
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readiness checks everything the API needs to serve traffic, and responds with
+// 503 and a report on each component if any of them are degraded.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	components, ready := app.readiness(r.Context())
+
+	status := statusOK
+	code := http.StatusOK
+	if !ready {
+		status = statusDegraded
+		code = http.StatusServiceUnavailable
+	}
+
+	err := app.writeJSON(w, code, envelope{"status": status, "components": components}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// componentStatus is the readiness report for a single dependency.
+type componentStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// readiness runs every readiness check, returning a report keyed by component and
+// whether all of them passed.
+func (app *application) readiness(ctx context.Context) (map[string]componentStatus, bool) {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	components := map[string]componentStatus{
+		"database":   app.checkDatabase(ctx),
+		"pool":       app.checkPool(),
+		"migrations": app.checkMigrations(ctx),
+		"workers":    app.checkWorkers(),
+	}
+
+	ready := true
+	for _, c := range components {
+		if c.Status != statusOK {
+			ready = false
+		}
+	}
+
+	return components, ready
+}
+
+func (app *application) checkDatabase(ctx context.Context) componentStatus {
+	start := time.Now()
+
+	if err := app.db.PingContext(ctx); err != nil {
+		return componentStatus{Status: statusDegraded, Message: err.Error()}
+	}
+
+	return componentStatus{
+		Status:  statusOK,
+		Details: envelope{"latency": time.Since(start).String()},
+	}
+}
+
+// checkPool reports on the connection pool. It never fails readiness, since every
+// connection being in use is normal at peak load and failing then would take
+// every instance out of the load balancer at once. Saturation shows up in the
+// wait_count and wait_duration here and in the metrics instead.
+func (app *application) checkPool() componentStatus {
+	stats := app.db.Stats()
+
+	c := componentStatus{
+		Status: statusOK,
+		Details: envelope{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration":        stats.WaitDuration.String(),
+			"max_idle_closed":      stats.MaxIdleClosed,
+			"max_idle_time_closed": stats.MaxIdleTimeClosed,
+			"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		},
+	}
+
+	if stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+		c.Message = "all connections in the pool are in use"
+	}
+
+	return c
+}
+
+// checkMigrations makes sure the database schema is at the version that this
+// build of the API expects, according to the embedded migrations.
+func (app *application) checkMigrations(ctx context.Context) componentStatus {
+	expected, err := migrations.LatestVersion()
+	if err != nil {
+		return componentStatus{Status: statusDegraded, Message: err.Error()}
+	}
+
+	current, dirty, err := app.models.Schema.Version(ctx)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoMigrations):
+			return componentStatus{Status: statusDegraded, Message: "the database migrations have not been run"}
+		default:
+			return componentStatus{Status: statusDegraded, Message: err.Error()}
+		}
+	}
+
+	c := componentStatus{
+		Status:  statusOK,
+		Details: envelope{"current_version": current, "expected_version": expected, "dirty": dirty},
+	}
+
+	switch {
+	case dirty:
+		c.Status = statusDegraded
+		c.Message = fmt.Sprintf("migration %d failed and left the schema dirty", current)
+	case current != expected:
+		c.Status = statusDegraded
+		c.Message = fmt.Sprintf("schema is at version %d, expected %d", current, expected)
+	}
+
+	return c
+}
+
+func (app *application) checkWorkers() componentStatus {
+	statuses := app.workers.Statuses()
+
+	c := componentStatus{Status: statusOK, Details: statuses}
+
+	for _, s := range statuses {
+		if s.Status != statusOK {
+			c.Status = statusDegraded
+			c.Message = fmt.Sprintf("worker %s has stopped reporting in", s.Name)
+			break
+		}
+	}
+
+	return c
+}
@@ -5,17 +5,30 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
 )
 
 type envelope map[string]any
 
 // writing JSON out
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	// Convert data to json byte data
-	// js, err := json.Marshal(data)
-	js, err := json.MarshalIndent(data, "", "\t")
+	// Convert data to json byte data, indented or not as picked by jsonFormat
+	var js []byte
+	var err error
+	if prettyJSON(w) {
+		js, err = json.MarshalIndent(data, "", "\t")
+	} else {
+		js, err = json.Marshal(data)
+	}
 	if err != nil {
 		return err
 	}
@@ -23,20 +36,24 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	// add new line to make it prettier for terminal users
 	js = append(js, '\n')
 
+	// Setup header, before the extra headers so they can override it
+	w.Header().Set("Content-Type", "application/json")
+
 	// Add headers that we want to add to the response
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
-
-	// Setup header
-	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	w.Write(js)
 
 	return nil
 }
 
-func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) (err error) {
+	// decoding gets its own span, so slow uploads of the body show up in traces
+	_, span := tracer.Start(r.Context(), "readJSON")
+	defer func() { endSpan(span, err) }()
+
 	// Use http.MaxBytesReader() to limit the size of the request body to 1MB.
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
@@ -49,7 +66,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	dec.DisallowUnknownFields()
 
 	// Decode the request body into the target destination.
-	err := dec.Decode(dst)
+	err = dec.Decode(dst)
 	if err != nil {
 		// If there is an error during decoding, start the triage...
 		var syntaxError *json.SyntaxError
@@ -131,3 +148,175 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 
 	return nil
 }
+
+// readString returns a string value from the query string, or the provided default
+// value if no matching key could be found.
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+// readCSV reads a comma-separated string value from the query string and splits it
+// into a slice, or returns the provided default value if no matching key is found.
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	csv := qs.Get(key)
+	if csv == "" {
+		return defaultValue
+	}
+
+	return strings.Split(csv, ",")
+}
+
+// readInt reads a string value from the query string and converts it to an integer
+// before returning. If it can't be converted, the error is recorded in the
+// validator and the default value is returned instead.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, validator.CodeInvalidFormat, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// readBool works like readInt, but for true/false values. A nil pointer is
+// returned when the key is missing, so callers can tell "not set" apart from false.
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, validator.CodeInvalidFormat, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
+// readTime works like readBool, but for RFC 3339 times.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, validator.CodeInvalidFormat, "must be a RFC 3339 time")
+		return nil
+	}
+
+	return &t
+}
+
+// background runs fn in its own goroutine, recovering from any panic so that a
+// failing background task cannot bring the whole server down.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logError(nil, fmt.Errorf("%s", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// ndjsonFlushEvery is how many lines of NDJSON are written between flushes.
+const ndjsonFlushEvery = 100
+
+// writeList writes a listing of items under key, along with the page metadata if
+// there is any. Clients that ask for application/x-ndjson get the items as
+// newline delimited JSON instead, one per line, so they can be handled as they
+// arrive. The metadata is sent in headers then, as there is nowhere else for it.
+func (app *application) writeList(w http.ResponseWriter, r *http.Request, key string, items any, metadata *data.Metadata) error {
+	if !wantsNDJSON(r) {
+		env := envelope{key: items}
+		if metadata != nil {
+			env["metadata"] = metadata
+		}
+		return app.writeJSON(w, http.StatusOK, env, nil)
+	}
+
+	if metadata != nil {
+		for name, value := range map[string]int{
+			"X-Current-Page":  metadata.CurrentPage,
+			"X-Page-Size":     metadata.PageSize,
+			"X-Last-Page":     metadata.LastPage,
+			"X-Total-Records": metadata.TotalRecords,
+		} {
+			if value != 0 {
+				w.Header().Set(name, strconv.Itoa(value))
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+
+	list := reflect.ValueOf(items)
+	for i := 0; i < list.Len(); i++ {
+		// Encode puts a newline after each value. The headers are already gone if it
+		// fails, so all we can do is log and stop.
+		if err := enc.Encode(list.Index(i).Interface()); err != nil {
+			app.logError(r, err)
+			return nil
+		}
+
+		if (i+1)%ndjsonFlushEvery == 0 {
+			rc.Flush()
+		}
+	}
+
+	return nil
+}
+
+// wantsNDJSON reports whether the client prefers application/x-ndjson over
+// application/json in its Accept header.
+func wantsNDJSON(r *http.Request) bool {
+	ndjson, plain := 0.0, 0.0
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/x-ndjson":
+			ndjson = max(ndjson, q)
+		case "application/json":
+			plain = max(plain, q)
+		}
+	}
+
+	return ndjson > 0 && ndjson >= plain
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+const (
+	// longest Idempotency-Key accepted
+	maxIdempotencyKeyLength = 255
+
+	// responses larger than this aren't saved, so a request repeated after one is
+	// handled again
+	maxIdempotentResponseBytes = 1 << 20
+
+	// how much of a body the handler left unread is read to finish hashing it
+	maxIdempotentDrainBytes = 1 << 20
+
+	// how often keys past data.IdempotencyKeyTTL are deleted
+	idempotencySweepInterval = time.Hour
+)
+
+// idempotentReplayHeaders are the response headers saved along with the status
+// and body, and sent again when a request is repeated.
+var idempotentReplayHeaders = []string{"Content-Type", "Location", "ETag", "Content-Disposition"}
+
+// idempotent handles POST and PATCH requests which carry an Idempotency-Key at
+// most once. The response to the first request with a key is saved, and sent
+// back as it was, with Idempotent-Replayed set, for any request repeated with
+// the same key. A key can't be used again for a different request, or while its
+// first request is still being handled.
+//
+// Responses with a 5xx status aren't saved, since the request may not have been
+// handled at all, so repeating the request handles it again. Keys belong to the
+// workspace and member, and so have to come after workspaceScope.
+func (app *application) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Idempotency-Key")
+		if header == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(header) > maxIdempotencyKeyLength {
+			app.badRequestResponse(w, r, fmt.Errorf("Idempotency-Key must not be more than %d bytes long", maxIdempotencyKeyLength))
+			return
+		}
+
+		key := &data.IdempotencyKey{
+			Key:    header,
+			Method: r.Method,
+			Path:   r.URL.RequestURI(),
+		}
+		if member := memberFromContext(r.Context()); member != nil {
+			key.MemberID = member.ID
+		}
+
+		saved, err := app.models.IdempotencyKeys.Claim(r.Context(), key)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if saved != nil {
+			app.replayIdempotent(w, r, key, saved)
+			return
+		}
+
+		// the body is hashed as the handler reads it, so it isn't held in memory
+		h := sha256.New()
+		hashed := io.TeeReader(r.Body, h)
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{hashed, r.Body}
+
+		rec := &idempotentResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		// the key is still saved when the client has gone away, since that is when
+		// it will repeat the request
+		ctx := context.WithoutCancel(r.Context())
+
+		if rec.status == 0 || rec.status >= 500 || rec.overflow || !drained(hashed) {
+			if err := app.models.IdempotencyKeys.Release(ctx, key); err != nil {
+				app.logError(r, err)
+			}
+			return
+		}
+
+		key.RequestHash = h.Sum(nil)
+		key.Status = rec.status
+		key.Headers = rec.headers
+		key.Body = rec.body.Bytes()
+
+		if err := app.models.IdempotencyKeys.Complete(ctx, key); err != nil {
+			app.logError(r, err)
+		}
+	})
+}
+
+// replayIdempotent sends the saved response to the first request made with a key,
+// as long as r is the same request again.
+func (app *application) replayIdempotent(w http.ResponseWriter, r *http.Request, key, saved *data.IdempotencyKey) {
+	if saved.Status == 0 {
+		app.idempotencyKeyInUseResponse(w, r)
+		return
+	}
+
+	if saved.Method != key.Method || saved.Path != key.Path || !bodyHashMatches(r.Body, saved.RequestHash) {
+		app.idempotencyKeyReusedResponse(w, r)
+		return
+	}
+
+	for name, value := range saved.Headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+
+	w.WriteHeader(saved.Status)
+	w.Write(saved.Body)
+}
+
+// drained reads what the handler left of a body, so all of it is hashed, and
+// reports whether that came to an end.
+func drained(body io.Reader) bool {
+	n, err := io.Copy(io.Discard, io.LimitReader(body, maxIdempotentDrainBytes+1))
+	return err == nil && n <= maxIdempotentDrainBytes
+}
+
+// bodyHashMatches reports whether body has the SHA-256 hash want.
+func bodyHashMatches(body io.Reader, want []byte) bool {
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return false
+	}
+
+	return bytes.Equal(h.Sum(nil), want)
+}
+
+// idempotentResponseWriter passes a response through while keeping a copy of
+// it, to be saved against the request's Idempotency-Key.
+type idempotentResponseWriter struct {
+	http.ResponseWriter
+
+	status   int
+	headers  map[string]string
+	body     bytes.Buffer
+	overflow bool // the body was larger than maxIdempotentResponseBytes
+}
+
+func (rw *idempotentResponseWriter) WriteHeader(status int) {
+	// informational responses aren't the real status
+	if rw.status == 0 && status >= 200 {
+		rw.status = status
+		rw.headers = make(map[string]string)
+		for _, name := range idempotentReplayHeaders {
+			if value := rw.Header().Get(name); value != "" {
+				rw.headers[name] = value
+			}
+		}
+	}
+
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *idempotentResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	if !rw.overflow {
+		if rw.body.Len()+len(b) > maxIdempotentResponseBytes {
+			rw.overflow = true
+			rw.body = bytes.Buffer{}
+		} else {
+			rw.body.Write(b)
+		}
+	}
+
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *idempotentResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// runIdempotencySweeper deletes expired idempotency keys every
+// idempotencySweepInterval until ctx is done, beating wk after each sweep.
+func (app *application) runIdempotencySweeper(ctx context.Context, wk *worker) {
+	ticker := time.NewTicker(idempotencySweepInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := app.models.IdempotencyKeys.DeleteExpired(ctx)
+		if err != nil {
+			app.logError(nil, err)
+		}
+
+		wk.Beat(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
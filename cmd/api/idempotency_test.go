@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+func TestIdempotentRequests(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	app := &application{models: data.NewModels(db)}
+
+	calls := 0
+	handler := app.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.ReadAll(r.Body)
+
+		if strings.Contains(r.URL.Path, "fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/v1/notes/7")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"note":{"id":7}}`))
+	}))
+
+	body := `{"title":"Groceries"}`
+	hash := sha256.Sum256([]byte(body))
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Idempotency-Key", "key-1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	claimed := func(id int64) {
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+			WithArgs(data.DefaultWorkspaceID, int64(0), "key-1", http.MethodPost, sqlmock.AnyArg(),
+				data.IdempotencyKeyTTL.Seconds(), data.IdempotencyKeyLease.Seconds()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	}
+
+	saved := func(status driver.Value) {
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM idempotency_keys")).
+			WithArgs(data.DefaultWorkspaceID, int64(0), "key-1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "member_id", "key", "method", "path", "request_hash", "status", "headers", "body"}).
+				AddRow(1, 0, "key-1", http.MethodPost, "/v1/notes", hash[:], status,
+					[]byte(`{"Content-Type":"application/json","Location":"/v1/notes/7"}`), []byte(`{"note":{"id":7}}`)))
+	}
+
+	// the first request is handled and its response saved
+	claimed(1)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE idempotency_keys")).
+		WithArgs(int64(1), hash[:], http.StatusCreated, []byte(`{"Content-Type":"application/json","Location":"/v1/notes/7"}`), []byte(`{"note":{"id":7}}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if w := send("/v1/notes", body); w.Code != http.StatusCreated {
+		t.Errorf("first request got %d, want %d", w.Code, http.StatusCreated)
+	}
+
+	// repeating it sends the same response without handling it again
+	saved(http.StatusCreated)
+	w := send("/v1/notes", body)
+	if w.Code != http.StatusCreated || w.Body.String() != `{"note":{"id":7}}` {
+		t.Errorf("repeated request got %d %s, want the first response", w.Code, w.Body)
+	}
+	if w.Header().Get("Location") != "/v1/notes/7" || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("repeated request got headers %v", w.Header())
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+
+	// the key can't be used for another request
+	saved(http.StatusCreated)
+	if w := send("/v1/notes", `{"title":"Chores"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("different body got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// or while the first request with it is still being handled
+	saved(0)
+	if w := send("/v1/notes", body); w.Code != http.StatusConflict {
+		t.Errorf("in progress got %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// server errors give the key back, so the request can be tried again
+	claimed(2)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if w := send("/v1/fail", body); w.Code != http.StatusInternalServerError {
+		t.Errorf("failing request got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
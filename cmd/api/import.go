@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/importer"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// imports can be a lot larger than a single note, so they get their own limit
+const maxImportBytes = 64 << 20
+
+func (app *application) createImportHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	// anything over 8MB is spooled to disk by the multipart reader
+	err := r.ParseMultipartForm(8 << 20)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	// read every uploaded file into memory, since the request body is gone once
+	// this handler returns and the import carries on in the background
+	var files []importer.File
+	for _, headers := range r.MultipartForm.File {
+		for _, fh := range headers {
+			f, err := fh.Open()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			contents, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			files = append(files, importer.File{Name: fh.Filename, Data: contents})
+		}
+	}
+
+	if len(files) == 0 {
+		app.badRequestResponse(w, r, errors.New("at least one file must be uploaded"))
+		return
+	}
+
+	job, err := app.importJobs.New(data.WorkspaceID(r.Context()), len(files))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the import carries on after the response is sent, so it keeps the request's
+	// trace but not its cancellation
+	ctx := context.WithoutCancel(r.Context())
+
+	app.background(func() {
+		app.runImport(ctx, job, files)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", workspacePath(r, fmt.Sprintf("/v1/import/%s", job.ID)))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"job": job.Snapshot()}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runImport parses each file and inserts the notes found in it, recording every
+// failure in the job's report instead of stopping at the first one.
+func (app *application) runImport(ctx context.Context, job *importer.Job, files []importer.File) {
+	ctx, span := tracer.Start(ctx, "runImport", trace.WithAttributes(
+		attribute.String("import.job", job.ID),
+		attribute.Int("import.files", len(files)),
+	))
+	defer span.End()
+
+	job.Start()
+	defer job.Finish()
+
+	for _, file := range files {
+		entries, err := importer.Parse(file)
+		if err != nil {
+			job.Fail(importer.FileError{File: file.Name, Error: err.Error()}, 0)
+			continue
+		}
+
+		job.AddTotal(len(entries))
+
+		for _, entry := range entries {
+			v := validator.New()
+			if data.ValidateNote(v, entry.Note); !v.Valid() {
+				job.Fail(importer.FileError{File: entry.Source, Errors: v.Errors}, 1)
+				continue
+			}
+
+			err := app.models.Notes.Import(ctx, entry.Note)
+			if err != nil {
+				app.logError(nil, err)
+				job.Fail(importer.FileError{File: entry.Source, Error: "the note could not be saved"}, 1)
+				continue
+			}
+
+			app.noteCreated(entry.Note)
+			job.Succeeded(entry.Note.ID)
+		}
+	}
+}
+
+func (app *application) showImportHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	// jobs are only shown to the workspace the notes are being imported into
+	job, ok := app.importJobs.Get(params.ByName("job"))
+	if !ok || job.WorkspaceID != data.WorkspaceID(r.Context()) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"job": job.Snapshot()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+func (app *application) listItemsHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Notes.Get(r.Context(), noteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	items, err := app.models.Items.GetAllForNote(r.Context(), noteID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeList(w, r, "items", items, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createItemHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Text    string     `json:"text"`             // text of the item
+		Checked bool       `json:"checked"`          // whether the item has been done
+		DueAt   *time.Time `json:"due_at,omitempty"` // when the item is due
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	item := &data.Item{
+		NoteID:  noteID,
+		Text:    input.Text,
+		Checked: input.Checked,
+		DueAt:   input.DueAt,
+	}
+
+	v := validator.New()
+	if data.ValidateItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// the item is added to the end of the checklist, and the note's version bumped
+	err = app.models.Items.Insert(r.Context(), item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", workspacePath(r, fmt.Sprintf("/v1/notes/%d/items/%d", noteID, item.ID)))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"item": item}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateItemHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "item_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	item, err := app.models.Items.Get(r.Context(), noteID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Text    *string      `json:"text"`
+		Checked *bool        `json:"checked"`
+		DueAt   nullableTime `json:"due_at"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Text != nil {
+		item.Text = *input.Text
+	}
+
+	if input.Checked != nil {
+		item.Checked = *input.Checked
+	}
+
+	// due_at can be cleared by sending null
+	if input.DueAt.Set {
+		item.DueAt = input.DueAt.Value
+	}
+
+	v := validator.New()
+	if data.ValidateItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Items.Update(r.Context(), item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) toggleItemHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "item_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	item, err := app.models.Items.Toggle(r.Context(), noteID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) reorderItemsHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		ItemIDs []int64 `json:"item_ids"` // every item of the note, in the new order
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.ItemIDs != nil, "item_ids", validator.CodeRequired, "must be provided")
+	v.Check(validator.Unique(input.ItemIDs), "item_ids", validator.CodeDuplicate, "must not contain duplicate values")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Items.Reorder(r.Context(), noteID, input.ItemIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrInvalidOrder):
+			v.AddError("item_ids", validator.CodeInvalid, "must contain every item of the note exactly once")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	items, err := app.models.Items.GetAllForNote(r.Context(), noteID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"items": items}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteItemHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "item_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Items.Delete(r.Context(), noteID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "item successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", "open")
+	v.Check(validator.PermittedValue(input.Status, "open", "done", "all"), "status", validator.CodeNotPermitted, "must be open, done or all")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "due_at")
+	input.Filters.SortSafelist = []string{"due_at", "created_at", "-due_at", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	var done *bool
+	switch input.Status {
+	case "open":
+		done = new(bool)
+	case "done":
+		done = new(bool)
+		*done = true
+	}
+
+	tasks, metadata, err := app.models.Items.GetTasks(r.Context(), done, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeList(w, r, "tasks", tasks, &metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+// batchLoader collects the keys asked for while a level of a GraphQL query is
+// being resolved, and fetches them all with one call once the first result is
+// needed. This keeps nested fields, like the backlinks of every note in a
+// listing, down to one query per field instead of one per note.
+type batchLoader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	results map[K]V
+	errs    map[K]error
+}
+
+func newBatchLoader[K comparable, V any](fetch func(context.Context, []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{
+		fetch:   fetch,
+		results: make(map[K]V),
+		errs:    make(map[K]error),
+	}
+}
+
+// Load queues key to be fetched, returning a thunk which gives its value. The
+// GraphQL executor only calls thunks once it has resolved every field at the same
+// depth, so by then the whole batch is queued.
+func (l *batchLoader[K, V]) Load(ctx context.Context, key K) func() (V, error) {
+	l.mu.Lock()
+	_, done := l.results[key]
+	if !done && !slices.Contains(l.pending, key) {
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			keys := l.pending
+			l.pending = nil
+
+			values, err := l.fetch(ctx, keys)
+			for _, k := range keys {
+				if err != nil {
+					l.errs[k] = err
+					continue
+				}
+				l.results[k] = values[k]
+			}
+		}
+
+		return l.results[key], l.errs[key]
+	}
+}
+
+// loaders are the batch loaders for a single GraphQL request. Results are cached
+// for the length of the request, so they are never shared between requests.
+type loaders struct {
+	notes     *batchLoader[int64, *data.Note]
+	backlinks *batchLoader[int64, []*data.Note]
+	items     *batchLoader[int64, []*data.Item]
+}
+
+func (app *application) newLoaders() *loaders {
+	return &loaders{
+		notes:     newBatchLoader(app.models.Notes.GetMany),
+		backlinks: newBatchLoader(app.models.Links.GetBacklinkNotes),
+		items:     newBatchLoader(app.models.Items.GetAllForNotes),
+	}
+}
+
+const loadersContextKey = contextKey("loaders")
+
+func loadersFromContext(ctx context.Context) *loaders {
+	return ctx.Value(loadersContextKey).(*loaders)
+}
@@ -3,15 +3,18 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/KevuTheDev/notes-backend-api/internal/data"
-	"github.com/joho/godotenv"
+	"github.com/KevuTheDev/notes-backend-api/internal/importer"
+	"github.com/KevuTheDev/notes-backend-api/internal/notify"
+	"github.com/KevuTheDev/notes-backend-api/internal/storage"
 	_ "github.com/lib/pq"
 )
 
@@ -27,32 +30,103 @@ type config struct {
 		maxIdleConns int
 		maxIdleTime  string
 	}
+	storage struct {
+		backend            string
+		dir                string
+		maxAttachmentBytes int64
+		s3                 storage.S3Config
+	}
+	reminders struct {
+		enabled   bool
+		interval  time.Duration
+		batchSize int
+	}
+	webhook struct {
+		url    string
+		secret string
+	}
+	tls struct {
+		certFile       string
+		keyFile        string
+		reloadInterval time.Duration
+		redirectPort   int
+	}
+	grpc struct {
+		port int
+	}
+	openAPI struct {
+		validate bool
+	}
+	tracing struct {
+		exporter     string
+		file         string
+		otlpEndpoint string
+		otlpInsecure bool
+		sampleRatio  float64
+	}
+	cors struct {
+		trustedOrigins []string
+	}
+	cursors struct {
+		secret string
+	}
+	metrics struct {
+		enabled  bool
+		username string
+		password string
+	}
+	audit struct {
+		username string
+		password string
+	}
+	smtp struct {
+		host      string
+		port      int
+		username  string
+		password  string
+		sender    string
+		recipient string
+	}
+	invitations struct {
+		ttl time.Duration
+	}
 }
 
 type application struct {
-	config config
-	models data.Models
+	config     config
+	db         *sql.DB
+	models     data.Models
+	metrics    *appMetrics
+	importJobs *importer.Jobs
+	blobs      storage.BlobStore
+	events     *notify.Bus
+	changes    *notify.Changes
+	sinks      []notify.Sink
+	mailer     *notify.SMTP
+	workers    *workerRegistry
+	cursorKey  []byte
+	wg         sync.WaitGroup
 }
 
 func main() {
-	var cfg config
-
-	// load .env file
-	loadDotEnvFile()
-
-	// Possible command line flags to be called
-	flag.IntVar(&cfg.port, "addr", 4000, "Server address")
-	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
-
-	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("NOTEBOOK_DB_DSN"), "PostgreSQL DSN")
+	// "api config print" shows the settings the server would run with
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		os.Exit(printConfig(os.Args[3:]))
+	}
 
-	// Read the connection pool settings from command-line flags into the config struct.
-	// Notice the default values that we're using?
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	// "api admin" runs maintenance tasks against the database, see admin.go
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		os.Exit(runAdmin(os.Args[2:]))
+	}
 
-	flag.Parse()
+	cfg, _, err := loadConfig(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
 	// Setup Database connection
 	db, err := openDB(cfg)
@@ -65,29 +139,57 @@ func main() {
 
 	fmt.Println("database connection pool established")
 
-	app := &application{
-		config: cfg,
-		models: data.NewModels(db),
+	shutdownTracing, err := setupTracing(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	blobs, err := openBlobStore(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.config.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+	app := &application{
+		config:     cfg,
+		db:         db,
+		models:     data.NewModels(db),
+		metrics:    newAppMetrics(db),
+		importJobs: importer.NewJobs(24 * time.Hour),
+		blobs:      blobs,
+		events:     notify.NewBus(),
+		changes:    notify.NewChanges(),
+		workers:    newWorkerRegistry(),
+		cursorKey:  newCursorKey(cfg),
 	}
 
-	fmt.Printf("Launching %s server on port %d...\n", app.config.env, app.config.port)
-	err = srv.ListenAndServe()
-	fmt.Println(err)
-}
+	app.mailer = app.newMailer()
+	app.sinks = app.newSinks()
+	app.publishExpvars()
 
-func loadDotEnvFile() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+	if cfg.reminders.enabled {
+		// a single delivery can take up to deliveryTimeout, which mustn't count as
+		// missing beats when the interval is shorter than that
+		wk := app.workers.Register("reminder-scheduler", max(cfg.reminders.interval, deliveryTimeout))
+		app.background(func() {
+			app.runReminderScheduler(context.Background(), wk)
+		})
 	}
+
+	wk := app.workers.Register("idempotency-key-sweeper", idempotencySweepInterval)
+	app.background(func() {
+		app.runIdempotencySweeper(context.Background(), wk)
+	})
+
+	err = app.serve()
+	fmt.Println(err)
 }
 
 func openDB(cfg config) (*sql.DB, error) {
@@ -131,3 +233,50 @@ func openDB(cfg config) (*sql.DB, error) {
 	// Return the sql.DB connection pool.
 	return db, nil
 }
+
+// openBlobStore sets up the BlobStore selected by the -storage flag.
+func openBlobStore(cfg config) (storage.BlobStore, error) {
+	switch cfg.storage.backend {
+	case "local":
+		return storage.NewLocalStore(cfg.storage.dir)
+	case "s3":
+		return storage.NewS3Store(cfg.storage.s3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
+
+// newSinks puts together the sinks that fired reminders are sent to, based on
+// which of them have been configured. The event bus isn't one of them, as there
+// is no point queueing a delivery for whoever happens to be listening: fired
+// reminders are published to it straight away instead.
+func (app *application) newSinks() []notify.Sink {
+	var sinks []notify.Sink
+
+	if app.config.webhook.url != "" {
+		sinks = append(sinks, notify.Sink{Name: "webhook", Notifier: notify.NewWebhook(app.config.webhook.url, app.config.webhook.secret)})
+	}
+
+	if app.mailer != nil && app.config.smtp.recipient != "" {
+		sinks = append(sinks, notify.Sink{Name: "email", Notifier: app.mailer})
+	}
+
+	return sinks
+}
+
+// newMailer returns the SMTP server that reminders and invitations are emailed
+// through, or nil if there isn't one.
+func (app *application) newMailer() *notify.SMTP {
+	if app.config.smtp.host == "" {
+		return nil
+	}
+
+	return &notify.SMTP{
+		Host:      app.config.smtp.host,
+		Port:      app.config.smtp.port,
+		Username:  app.config.smtp.username,
+		Password:  app.config.smtp.password,
+		Sender:    app.config.smtp.sender,
+		Recipient: app.config.smtp.recipient,
+	}
+}
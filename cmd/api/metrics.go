@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"expvar"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/metrics"
+	"github.com/julienschmidt/httprouter"
+)
+
+// appMetrics are the metrics collected by the API, served at /debug/metrics.
+type appMetrics struct {
+	registry *metrics.Registry
+
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	inFlight *metrics.Gauge
+
+	notesCreated  *metrics.Counter
+	notesUpdated  *metrics.Counter
+	notesDeleted  *metrics.Counter
+	editConflicts *metrics.Counter
+}
+
+func newAppMetrics(db *sql.DB) *appMetrics {
+	reg := metrics.NewRegistry()
+
+	m := &appMetrics{
+		registry: reg,
+		requests: reg.NewCounterVec("http_requests_total", "Total HTTP requests by route and status code.", "method", "route", "status"),
+		duration: reg.NewHistogramVec("http_request_duration_seconds", "HTTP request latencies by route and status code.", metrics.DefaultBuckets, "method", "route", "status"),
+		inFlight: reg.NewGauge("http_requests_in_flight", "HTTP requests currently being served."),
+
+		notesCreated:  reg.NewCounter("notes_created_total", "Notes created, including imported notes."),
+		notesUpdated:  reg.NewCounter("notes_updated_total", "Notes updated."),
+		notesDeleted:  reg.NewCounter("notes_deleted_total", "Notes deleted."),
+		editConflicts: reg.NewCounter("edit_conflicts_total", "Updates rejected because of an edit conflict."),
+	}
+
+	// the pool keeps its own stats, so they are read from it when scraped
+	stat := func(fn func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(db.Stats()) }
+	}
+
+	reg.NewGaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.", stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.NewGaugeFunc("db_open_connections", "Established connections, both in use and idle.", stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.NewGaugeFunc("db_in_use_connections", "Connections currently in use.", stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.NewGaugeFunc("db_idle_connections", "Idle connections.", stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.NewCounterFunc("db_wait_count_total", "Connections waited for.", stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.NewCounterFunc("db_wait_duration_seconds_total", "Time spent waiting for a connection.", stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	reg.NewCounterFunc("db_max_idle_closed_total", "Connections closed due to the idle connection limit.", stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	reg.NewCounterFunc("db_max_idle_time_closed_total", "Connections closed due to the idle time limit.", stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+
+	reg.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 { return float64(runtime.NumGoroutine()) })
+
+	return m
+}
+
+// publishExpvars adds the application's variables to the ones served at
+// /debug/vars. It must only be called once.
+func (app *application) publishExpvars() {
+	expvar.NewString("version").Set(version)
+
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+
+	expvar.Publish("database", expvar.Func(func() any {
+		return app.db.Stats()
+	}))
+
+	expvar.Publish("timestamp", expvar.Func(func() any {
+		return time.Now().Unix()
+	}))
+
+	expvar.Publish("metrics", expvar.Func(func() any {
+		return app.metrics.registry.Snapshot()
+	}))
+}
+
+type contextKey string
+
+// routeContextKey holds a pointer to the route pattern matched for a request, which
+// is filled in once the router has picked a handler.
+const routeContextKey = contextKey("route")
+
+// instrumentedRouter registers handlers the same way as httprouter, but wraps each
+// of them so that the pattern it was registered under is known to recordMetrics.
+// Labelling requests with the pattern rather than the path keeps ids out of the
+// metric labels. The methods that routes are registered for are kept as well, for
+// the CORS preflight responses.
+type instrumentedRouter struct {
+	*httprouter.Router
+	methods map[string]bool
+}
+
+func newInstrumentedRouter() instrumentedRouter {
+	return instrumentedRouter{Router: httprouter.New(), methods: make(map[string]bool)}
+}
+
+func (router instrumentedRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	router.methods[method] = true
+	router.Router.HandlerFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeContextKey).(*string); ok {
+			*route = path
+		}
+		handler(w, r)
+	})
+}
+
+func (router instrumentedRouter) Handler(method, path string, handler http.Handler) {
+	router.HandlerFunc(method, path, handler.ServeHTTP)
+}
+
+// allowedMethods lists every method a route has been registered for, along with
+// OPTIONS, in the form of an Access-Control-Allow-Methods header.
+func (router instrumentedRouter) allowedMethods() string {
+	methods := []string{http.MethodOptions}
+	for method := range router.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	return strings.Join(methods, ", ")
+}
+
+// metricsResponseWriter records the status code written by a handler.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+}
+
+func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
+	if !mw.headerWritten {
+		mw.statusCode = statusCode
+		mw.headerWritten = true
+	}
+	mw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
+	mw.headerWritten = true
+	return mw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController get at the underlying writer.
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// recordMetrics counts every request along with its latency, by the route pattern
+// it matched and the status code of the response. Requests which didn't match a
+// route are labelled "unmatched", and unknown methods "OTHER".
+func (app *application) recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		app.metrics.inFlight.Inc()
+		defer app.metrics.inFlight.Dec()
+
+		route := "unmatched"
+		r = r.WithContext(context.WithValue(r.Context(), routeContextKey, &route))
+
+		mw := &metricsResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next.ServeHTTP(mw, r)
+
+		status := strconv.Itoa(mw.statusCode)
+		method := metricMethod(r.Method)
+		app.metrics.requests.Inc(method, route, status)
+		app.metrics.duration.Observe(time.Since(start).Seconds(), method, route, status)
+	})
+}
+
+// metricMethod returns the method to label a request's metrics with. Clients can
+// send any method they like, so anything but the standard ones is counted as
+// "OTHER" to keep the number of series bounded.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// requireMetricsAuth protects the debug endpoints with basic auth, when a password
+// has been set for them.
+func (app *application) requireMetricsAuth(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.config.metrics.password == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if !ok || !secureCompare(username, app.config.metrics.username) || !secureCompare(password, app.config.metrics.password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics", charset="UTF-8"`)
+			app.errorResponse(w, r, http.StatusUnauthorized, codeUnauthorized, "invalid or missing credentials for the metrics endpoints")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// secureCompare compares two strings in constant time. They are hashed first so
+// the length of the secret isn't leaked either.
+func secureCompare(given, expected string) bool {
+	a := sha256.Sum256([]byte(given))
+	b := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	err := app.metrics.registry.WritePrometheus(w)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
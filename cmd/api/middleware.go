@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// requestIDContextKey holds the id of the current request.
+const requestIDContextKey = contextKey("request_id")
+
+// requestIDRX matches the ids we accept from clients, which have to be UUIDs since
+// they are used in URNs.
+var requestIDRX = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// requestID gives every request an id, sent back in the X-Request-Id header and
+// used as the instance of problem details. A client can pick the id by sending
+// the header itself, as long as it is a UUID.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !requestIDRX.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-Id", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDFromContext returns the id of the request, or "" outside of a request.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// CORS settings sent to trusted origins. Preflight responses are cached by the
+// browser for corsMaxAge seconds. The allowed methods are whichever ones routes
+// are registered for, which routes passes to enableCORS.
+const (
+	corsAllowedHeaders = "Authorization, Content-Type, If-Match, If-None-Match, Idempotency-Key, X-Link-Password, X-Request-Id, X-Workspace"
+	corsExposedHeaders = "ETag, Location, Content-Disposition, X-Request-Id, Link, X-Current-Page, X-Page-Size, X-Last-Page, X-Total-Records, Idempotent-Replayed"
+	corsMaxAge         = "600"
+)
+
+// enableCORS lets browsers on the trusted origins call the API, with credentials.
+// Requests from any other origin get no CORS headers, so the browser blocks them.
+// Preflight requests are answered here rather than reaching the router.
+func (app *application) enableCORS(allowedMethods string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the response depends on these request headers, so caches must not share
+		// it between origins
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		if origin != "" && slices.Contains(app.config.cors.trustedOrigins, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+
+			// a preflight is an OPTIONS request with Access-Control-Request-Method set
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jsonFormatWriter carries the choice made by jsonFormat through to writeJSON.
+type jsonFormatWriter struct {
+	http.ResponseWriter
+	pretty bool
+}
+
+// Unwrap lets http.ResponseController get at the underlying writer.
+func (jw *jsonFormatWriter) Unwrap() http.ResponseWriter {
+	return jw.ResponseWriter
+}
+
+// jsonFormat picks between indented and compact JSON for the response. It's
+// compact in production, where nobody is reading it by eye, and indented
+// everywhere else. Clients can choose for themselves with ?pretty=true or false.
+func (app *application) jsonFormat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pretty := app.config.env != "production"
+		if p, err := strconv.ParseBool(r.URL.Query().Get("pretty")); err == nil {
+			pretty = p
+		}
+
+		next.ServeHTTP(&jsonFormatWriter{ResponseWriter: w, pretty: pretty}, r)
+	})
+}
+
+// prettyJSON looks through the writers wrapping w for the choice made by
+// jsonFormat, defaulting to indented JSON.
+func prettyJSON(w http.ResponseWriter) bool {
+	for {
+		switch rw := w.(type) {
+		case *jsonFormatWriter:
+			return rw.pretty
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return true
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCORSPreflightAllowsRegisteredMethods(t *testing.T) {
+	app := &application{}
+	app.config.cors.trustedOrigins = []string{"https://notes.example.com"}
+
+	r := httptest.NewRequest(http.MethodOptions, "/v1/notes/1/items/order", nil)
+	r.Header.Set("Origin", "https://notes.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	w := httptest.NewRecorder()
+
+	app.routes().ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	allowed := strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", ")
+	for _, method := range []string{http.MethodDelete, http.MethodGet, http.MethodOptions, http.MethodPatch, http.MethodPost, http.MethodPut} {
+		if !slices.Contains(allowed, method) {
+			t.Errorf("%s is missing from the allowed methods %v", method, allowed)
+		}
+	}
+}
@@ -1,21 +1,36 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/notify"
 	"github.com/KevuTheDev/notes-backend-api/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
 
 func (app *application) createNoteHandler(w http.ResponseWriter, r *http.Request) {
+	// ?template=:id creates the note from a template instead of the body
+	if r.URL.Query().Has("template") {
+		app.createNoteFromTemplateHandler(w, r)
+		return
+	}
+
 	var input struct {
-		Title   string   `json:"title"`             // title of note
-		Content string   `json:"content,omitempty"` // content of note
-		Tags    []string `json:"tags,omitempty"`    // tags of note
+		Title      string     `json:"title"`                // title of note
+		Content    string     `json:"content,omitempty"`    // content of note
+		Tags       []string   `json:"tags,omitempty"`       // tags of note
+		Pinned     bool       `json:"pinned,omitempty"`     // pin the note to the top of listings
+		Archived   bool       `json:"archived,omitempty"`   // hide the note from listings
+		Color      string     `json:"color,omitempty"`      // background color of the note
+		RemindAt   *time.Time `json:"remind_at,omitempty"`  // when to send a reminder for the note
+		Recurrence string     `json:"recurrence,omitempty"` // RRULE describing how the reminder repeats
 	}
 
 	// Decode the given body from the response, and store the value in ^input
@@ -27,28 +42,36 @@ func (app *application) createNoteHandler(w http.ResponseWriter, r *http.Request
 
 	// copy the values from the input struct to a new Note struct
 	note := &data.Note{
-		Title:   input.Title,
-		Content: input.Content,
-		Tags:    input.Tags,
+		Title:      input.Title,
+		Content:    input.Content,
+		Tags:       input.Tags,
+		Pinned:     input.Pinned,
+		Archived:   input.Archived,
+		Color:      input.Color,
+		RemindAt:   input.RemindAt,
+		Recurrence: input.Recurrence,
 	}
 
 	// Initialize a new Validator
 	v := validator.New()
 	// Perform validation check on data sent from client
 	if data.ValidateNote(v, note); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
 	// validation check passed, performing insert
-	err = app.models.Notes.Insert(note)
+	err = app.models.Notes.Insert(r.Context(), note)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
+	app.noteCreated(note)
+
 	// setup a location header of where the resource will be located at
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/notes/%d", note.ID))
+	headers.Set("Location", workspacePath(r, fmt.Sprintf("/v1/notes/%d", note.ID)))
 
 	// send a response back to the client with the new note
 	err = app.writeJSON(w, http.StatusCreated, envelope{"note": note}, headers)
@@ -57,13 +80,91 @@ func (app *application) createNoteHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// noteSortSafelist are the sorts notes can be listed in.
+var noteSortSafelist = []string{
+	"id", "title", "created_at", "last_updated_at",
+	"-id", "-title", "-created_at", "-last_updated_at",
+}
+
+func (app *application) listNotesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.NoteQuery
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Search = app.readString(qs, "q", "")
+	input.Tags = app.readCSV(qs, "tags", []string{})
+
+	// archived notes are hidden unless they are asked for with ?archived=true
+	if archived := app.readBool(qs, "archived", v); archived != nil {
+		input.Archived = *archived
+	}
+
+	input.Pinned = app.readBool(qs, "pinned", v)
+
+	// pinned notes come first unless ?pinned_first=false
+	input.PinnedFirst = true
+	if pinnedFirst := app.readBool(qs, "pinned_first", v); pinnedFirst != nil {
+		input.PinnedFirst = *pinnedFirst
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Cursor = app.readCursor(qs, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-last_updated_at")
+	input.Filters.SortSafelist = noteSortSafelist
+
+	// a cursor carries the sort it was made for, so the rest of the listing can't
+	// change under it
+	if cursor := input.Filters.Cursor; cursor != nil {
+		v.Check(qs.Get("page") == "", "page", validator.CodeInvalid, "must not be used with a cursor")
+		v.Check(cursor.Sort == input.Filters.Sort && (cursor.Pinned != nil) == input.PinnedFirst,
+			"cursor", validator.CodeInvalid, "was made for a different sort or pinned_first")
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	notes, metadata, err := app.models.Notes.GetAll(r.Context(), input.NoteQuery, input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			v.AddError("cursor", validator.CodeInvalid, "is not a valid cursor")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.setPageLinks(w, r, &metadata)
+
+	err = app.writeList(w, r, "notes", notes, &metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) readIDParams(r *http.Request) (int64, error) {
+	// obtain the id portion of the router
+	return app.readNamedIDParam(r, "id")
+}
+
+// reads a positive integer id from a named portion of the router, such as the
+// :attachment_id in /v1/notes/:id/attachments/:attachment_id
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	// obtain the id portion of the router
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -78,7 +179,7 @@ func (app *application) showNoteHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// get note based on id (extracted from URI)
-	note, err := app.models.Notes.Get(id)
+	note, err := app.models.Notes.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		// no record found of specified id
@@ -109,7 +210,7 @@ func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request
 	// get note specified by id
 	// get note to see if the note exists in the database
 	// if exists, proceed to use this data and then update it provided by client
-	note, err := app.models.Notes.Get(id)
+	note, err := app.models.Notes.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		// no record found of specified id
@@ -123,9 +224,15 @@ func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	var input struct {
-		Title   *string  `json:"title"`
-		Content *string  `json:"content"`
-		Tags    []string `json:"tags"`
+		Title      *string      `json:"title"`
+		Content    *string      `json:"content"`
+		Tags       []string     `json:"tags"`
+		Pinned     *bool        `json:"pinned"`
+		Archived   *bool        `json:"archived"`
+		Color      *string      `json:"color"`
+		RemindAt   nullableTime `json:"remind_at"`
+		Recurrence *string      `json:"recurrence"`
+		Version    *int32       `json:"version"` // version the changes were made against
 	}
 
 	// Decode the given body from the response, and store the value in ^input
@@ -135,6 +242,25 @@ func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// the client's copy is out of date, so its changes would overwrite someone else's
+	if input.Version != nil && *input.Version != note.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	// ?rewrite_links=true updates [[title]] references in other notes when the
+	// title of this note changes
+	rewriteLinks := false
+	if value := r.URL.Query().Get("rewrite_links"); value != "" {
+		rewriteLinks, err = strconv.ParseBool(value)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("rewrite_links must be a boolean value"))
+			return
+		}
+	}
+
+	oldTitle := note.Title
+
 	if input.Title != nil {
 		note.Title = *input.Title
 	}
@@ -147,16 +273,42 @@ func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request
 		note.Tags = input.Tags
 	}
 
+	if input.Pinned != nil {
+		note.Pinned = *input.Pinned
+	}
+
+	if input.Archived != nil {
+		note.Archived = *input.Archived
+	}
+
+	if input.Color != nil {
+		note.Color = *input.Color
+	}
+
+	// remind_at can be cleared by sending null
+	if input.RemindAt.Set {
+		note.RemindAt = input.RemindAt.Value
+	}
+
+	if input.Recurrence != nil {
+		note.Recurrence = *input.Recurrence
+	}
+
 	// Initialize a new Validator
 	v := validator.New()
 	// Perform validation check on data sent from client
 	if data.ValidateNote(v, note); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
 	// Perform an update on the given data
-	err = app.models.Notes.Update(note)
+	var rewritten []int64
+	if rewriteLinks {
+		rewritten, err = app.models.Notes.UpdateAndRewriteLinks(r.Context(), note, oldTitle)
+	} else {
+		err = app.models.Notes.Update(r.Context(), note)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -167,8 +319,15 @@ func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.noteUpdated(note)
+
 	// when successful, create a request to user with the new note data
-	err = app.writeJSON(w, http.StatusOK, envelope{"note": note}, nil)
+	env := envelope{"note": note}
+	if rewriteLinks {
+		env["rewritten_notes"] = rewritten
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -183,7 +342,7 @@ func (app *application) deleteNoteHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// Perform a delete on record based on id
-	err = app.models.Notes.Delete(id)
+	err = app.deleteNote(r.Context(), id)
 	if err != nil {
 		switch {
 		// no record found of specified id
@@ -202,3 +361,53 @@ func (app *application) deleteNoteHandler(w http.ResponseWriter, r *http.Request
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// deleteNote deletes a note along with the blobs of its attachments.
+func (app *application) deleteNote(ctx context.Context, id int64) error {
+	keys, err := app.models.Notes.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	app.noteDeleted(ctx, id)
+	app.deleteBlobs(keys...)
+
+	return nil
+}
+
+// noteCreated, noteUpdated and noteDeleted count a change to a note and publish
+// it to anyone watching for changes, such as the gRPC WatchNotes stream. Deleted
+// notes are gone by the time they're published, so the workspace they were in is
+// taken from ctx.
+func (app *application) noteCreated(note *data.Note) {
+	app.metrics.notesCreated.Inc()
+	app.changes.Publish(notify.NoteChange{Type: notify.NoteCreated, NoteID: note.ID, WorkspaceID: note.WorkspaceID, Note: note})
+}
+
+func (app *application) noteUpdated(note *data.Note) {
+	app.metrics.notesUpdated.Inc()
+	app.changes.Publish(notify.NoteChange{Type: notify.NoteUpdated, NoteID: note.ID, WorkspaceID: note.WorkspaceID, Note: note})
+}
+
+func (app *application) noteDeleted(ctx context.Context, id int64) {
+	app.metrics.notesDeleted.Inc()
+	app.changes.Publish(notify.NoteChange{Type: notify.NoteDeleted, NoteID: id, WorkspaceID: data.WorkspaceID(ctx)})
+}
+
+// nullableTime is used for optional fields in PATCH requests that can be cleared.
+// Set tells apart a field which was left out of the JSON from one sent as null.
+type nullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (t *nullableTime) UnmarshalJSON(b []byte) error {
+	t.Set = true
+
+	if string(b) == "null" {
+		t.Value = nil
+		return nil
+	}
+
+	return json.Unmarshal(b, &t.Value)
+}
@@ -0,0 +1,915 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/importer"
+	"github.com/KevuTheDev/notes-backend-api/internal/openapi"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+//go:embed docs.html
+var docsHTML []byte
+
+// route is an operation of the API along with where it is served. Paths use the
+// httprouter syntax, as in routes().
+type route struct {
+	method string
+	path   string
+	op     *openapi.Operation
+}
+
+// openAPIDocument describes every route registered in routes(). The schemas of
+// the models are generated from their Go types, while the envelopes, inputs and
+// parameters are spelled out here, and have to be kept in step with the
+// handlers. Running in development with -openapi-validate catches them
+// drifting apart.
+func (app *application) openAPIDocument() *openapi.Document {
+	description := "Every response has an X-Request-Id header. Errors are sent as problem details (RFC 9457) to clients which accept application/problem+json. " +
+		"The notes, tasks, reminders, graph, graphql, import and templates paths work on the default workspace, or on another picked by putting /v1/workspaces/{ws} in place of /v1 " +
+		"or with the X-Workspace header, along with the token of a member as \"Authorization: Bearer TOKEN\"."
+
+	doc := openapi.New(openapi.Info{
+		Title:       "Notes API",
+		Version:     version,
+		Description: description,
+	})
+
+	gen := openapi.NewGenerator(doc)
+
+	// models
+	note := gen.SchemaFor(data.Note{})
+	item := gen.SchemaFor(data.Item{})
+	task := gen.SchemaFor(data.Task{})
+	template := gen.SchemaFor(data.Template{})
+	reminder := gen.SchemaFor(data.Reminder{})
+	auditEvent := gen.SchemaFor(data.AuditEvent{})
+	workspace := gen.SchemaFor(data.Workspace{})
+	member := gen.SchemaFor(data.Member{})
+	invitation := gen.SchemaFor(data.Invitation{})
+	publicLink := gen.SchemaFor(data.PublicLink{})
+	attachment := gen.SchemaFor(data.Attachment{})
+	link := gen.SchemaFor(data.Link{})
+	linkedNote := gen.SchemaFor(data.LinkedNote{})
+	edge := gen.SchemaFor(data.Edge{})
+	job := gen.SchemaFor(importer.Job{})
+	metadata := gen.SchemaFor(data.Metadata{})
+	component := gen.SchemaFor(componentStatus{})
+	fieldError := gen.SchemaFor(validator.FieldError{})
+
+	app.addErrorComponents(doc, fieldError)
+
+	// inputs, matching the structs the handlers decode into
+	noteFields := map[string]*openapi.Schema{
+		"title":      openapi.String(),
+		"content":    openapi.String(),
+		"tags":       openapi.ArrayOf(openapi.String()),
+		"pinned":     openapi.Boolean(),
+		"archived":   openapi.Boolean(),
+		"color":      openapi.String(),
+		"remind_at":  openapi.DateTime(),
+		"recurrence": openapi.String(),
+	}
+	doc.Components.Schemas["CreateNoteInput"] = optional(openapi.Object(noteFields), "content", "tags", "pinned", "archived", "color", "remind_at", "recurrence")
+	updateNoteFields := withNullable(noteFields, "remind_at")
+	updateNoteFields["version"] = &openapi.Schema{Type: openapi.Types{"integer"}, Description: "Fail with an edit conflict unless the note is still at this version"}
+	doc.Components.Schemas["UpdateNoteInput"] = optional(openapi.Object(updateNoteFields))
+	doc.Components.Schemas["CreateNoteFromTemplateInput"] = optional(openapi.Object(map[string]*openapi.Schema{
+		"values": openapi.MapOf(openapi.String()),
+		"tags":   openapi.ArrayOf(openapi.String()),
+	}))
+
+	itemFields := map[string]*openapi.Schema{
+		"text":    openapi.String(),
+		"checked": openapi.Boolean(),
+		"due_at":  openapi.DateTime(),
+	}
+	doc.Components.Schemas["CreateItemInput"] = optional(openapi.Object(itemFields), "checked", "due_at")
+	doc.Components.Schemas["UpdateItemInput"] = optional(openapi.Object(withNullable(itemFields, "due_at")))
+
+	templateFields := map[string]*openapi.Schema{
+		"name":    openapi.String(),
+		"title":   openapi.String(),
+		"content": openapi.String(),
+		"tags":    openapi.ArrayOf(openapi.String()),
+	}
+	doc.Components.Schemas["CreateTemplateInput"] = optional(openapi.Object(templateFields), "content", "tags")
+	doc.Components.Schemas["UpdateTemplateInput"] = optional(openapi.Object(templateFields))
+
+	doc.Components.Schemas["CreatePublicLinkInput"] = optional(openapi.Object(map[string]*openapi.Schema{
+		"expires_at": openapi.Nullable(openapi.DateTime()),
+		"max_views":  openapi.Nullable(openapi.Integer()),
+		"password":   openapi.String(),
+	}))
+
+	doc.Components.Schemas["CreateWorkspaceInput"] = openapi.Object(map[string]*openapi.Schema{
+		"name":  openapi.String(),
+		"slug":  openapi.String(),
+		"email": openapi.String(),
+	})
+	doc.Components.Schemas["CreateInvitationInput"] = openapi.Object(map[string]*openapi.Schema{
+		"email": openapi.String(),
+		"role":  roleSchema(),
+	})
+
+	message := envelopeSchema("message", openapi.String())
+
+	routes := []route{
+		{"GET", "/v1/ping", &openapi.Operation{
+			Summary:   "Check the API is reachable",
+			Tags:      []string{"health"},
+			Responses: responses(ok(envelopeSchema("ping", openapi.String()))),
+		}},
+		{"GET", "/v1/healthcheck", &openapi.Operation{
+			Summary: "Show the readiness report along with the environment and version",
+			Tags:    []string{"health"},
+			Responses: func() map[string]*openapi.Response {
+				report := openapi.Object(map[string]*openapi.Schema{
+					"status":      {Type: openapi.Types{"string"}, Enum: []any{"available", "unavailable"}},
+					"environment": openapi.String(),
+					"version":     openapi.String(),
+					"components":  openapi.MapOf(component),
+				})
+				return map[string]*openapi.Response{
+					"200": jsonResponse("The API is ready", report),
+					"503": jsonResponse("A component is degraded", report),
+				}
+			}(),
+		}},
+		{"GET", "/v1/healthcheck/live", &openapi.Operation{
+			Summary:   "Check the process is up",
+			Tags:      []string{"health"},
+			Responses: responses(ok(envelopeSchema("status", openapi.String()))),
+		}},
+		{"GET", "/v1/healthcheck/ready", &openapi.Operation{
+			Summary: "Check every dependency of the API",
+			Tags:    []string{"health"},
+			Responses: func() map[string]*openapi.Response {
+				report := openapi.Object(map[string]*openapi.Schema{
+					"status":     {Type: openapi.Types{"string"}, Enum: []any{statusOK, statusDegraded}},
+					"components": openapi.MapOf(component),
+				})
+				return map[string]*openapi.Response{
+					"200": jsonResponse("Every component is ok", report),
+					"503": jsonResponse("A component is degraded", report),
+				}
+			}(),
+		}},
+
+		{"GET", "/v1/notes", &openapi.Operation{
+			Summary:     "List notes",
+			Description: "Pages are picked by number, or by a cursor from the next and prev links. Archived notes are only listed with archived=true.",
+			Tags:        []string{"notes"},
+			Parameters: []*openapi.Parameter{
+				queryParam("q", openapi.String(), "Full text search over the title and content"),
+				queryParam("tags", openapi.ArrayOf(openapi.String()), "Comma separated tags the notes must all have"),
+				queryParam("archived", openapi.Boolean(), "List archived notes instead of active ones"),
+				queryParam("pinned", openapi.Boolean(), "Only pinned or only unpinned notes"),
+				queryParam("pinned_first", openapi.Boolean(), "List pinned notes first, true by default"),
+				pageParam(), pageSizeParam(), sortParam(noteSortSafelist, "-last_updated_at"),
+				queryParam("cursor", openapi.String(), "A cursor from the next or prev link of an earlier page"),
+			},
+			Responses: responses(listResponse("notes", note, metadata, linkHeader()), errorResponses("ValidationFailed")),
+		}},
+		{"POST", "/v1/notes", &openapi.Operation{
+			Summary:     "Create a note",
+			Description: "With ?template the note is rendered from a template, and the body is an optional CreateNoteFromTemplateInput instead.",
+			Tags:        []string{"notes"},
+			Parameters: []*openapi.Parameter{
+				queryParam("template", openapi.Integer(), "Id of a template to create the note from"),
+			},
+			RequestBody: jsonBody(false, &openapi.Schema{OneOf: []*openapi.Schema{openapi.Ref("CreateNoteInput"), openapi.Ref("CreateNoteFromTemplateInput")}}),
+			Responses:   responses(created(envelopeSchema("note", note)), errorResponses("BadRequest", "NotFound", "ValidationFailed")),
+		}},
+		{"GET", "/v1/notes/:id", &openapi.Operation{
+			Summary:    "Show a note",
+			Tags:       []string{"notes"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			Responses:  responses(ok(envelopeSchema("note", note)), errorResponses("NotFound")),
+		}},
+		{"PATCH", "/v1/notes/:id", &openapi.Operation{
+			Summary:     "Update a note",
+			Description: "Only the fields given are changed. remind_at can be cleared with null.",
+			Tags:        []string{"notes"},
+			Parameters: []*openapi.Parameter{
+				pathID("id"),
+				queryParam("rewrite_links", openapi.Boolean(), "Rewrite [[title]] links in other notes when the title changes"),
+			},
+			RequestBody: jsonBody(true, openapi.Ref("UpdateNoteInput")),
+			Responses: responses(ok(optional(openapi.Object(map[string]*openapi.Schema{
+				"note":            note,
+				"rewritten_notes": openapi.Nullable(openapi.ArrayOf(openapi.Integer())),
+			}), "rewritten_notes")), errorResponses("BadRequest", "NotFound", "EditConflict", "ValidationFailed")),
+		}},
+		{"DELETE", "/v1/notes/:id", &openapi.Operation{
+			Summary:    "Delete a note along with its attachments",
+			Tags:       []string{"notes"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			Responses:  responses(ok(message), errorResponses("NotFound")),
+		}},
+
+		{"GET", "/v1/notes/:id/items", &openapi.Operation{
+			Summary:    "List the checklist of a note",
+			Tags:       []string{"checklists"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			Responses:  responses(listResponse("items", item, nil), errorResponses("NotFound")),
+		}},
+		{"POST", "/v1/notes/:id/items", &openapi.Operation{
+			Summary:     "Add an item to the checklist of a note",
+			Tags:        []string{"checklists"},
+			Parameters:  []*openapi.Parameter{pathID("id")},
+			RequestBody: jsonBody(true, openapi.Ref("CreateItemInput")),
+			Responses:   responses(created(envelopeSchema("item", item)), errorResponses("BadRequest", "NotFound", "ValidationFailed")),
+		}},
+		{"PUT", "/v1/notes/:id/items/order", &openapi.Operation{
+			Summary:    "Reorder the checklist of a note",
+			Tags:       []string{"checklists"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			RequestBody: jsonBody(true, openapi.Object(map[string]*openapi.Schema{
+				"item_ids": openapi.ArrayOf(openapi.Integer()),
+			})),
+			Responses: responses(ok(envelopeSchema("items", openapi.ArrayOf(item))), errorResponses("BadRequest", "NotFound", "ValidationFailed")),
+		}},
+		{"PATCH", "/v1/notes/:id/items/:item_id", &openapi.Operation{
+			Summary:     "Update a checklist item",
+			Tags:        []string{"checklists"},
+			Parameters:  []*openapi.Parameter{pathID("id"), pathID("item_id")},
+			RequestBody: jsonBody(true, openapi.Ref("UpdateItemInput")),
+			Responses:   responses(ok(envelopeSchema("item", item)), errorResponses("BadRequest", "NotFound", "ValidationFailed")),
+		}},
+		{"POST", "/v1/notes/:id/items/:item_id/toggle", &openapi.Operation{
+			Summary:    "Check or uncheck a checklist item",
+			Tags:       []string{"checklists"},
+			Parameters: []*openapi.Parameter{pathID("id"), pathID("item_id")},
+			Responses:  responses(ok(envelopeSchema("item", item)), errorResponses("NotFound")),
+		}},
+		{"DELETE", "/v1/notes/:id/items/:item_id", &openapi.Operation{
+			Summary:    "Delete a checklist item",
+			Tags:       []string{"checklists"},
+			Parameters: []*openapi.Parameter{pathID("id"), pathID("item_id")},
+			Responses:  responses(ok(message), errorResponses("NotFound")),
+		}},
+		{"GET", "/v1/tasks", &openapi.Operation{
+			Summary: "List checklist items across every note",
+			Tags:    []string{"checklists"},
+			Parameters: []*openapi.Parameter{
+				queryParam("status", &openapi.Schema{Type: openapi.Types{"string"}, Enum: []any{"open", "done", "all"}}, "open by default"),
+				pageParam(), pageSizeParam(), sortParam([]string{"due_at", "created_at", "-due_at", "-created_at"}, "due_at"),
+			},
+			Responses: responses(listResponse("tasks", task, metadata), errorResponses("ValidationFailed")),
+		}},
+
+		{"GET", "/v1/notes/:id/public-links", &openapi.Operation{
+			Summary:    "List the public links of a note",
+			Tags:       []string{"public links"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			Responses:  responses(listResponse("public_links", publicLink, nil), errorResponses("NotFound")),
+		}},
+		{"POST", "/v1/notes/:id/public-links", &openapi.Operation{
+			Summary:     "Share a note through a public link",
+			Description: "The body is optional. The token is only ever shown in this response.",
+			Tags:        []string{"public links"},
+			Parameters:  []*openapi.Parameter{pathID("id")},
+			RequestBody: jsonBody(false, openapi.Ref("CreatePublicLinkInput")),
+			Responses: responses(created(openapi.Object(map[string]*openapi.Schema{
+				"public_link": publicLink,
+				"url":         openapi.String(),
+			})), errorResponses("BadRequest", "NotFound", "ValidationFailed")),
+		}},
+		{"DELETE", "/v1/notes/:id/public-links/:link_id", &openapi.Operation{
+			Summary:    "Revoke a public link",
+			Tags:       []string{"public links"},
+			Parameters: []*openapi.Parameter{pathID("id"), pathID("link_id")},
+			Responses:  responses(ok(message), errorResponses("NotFound")),
+		}},
+		{"GET", "/v1/public/:token", &openapi.Operation{
+			Summary:     "View a shared note",
+			Description: "Sent as HTML with ?format=html, or to clients which prefer text/html. A password can be given in X-Link-Password or with basic auth. After 5 wrong passwords in a row the link is locked for 15 minutes.",
+			Tags:        []string{"public links"},
+			Parameters: []*openapi.Parameter{
+				{Name: "token", In: "path", Required: true, Schema: openapi.String()},
+				queryParam("format", &openapi.Schema{Type: openapi.Types{"string"}, Enum: []any{"html", "json"}}, "Pick the format instead of going by the Accept header"),
+				{Name: "X-Link-Password", In: "header", Description: "Password of the link, if it has one", Schema: openapi.String()},
+			},
+			Responses: responses(map[string]*openapi.Response{
+				"200": {
+					Description: "The note",
+					Content: map[string]*openapi.MediaType{
+						"application/json": {Schema: envelopeSchema("note", note)},
+						"text/html":        {Schema: openapi.String()},
+					},
+				},
+			}, errorResponses("PasswordRequired", "NotFound", "TooManyRequests")),
+		}},
+
+		{"GET", "/v1/templates", &openapi.Operation{
+			Summary:   "List templates",
+			Tags:      []string{"templates"},
+			Responses: responses(listResponse("templates", template, nil)),
+		}},
+		{"POST", "/v1/templates", &openapi.Operation{
+			Summary:     "Create a template",
+			Tags:        []string{"templates"},
+			RequestBody: jsonBody(true, openapi.Ref("CreateTemplateInput")),
+			Responses:   responses(created(envelopeSchema("template", template)), errorResponses("BadRequest", "ValidationFailed")),
+		}},
+		{"GET", "/v1/templates/:id", &openapi.Operation{
+			Summary:    "Show a template",
+			Tags:       []string{"templates"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			Responses:  responses(ok(envelopeSchema("template", template)), errorResponses("NotFound")),
+		}},
+		{"PATCH", "/v1/templates/:id", &openapi.Operation{
+			Summary:     "Update a template",
+			Tags:        []string{"templates"},
+			Parameters:  []*openapi.Parameter{pathID("id")},
+			RequestBody: jsonBody(true, openapi.Ref("UpdateTemplateInput")),
+			Responses:   responses(ok(envelopeSchema("template", template)), errorResponses("BadRequest", "NotFound", "EditConflict", "ValidationFailed")),
+		}},
+		{"DELETE", "/v1/templates/:id", &openapi.Operation{
+			Summary:    "Delete a template",
+			Tags:       []string{"templates"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			Responses:  responses(ok(message), errorResponses("NotFound")),
+		}},
+
+		{"GET", "/v1/reminders", &openapi.Operation{
+			Summary: "List upcoming reminders",
+			Tags:    []string{"reminders"},
+			Parameters: []*openapi.Parameter{
+				queryParam("before", openapi.DateTime(), "Only reminders due before this time"),
+				pageParam(), pageSizeParam(), sortParam([]string{"remind_at", "-remind_at"}, "remind_at"),
+			},
+			Responses: responses(listResponse("reminders", reminder, metadata), errorResponses("ValidationFailed")),
+		}},
+		{"GET", "/v1/reminders/stream", &openapi.Operation{
+			Summary:     "Stream reminders as they fire",
+			Description: "Server-sent events, one reminder event for each reminder in the workspace fired by this instance of the API while the stream is open. Reminders fired while nobody is connected are not kept.",
+			Tags:        []string{"reminders"},
+			Responses: responses(map[string]*openapi.Response{
+				"200": {
+					Description: "A stream of reminder events, whose data is the reminder as JSON",
+					Content:     map[string]*openapi.MediaType{"text/event-stream": {Schema: openapi.String()}},
+				},
+			}),
+		}},
+
+		{"GET", "/v1/notes/:id/links", &openapi.Operation{
+			Summary:    "Show the links from a note to other notes",
+			Tags:       []string{"links"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			Responses:  responses(listResponse("links", link, nil), errorResponses("NotFound")),
+		}},
+		{"GET", "/v1/notes/:id/backlinks", &openapi.Operation{
+			Summary:    "Show the notes which link to a note",
+			Tags:       []string{"links"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			Responses:  responses(listResponse("backlinks", linkedNote, nil), errorResponses("NotFound")),
+		}},
+		{"GET", "/v1/graph", &openapi.Operation{
+			Summary: "Show all notes and the links between them",
+			Tags:    []string{"links"},
+			Responses: responses(ok(openapi.Object(map[string]*openapi.Schema{
+				"nodes": openapi.ArrayOf(linkedNote),
+				"edges": openapi.ArrayOf(edge),
+			}))),
+		}},
+
+		{"POST", "/v1/graphql", &openapi.Operation{
+			Summary:     "Run a GraphQL query or mutation",
+			Description: "Errors in the query are reported in the errors array of a 200 response. Queries which nest fields more than 6 levels deep or select more than 200 fields are refused with a 422.",
+			Tags:        []string{"graphql"},
+			RequestBody: jsonBody(true, optional(openapi.Object(map[string]*openapi.Schema{
+				"query":         openapi.String(),
+				"operationName": openapi.String(),
+				"variables":     openapi.Nullable(openapi.MapOf(&openapi.Schema{})),
+			}), "operationName", "variables")),
+			Responses: responses(ok(optional(openapi.Object(map[string]*openapi.Schema{
+				"data": {},
+				"errors": openapi.ArrayOf(&openapi.Schema{
+					Type:       openapi.Types{"object"},
+					Properties: map[string]*openapi.Schema{"message": openapi.String(), "extensions": openapi.MapOf(&openapi.Schema{})},
+					Required:   []string{"message"},
+				}),
+			}), "errors")), errorResponses("BadRequest", "ValidationFailed")),
+		}},
+
+		{"GET", "/v1/notes/:id/attachments", &openapi.Operation{
+			Summary:    "List the attachments of a note",
+			Tags:       []string{"attachments"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			Responses:  responses(listResponse("attachments", attachment, nil), errorResponses("NotFound")),
+		}},
+		{"POST", "/v1/notes/:id/attachments", &openapi.Operation{
+			Summary:    "Upload an attachment to a note",
+			Tags:       []string{"attachments"},
+			Parameters: []*openapi.Parameter{pathID("id")},
+			RequestBody: &openapi.RequestBody{
+				Required: true,
+				Content: map[string]*openapi.MediaType{
+					"multipart/form-data": {Schema: openapi.Object(map[string]*openapi.Schema{
+						"file": {Type: openapi.Types{"string"}, Format: "binary"},
+					})},
+				},
+			},
+			Responses: responses(created(envelopeSchema("attachment", attachment)), errorResponses("BadRequest", "NotFound", "FileTooLarge", "UnsupportedMediaType")),
+		}},
+		{"GET", "/v1/notes/:id/attachments/:attachment_id", &openapi.Operation{
+			Summary:    "Download an attachment",
+			Tags:       []string{"attachments"},
+			Parameters: []*openapi.Parameter{pathID("id"), pathID("attachment_id")},
+			Responses: responses(map[string]*openapi.Response{
+				"200": {
+					Description: "The file, with the type it was uploaded as",
+					Headers: map[string]*openapi.Header{
+						"Content-Disposition": {Description: "attachment, with the original filename", Schema: openapi.String()},
+					},
+					Content: map[string]*openapi.MediaType{
+						"*/*": {Schema: &openapi.Schema{Type: openapi.Types{"string"}, Format: "binary"}},
+					},
+				},
+			}, errorResponses("NotFound")),
+		}},
+		{"DELETE", "/v1/notes/:id/attachments/:attachment_id", &openapi.Operation{
+			Summary:    "Delete an attachment",
+			Tags:       []string{"attachments"},
+			Parameters: []*openapi.Parameter{pathID("id"), pathID("attachment_id")},
+			Responses:  responses(ok(message), errorResponses("NotFound")),
+		}},
+
+		{"GET", "/v1/notes/:id/activity", &openapi.Operation{
+			Summary:     "List the changes made to a note",
+			Description: "Changes to the items, attachments and public links of the note are included, newest first.",
+			Tags:        []string{"audit"},
+			Parameters: []*openapi.Parameter{
+				pathID("id"),
+				pageParam(), pageSizeParam(), sortParam([]string{"created_at", "-created_at"}, "-created_at"),
+			},
+			Responses: responses(listResponse("events", auditEvent, metadata), errorResponses("NotFound", "ValidationFailed")),
+		}},
+
+		{"POST", "/v1/workspaces", &openapi.Operation{
+			Summary:     "Create a workspace",
+			Description: "The email address given becomes the owner of the workspace. Their member token is only ever shown in this response.",
+			Tags:        []string{"workspaces"},
+			RequestBody: jsonBody(true, openapi.Ref("CreateWorkspaceInput")),
+			Responses: responses(created(openapi.Object(map[string]*openapi.Schema{
+				"workspace": workspace,
+				"member":    member,
+			})), errorResponses("BadRequest", "ValidationFailed")),
+		}},
+		{"GET", "/v1/workspaces/:ws", &openapi.Operation{
+			Summary:    "Show a workspace",
+			Tags:       []string{"workspaces"},
+			Parameters: []*openapi.Parameter{workspaceParam()},
+			Responses:  responses(ok(envelopeSchema("workspace", workspace)), errorResponses("Unauthorized", "NotFound")),
+		}},
+		{"DELETE", "/v1/workspaces/:ws", &openapi.Operation{
+			Summary:     "Delete a workspace and every note in it",
+			Description: "Only owners can delete a workspace. The default workspace can't be deleted.",
+			Tags:        []string{"workspaces"},
+			Parameters:  []*openapi.Parameter{workspaceParam()},
+			Responses:   responses(ok(message), errorResponses("Unauthorized", "Forbidden", "NotFound")),
+		}},
+		{"GET", "/v1/workspaces/:ws/members", &openapi.Operation{
+			Summary:    "List the members of a workspace",
+			Tags:       []string{"workspaces"},
+			Parameters: []*openapi.Parameter{workspaceParam()},
+			Responses:  responses(listResponse("members", member, nil), errorResponses("Unauthorized", "NotFound")),
+		}},
+		{"PATCH", "/v1/workspaces/:ws/members/:member_id", &openapi.Operation{
+			Summary:     "Change the role of a member",
+			Description: "Admins can change roles, but only owners can make someone an owner or change the role of an owner. A workspace always keeps at least one owner.",
+			Tags:        []string{"workspaces"},
+			Parameters:  []*openapi.Parameter{workspaceParam(), pathID("member_id")},
+			RequestBody: jsonBody(true, openapi.Object(map[string]*openapi.Schema{"role": roleSchema()})),
+			Responses:   responses(ok(envelopeSchema("member", member)), errorResponses("BadRequest", "Unauthorized", "Forbidden", "NotFound", "ValidationFailed")),
+		}},
+		{"DELETE", "/v1/workspaces/:ws/members/:member_id", &openapi.Operation{
+			Summary:     "Remove a member from a workspace",
+			Description: "Admins can remove members, and only owners can remove an owner. Any member can remove themselves.",
+			Tags:        []string{"workspaces"},
+			Parameters:  []*openapi.Parameter{workspaceParam(), pathID("member_id")},
+			Responses:   responses(ok(message), errorResponses("Unauthorized", "Forbidden", "NotFound", "ValidationFailed")),
+		}},
+		{"GET", "/v1/workspaces/:ws/invitations", &openapi.Operation{
+			Summary:    "List the invitations to a workspace that haven't been accepted",
+			Tags:       []string{"workspaces"},
+			Parameters: []*openapi.Parameter{workspaceParam()},
+			Responses:  responses(listResponse("invitations", invitation, nil), errorResponses("Unauthorized", "Forbidden", "NotFound")),
+		}},
+		{"POST", "/v1/workspaces/:ws/invitations", &openapi.Operation{
+			Summary:     "Invite someone to a workspace by email",
+			Description: "The token is emailed when an SMTP host is set, and is only in the response when it isn't. Only owners can invite owners.",
+			Tags:        []string{"workspaces"},
+			Parameters:  []*openapi.Parameter{workspaceParam()},
+			RequestBody: jsonBody(true, openapi.Ref("CreateInvitationInput")),
+			Responses:   responses(created(envelopeSchema("invitation", invitation)), errorResponses("BadRequest", "Unauthorized", "Forbidden", "NotFound", "ValidationFailed")),
+		}},
+		{"DELETE", "/v1/workspaces/:ws/invitations/:invitation_id", &openapi.Operation{
+			Summary:    "Withdraw an invitation",
+			Tags:       []string{"workspaces"},
+			Parameters: []*openapi.Parameter{workspaceParam(), pathID("invitation_id")},
+			Responses:  responses(ok(message), errorResponses("Unauthorized", "Forbidden", "NotFound")),
+		}},
+		{"POST", "/v1/invitations/accept", &openapi.Operation{
+			Summary:     "Accept an invitation, for a member token",
+			Description: "The member token is only ever shown in this response.",
+			Tags:        []string{"workspaces"},
+			RequestBody: jsonBody(true, openapi.Object(map[string]*openapi.Schema{"token": openapi.String()})),
+			Responses: responses(created(openapi.Object(map[string]*openapi.Schema{
+				"workspace": workspace,
+				"member":    member,
+			})), errorResponses("BadRequest", "NotFound", "ValidationFailed")),
+		}},
+
+		{"POST", "/v1/import", &openapi.Operation{
+			Summary:     "Import notes from uploaded files in the background",
+			Description: "Every file part of the form is imported, as Markdown, JSON or an Evernote export.",
+			Tags:        []string{"import"},
+			RequestBody: &openapi.RequestBody{
+				Required: true,
+				Content: map[string]*openapi.MediaType{
+					"multipart/form-data": {Schema: openapi.MapOf(&openapi.Schema{Type: openapi.Types{"string"}, Format: "binary"})},
+				},
+			},
+			Responses: responses(map[string]*openapi.Response{
+				"202": {
+					Description: "The import has started",
+					Headers:     map[string]*openapi.Header{"Location": {Description: "Where to follow the progress of the import", Schema: openapi.String()}},
+					Content:     jsonContent(envelopeSchema("job", job)),
+				},
+			}, errorResponses("BadRequest")),
+		}},
+		{"GET", "/v1/import/:job", &openapi.Operation{
+			Summary: "Show the progress and error report of an import",
+			Tags:    []string{"import"},
+			Parameters: []*openapi.Parameter{
+				{Name: "job", In: "path", Required: true, Schema: openapi.String()},
+			},
+			Responses: responses(ok(envelopeSchema("job", job)), errorResponses("NotFound")),
+		}},
+
+		{"GET", "/v1/openapi.json", &openapi.Operation{
+			Summary:   "Show this document",
+			Tags:      []string{"docs"},
+			Responses: responses(ok(&openapi.Schema{Type: openapi.Types{"object"}})),
+		}},
+		{"GET", "/v1/docs", &openapi.Operation{
+			Summary: "Browse this document",
+			Tags:    []string{"docs"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "An HTML page", Content: map[string]*openapi.MediaType{"text/html": {Schema: openapi.String()}}},
+			},
+		}},
+	}
+
+	if app.config.metrics.enabled {
+		routes = append(routes,
+			route{"GET", "/debug/metrics", &openapi.Operation{
+				Summary: "Show the metrics in the Prometheus text format",
+				Tags:    []string{"debug"},
+				Responses: responses(map[string]*openapi.Response{
+					"200": {Description: "The metrics", Content: map[string]*openapi.MediaType{"text/plain": {Schema: openapi.String()}}},
+				}, errorResponses("Unauthorized")),
+			}},
+			route{"GET", "/debug/vars", &openapi.Operation{
+				Summary:   "Show the expvar variables",
+				Tags:      []string{"debug"},
+				Responses: responses(ok(&openapi.Schema{Type: openapi.Types{"object"}}), errorResponses("Unauthorized")),
+			}},
+		)
+	}
+
+	if app.config.audit.password != "" {
+		routes = append(routes,
+			route{"GET", "/v1/audit", &openapi.Operation{
+				Summary: "Search the audit log",
+				Tags:    []string{"audit"},
+				Parameters: []*openapi.Parameter{
+					queryParam("action", &openapi.Schema{Type: openapi.Types{"string"}, Enum: auditActionEnum()}, "Only events with this action"),
+					queryParam("actor", openapi.String(), "Only events made by this actor"),
+					queryParam("request_id", openapi.String(), "Only events made by the request with this X-Request-Id"),
+					queryParam("note_id", openapi.Integer(), "Only events on this note, including after it was deleted"),
+					queryParam("since", openapi.DateTime(), "Only events at or after this time"),
+					queryParam("until", openapi.DateTime(), "Only events before this time"),
+					pageParam(), pageSizeParam(), sortParam([]string{"created_at", "-created_at"}, "-created_at"),
+				},
+				Responses: responses(listResponse("events", auditEvent, metadata), errorResponses("Unauthorized", "ValidationFailed")),
+			}},
+		)
+	}
+
+	for _, rt := range routes {
+		rt.op.OperationID = operationID(rt.method, rt.path)
+		if rt.method == "POST" || rt.method == "PATCH" {
+			addIdempotencyKey(rt.op)
+		}
+		doc.Add(rt.method, openAPIPath(rt.path), rt.op)
+	}
+
+	return doc
+}
+
+// addIdempotencyKey documents the Idempotency-Key header every POST and PATCH
+// takes, and the errors it can be turned away with. Where the operation can
+// already fail with the same status, the response of that is kept, since both
+// are sent as an Error.
+func addIdempotencyKey(op *openapi.Operation) {
+	op.Parameters = append(op.Parameters, &openapi.Parameter{
+		Name:        "Idempotency-Key",
+		In:          "header",
+		Description: "A key of up to 255 bytes unique to this request, so it can be repeated safely. The response to the first request with a key is sent again, with Idempotent-Replayed set, for 24 hours",
+		Schema:      openapi.String(),
+	})
+
+	for status, name := range map[string]string{"400": "IdempotencyKeyReused", "409": "IdempotencyKeyInUse"} {
+		if _, ok := op.Responses[status]; !ok {
+			op.Responses[status] = &openapi.Response{Ref: "#/components/responses/" + name}
+		}
+	}
+}
+
+// addErrorComponents adds the error responses of errors.go to the document.
+// Each can be sent as the usual {"error": ...} envelope or as problem details.
+func (app *application) addErrorComponents(doc *openapi.Document, fieldError *openapi.Schema) {
+	doc.Components.Schemas["Error"] = envelopeSchema("error", openapi.String())
+	doc.Components.Schemas["ValidationError"] = envelopeSchema("error", openapi.MapOf(openapi.String()))
+	doc.Components.Schemas["Problem"] = optional(openapi.Object(map[string]*openapi.Schema{
+		"type":     openapi.String(),
+		"title":    openapi.String(),
+		"status":   openapi.Integer(),
+		"detail":   openapi.String(),
+		"code":     openapi.String(),
+		"instance": openapi.String(),
+		"errors":   openapi.ArrayOf(fieldError),
+	}), "instance", "errors")
+
+	add := func(name, description, schema string) {
+		doc.Components.Responses[name] = &openapi.Response{
+			Description: description,
+			Content: map[string]*openapi.MediaType{
+				"application/json":         {Schema: openapi.Ref(schema)},
+				"application/problem+json": {Schema: openapi.Ref("Problem")},
+			},
+		}
+	}
+
+	add("BadRequest", "The request could not be read ("+codeBadRequest+")", "Error")
+	add("Unauthorized", "Missing or wrong credentials ("+codeUnauthorized+")", "Error")
+	add("PasswordRequired", "The note needs a password ("+codePasswordRequired+")", "Error")
+	add("Forbidden", "The member's role doesn't allow this ("+codeForbidden+")", "Error")
+	add("NotFound", "No such resource ("+codeNotFound+")", "Error")
+	add("EditConflict", "The resource was changed by someone else in the meantime ("+codeEditConflict+")", "Error")
+	add("IdempotencyKeyReused", "The Idempotency-Key was used for a different request ("+codeIdempotencyKeyReused+")", "Error")
+	add("IdempotencyKeyInUse", "The first request with the Idempotency-Key is still being handled ("+codeIdempotencyKeyInUse+")", "Error")
+	add("FileTooLarge", "The upload is over the size limit ("+codeFileTooLarge+")", "Error")
+	add("UnsupportedMediaType", "Files of this type aren't accepted ("+codeUnsupportedMediaType+")", "Error")
+	add("TooManyRequests", "Too many wrong passwords were tried, wait for Retry-After seconds ("+codeTooManyRequests+")", "Error")
+	doc.Components.Responses["TooManyRequests"].Headers = map[string]*openapi.Header{
+		"Retry-After": {Description: "Seconds until the link can be tried again", Schema: openapi.Integer()},
+	}
+	add("ValidationFailed", "The input failed validation, with a message for each field ("+codeValidationFailed+")", "ValidationError")
+	add("ServerError", "Something went wrong on the server ("+codeServerError+")", "Error")
+}
+
+// openAPIPath turns the :name parameters of an httprouter path into {name}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// operationID names an operation after its method and path, such as
+// get_notes_id_items for GET /v1/notes/:id/items.
+func operationID(method, path string) string {
+	name := strings.ToLower(method)
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/v1"), "/") {
+		segment = strings.Trim(segment, ":")
+		segment = strings.NewReplacer("-", "_", ".", "_").Replace(segment)
+		if segment != "" {
+			name += "_" + segment
+		}
+	}
+
+	return name
+}
+
+func envelopeSchema(key string, s *openapi.Schema) *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{key: s})
+}
+
+// optional takes names out of the required properties of s. With no names every
+// property is made optional.
+func optional(s *openapi.Schema, names ...string) *openapi.Schema {
+	if len(names) == 0 {
+		s.Required = nil
+		return s
+	}
+
+	var required []string
+	for _, name := range s.Required {
+		if !slices.Contains(names, name) {
+			required = append(required, name)
+		}
+	}
+	s.Required = required
+
+	return s
+}
+
+// withNullable copies fields, letting the named ones be null as well.
+func withNullable(fields map[string]*openapi.Schema, names ...string) map[string]*openapi.Schema {
+	c := make(map[string]*openapi.Schema, len(fields))
+	for name, s := range fields {
+		if slices.Contains(names, name) {
+			s = openapi.Nullable(s)
+		}
+		c[name] = s
+	}
+
+	return c
+}
+
+func jsonContent(s *openapi.Schema) map[string]*openapi.MediaType {
+	return map[string]*openapi.MediaType{"application/json": {Schema: s}}
+}
+
+func jsonBody(required bool, s *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{Required: required, Content: jsonContent(s)}
+}
+
+func jsonResponse(description string, s *openapi.Schema) *openapi.Response {
+	return &openapi.Response{Description: description, Content: jsonContent(s)}
+}
+
+func ok(s *openapi.Schema) map[string]*openapi.Response {
+	return map[string]*openapi.Response{"200": jsonResponse("OK", s)}
+}
+
+func created(s *openapi.Schema) map[string]*openapi.Response {
+	resp := jsonResponse("Created", s)
+	resp.Headers = map[string]*openapi.Header{
+		"Location": {Description: "Where the new resource can be found", Schema: openapi.String()},
+	}
+
+	return map[string]*openapi.Response{"201": resp}
+}
+
+// listResponse is a listing written by writeList, which can also be streamed as
+// NDJSON with the metadata in headers.
+func listResponse(key string, item, metadata *openapi.Schema, headers ...map[string]*openapi.Header) map[string]*openapi.Response {
+	env := map[string]*openapi.Schema{key: openapi.ArrayOf(item)}
+	if metadata != nil {
+		env["metadata"] = metadata
+	}
+
+	resp := &openapi.Response{
+		Description: "The listing. Clients which accept application/x-ndjson get one item per line instead.",
+		Headers:     make(map[string]*openapi.Header),
+		Content: map[string]*openapi.MediaType{
+			"application/json":     {Schema: openapi.Object(env)},
+			"application/x-ndjson": {Schema: item},
+		},
+	}
+
+	if metadata != nil {
+		for _, name := range []string{"X-Current-Page", "X-Page-Size", "X-Last-Page", "X-Total-Records"} {
+			resp.Headers[name] = &openapi.Header{Description: "Page metadata of an NDJSON listing", Schema: openapi.Integer()}
+		}
+	}
+
+	for _, h := range headers {
+		for name, header := range h {
+			resp.Headers[name] = header
+		}
+	}
+
+	return map[string]*openapi.Response{"200": resp}
+}
+
+func linkHeader() map[string]*openapi.Header {
+	return map[string]*openapi.Header{
+		"Link": {Description: "The next and prev pages, as in RFC 8288", Schema: openapi.String()},
+	}
+}
+
+// errorResponses refers to the named responses from addErrorComponents, by their
+// status codes.
+func errorResponses(names ...string) map[string]*openapi.Response {
+	statuses := map[string]string{
+		"BadRequest":           "400",
+		"Unauthorized":         "401",
+		"PasswordRequired":     "401",
+		"Forbidden":            "403",
+		"NotFound":             "404",
+		"EditConflict":         "409",
+		"FileTooLarge":         "413",
+		"UnsupportedMediaType": "415",
+		"ValidationFailed":     "422",
+		"TooManyRequests":      "429",
+	}
+
+	resps := make(map[string]*openapi.Response)
+	for _, name := range names {
+		resps[statuses[name]] = &openapi.Response{Ref: "#/components/responses/" + name}
+	}
+
+	return resps
+}
+
+// responses merges sets of responses, adding the 500 every operation can fail
+// with.
+func responses(sets ...map[string]*openapi.Response) map[string]*openapi.Response {
+	all := map[string]*openapi.Response{
+		"500": {Ref: "#/components/responses/ServerError"},
+	}
+	for _, set := range sets {
+		for status, resp := range set {
+			all[status] = resp
+		}
+	}
+
+	return all
+}
+
+func pathID(name string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "path", Required: true, Schema: &openapi.Schema{Type: openapi.Types{"integer"}, Minimum: ptr(1.0)}}
+}
+
+func workspaceParam() *openapi.Parameter {
+	return &openapi.Parameter{Name: "ws", In: "path", Required: true, Description: "Id or slug of the workspace", Schema: openapi.String()}
+}
+
+func roleSchema() *openapi.Schema {
+	roles := make([]any, len(data.WorkspaceRoles))
+	for i, role := range data.WorkspaceRoles {
+		roles[i] = role
+	}
+	return &openapi.Schema{Type: openapi.Types{"string"}, Enum: roles}
+}
+
+func auditActionEnum() []any {
+	actions := make([]any, len(data.AuditActions))
+	for i, action := range data.AuditActions {
+		actions[i] = action
+	}
+	return actions
+}
+
+func queryParam(name string, s *openapi.Schema, description string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: s}
+}
+
+func pageParam() *openapi.Parameter {
+	return queryParam("page", &openapi.Schema{Type: openapi.Types{"integer"}, Minimum: ptr(1.0), Maximum: ptr(10_000_000.0)}, "Page number, starting at 1")
+}
+
+func pageSizeParam() *openapi.Parameter {
+	return queryParam("page_size", &openapi.Schema{Type: openapi.Types{"integer"}, Minimum: ptr(1.0), Maximum: ptr(100.0)}, "Items per page, 20 by default")
+}
+
+func sortParam(safelist []string, defaultSort string) *openapi.Parameter {
+	enum := make([]any, len(safelist))
+	for i, s := range safelist {
+		enum[i] = s
+	}
+
+	return queryParam("sort", &openapi.Schema{Type: openapi.Types{"string"}, Enum: enum}, "Sort column, descending with a leading -. "+defaultSort+" by default")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// openAPIHandler serves the document, which is only built and encoded once.
+func (app *application) openAPIHandler(doc *openapi.Document) http.HandlerFunc {
+	js, err := json.Marshal(doc)
+	if err != nil {
+		// the document is fixed, so this is a bug rather than something to recover from
+		panic(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// sent as it is rather than through writeJSON, so ?pretty has no effect
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+	}
+}
+
+// docsHandler serves a page for browsing the document at /v1/openapi.json.
+func (app *application) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'self' 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	w.Write(docsHTML)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/openapi"
+)
+
+// specMaxBodyBytes is the most of a request or response body kept for checking
+// against the document. Anything bigger goes through unchecked.
+const specMaxBodyBytes = 4 << 20
+
+// validateOpenAPI checks every request and response against doc, and logs
+// wherever they don't match. It never changes a response, as it only runs in
+// development to catch the document and the handlers drifting apart.
+//
+// Requests are only checked when the handler accepted them. A request outside
+// the document that was turned away with a 4xx is the handler doing its job,
+// while one that succeeded means the document is missing something.
+func (app *application) validateOpenAPI(doc *openapi.Document, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, params := doc.Find(r.Method, r.URL.Path)
+
+		var body []byte
+		if op != nil && r.Body != nil && isJSONMediaType(r.Header.Get("Content-Type")) {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, specMaxBodyBytes+1))
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+
+			// the handler still sees the whole body, including anything past the limit
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		}
+
+		sw := &specResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		var violations []openapi.Violation
+
+		switch {
+		case op == nil:
+			// unknown paths and methods are answered with 404 and 405, which aren't
+			// operations, but a route that matched has to be in the document
+			if route, ok := r.Context().Value(routeContextKey).(*string); ok && *route != "unmatched" {
+				violations = append(violations, openapi.Violation{Path: "route", Message: *route + " is not in the document"})
+			}
+		default:
+			if sw.status < 300 && len(body) <= specMaxBodyBytes {
+				violations = append(violations, checkRequest(doc, op, params, r, body)...)
+			}
+			violations = append(violations, checkResponse(doc, op, sw)...)
+		}
+
+		for _, v := range violations {
+			app.logError(r, fmt.Errorf("openapi: %s %s %d: %s", r.Method, r.URL.Path, sw.status, v))
+		}
+	})
+}
+
+func checkRequest(doc *openapi.Document, op *openapi.Operation, params map[string]string, r *http.Request, body []byte) []openapi.Violation {
+	var violations []openapi.Violation
+
+	qs := r.URL.Query()
+
+	for _, p := range op.Parameters {
+		var raw string
+		var present bool
+
+		switch p.In {
+		case "path":
+			raw, present = params[p.Name]
+		case "query":
+			raw, present = qs.Get(p.Name), qs.Has(p.Name)
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		}
+
+		switch {
+		case !present && p.Required:
+			violations = append(violations, openapi.Violation{Path: p.In + "." + p.Name, Message: "is required"})
+		case present:
+			violations = append(violations, doc.ValidateParameter(p, raw)...)
+		}
+	}
+
+	hasBody := r.ContentLength > 0 || len(body) > 0
+
+	switch {
+	case op.RequestBody == nil:
+		if hasBody {
+			violations = append(violations, openapi.Violation{Path: "body", Message: "is not expected"})
+		}
+		return violations
+	case !hasBody:
+		if op.RequestBody.Required {
+			violations = append(violations, openapi.Violation{Path: "body", Message: "is required"})
+		}
+		return violations
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	content, ok := op.RequestBody.Content[mediaType]
+	if !ok {
+		return append(violations, openapi.Violation{Path: "body", Message: fmt.Sprintf("content type %q is not expected", mediaType)})
+	}
+
+	if isJSONMediaType(mediaType) && content.Schema != nil {
+		var value any
+		if err := json.Unmarshal(body, &value); err != nil {
+			return append(violations, openapi.Violation{Path: "body", Message: "is not valid JSON"})
+		}
+		violations = append(violations, doc.Validate(content.Schema, value, "body")...)
+	}
+
+	return violations
+}
+
+func checkResponse(doc *openapi.Document, op *openapi.Operation, sw *specResponseWriter) []openapi.Violation {
+	resp := doc.Resolve(op.Responses[strconv.Itoa(sw.status)])
+	if resp == nil {
+		return []openapi.Violation{{Path: "status", Message: fmt.Sprintf("%d is not documented", sw.status)}}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(sw.Header().Get("Content-Type"))
+	if mediaType == "" && len(resp.Content) == 0 {
+		return nil
+	}
+
+	content, ok := resp.Content[mediaType]
+	if !ok {
+		content, ok = resp.Content["*/*"]
+	}
+	if !ok {
+		return []openapi.Violation{{Path: "body", Message: fmt.Sprintf("content type %q is not documented", mediaType)}}
+	}
+
+	if sw.truncated || content.Schema == nil {
+		return nil
+	}
+
+	switch {
+	case mediaType == "application/x-ndjson":
+		var violations []openapi.Violation
+		dec := json.NewDecoder(&sw.body)
+		for i := 0; ; i++ {
+			var value any
+			err := dec.Decode(&value)
+			if err == io.EOF {
+				return violations
+			}
+			if err != nil {
+				return append(violations, openapi.Violation{Path: fmt.Sprintf("body[%d]", i), Message: "is not valid JSON"})
+			}
+			violations = append(violations, doc.Validate(content.Schema, value, fmt.Sprintf("body[%d]", i))...)
+		}
+
+	case isJSONMediaType(mediaType):
+		var value any
+		if err := json.Unmarshal(sw.body.Bytes(), &value); err != nil {
+			return []openapi.Violation{{Path: "body", Message: "is not valid JSON"}}
+		}
+		return doc.Validate(content.Schema, value, "body")
+	}
+
+	return nil
+}
+
+// isJSONMediaType reports whether a Content-Type is JSON, including types such
+// as application/problem+json.
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || mediaType == "application/x-ndjson" || strings.HasSuffix(mediaType, "+json")
+}
+
+// specResponseWriter keeps a copy of JSON responses for validateOpenAPI, while
+// passing everything through as it is written.
+type specResponseWriter struct {
+	http.ResponseWriter
+	status        int
+	headerWritten bool
+	capture       bool
+	truncated     bool
+	body          bytes.Buffer
+}
+
+func (sw *specResponseWriter) WriteHeader(status int) {
+	if !sw.headerWritten {
+		sw.status = status
+		sw.headerWritten = true
+		sw.capture = isJSONMediaType(sw.Header().Get("Content-Type"))
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *specResponseWriter) Write(b []byte) (int, error) {
+	if !sw.headerWritten {
+		sw.WriteHeader(http.StatusOK)
+	}
+
+	if sw.capture && !sw.truncated {
+		if sw.body.Len()+len(b) > specMaxBodyBytes {
+			sw.truncated = true
+			sw.body.Reset()
+		} else {
+			sw.body.Write(b)
+		}
+	}
+
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *specResponseWriter) Flush() {
+	http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController and prettyJSON get at the underlying writer.
+func (sw *specResponseWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+// newCursorKey returns the key pagination cursors are signed with. Without a
+// configured secret a random key is made, so cursors only last until a restart.
+func newCursorKey(cfg config) []byte {
+	if cfg.cursors.secret != "" {
+		return []byte(cfg.cursors.secret)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+// readCursor reads the cursor from the query string, if there is one. Problems
+// with it are recorded in the validator.
+func (app *application) readCursor(qs url.Values, v *validator.Validator) *data.Cursor {
+	token := qs.Get("cursor")
+	if token == "" {
+		return nil
+	}
+
+	cursor, err := data.DecodeCursor(token, app.cursorKey)
+	if err != nil {
+		v.AddError("cursor", validator.CodeInvalid, "is not a valid cursor")
+		return nil
+	}
+
+	return &cursor
+}
+
+// setPageLinks turns the cursors in metadata into links to the next and previous
+// pages, which keep the rest of the query string. They are added to the metadata
+// and sent in a Link header as well.
+func (app *application) setPageLinks(w http.ResponseWriter, r *http.Request, metadata *data.Metadata) {
+	link := func(cursor *data.Cursor) string {
+		qs := r.URL.Query()
+		qs.Del("page")
+		qs.Set("cursor", cursor.Encode(app.cursorKey))
+		return workspacePath(r, r.URL.Path) + "?" + qs.Encode()
+	}
+
+	var links []string
+
+	if metadata.NextCursor != nil {
+		metadata.Next = link(metadata.NextCursor)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, metadata.Next))
+	}
+
+	if metadata.PrevCursor != nil {
+		metadata.Prev = link(metadata.PrevCursor)
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, metadata.Prev))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
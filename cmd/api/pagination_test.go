@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+func TestReadCursor(t *testing.T) {
+	app := &application{cursorKey: []byte("read cursor test key")}
+
+	valid := data.Cursor{Sort: "title", Value: "a", ID: 1}
+
+	tests := []struct {
+		name      string
+		token     string
+		wantValid bool
+	}{
+		{name: "valid", token: valid.Encode(app.cursorKey), wantValid: true},
+		{name: "no signature", token: "abc"},
+		{name: "bad signature", token: "abc.def"},
+		{name: "signed by another key", token: valid.Encode([]byte("another key"))},
+		{name: "garbage", token: "%%%.%%%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			cursor := app.readCursor(url.Values{"cursor": {tt.token}}, v)
+
+			if v.Valid() != tt.wantValid || (cursor != nil) != tt.wantValid {
+				t.Errorf("got cursor %v and errors %v, want valid to be %t", cursor, v.Errors, tt.wantValid)
+			}
+		})
+	}
+}
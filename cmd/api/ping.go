@@ -7,7 +7,6 @@ import (
 func (app *application) pingHandler(w http.ResponseWriter, r *http.Request) {
 	env := envelope{
 		"ping": "pong",
-		"foo":  "bar",
 	}
 
 	err := app.writeJSON(w, http.StatusOK, env, nil)
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// publicNoteHTML renders a shared note for people opening the link in a browser.
+var publicNoteHTML = template.Must(template.New("public-note").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; }
+pre { white-space: pre-wrap; font-family: inherit; }
+.meta, .tags { color: #666; font-size: 0.875rem; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Last updated {{.LastUpdateAt.Format "January 2, 2006 15:04 MST"}}</p>
+{{if .Tags}}<p class="tags">{{range $i, $tag := .Tags}}{{if $i}}, {{end}}#{{$tag}}{{end}}</p>{{end}}
+<pre>{{.Content}}</pre>
+</body>
+</html>
+`))
+
+func (app *application) createPublicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		ExpiresAt *time.Time `json:"expires_at"` // when the link stops working
+		MaxViews  *int       `json:"max_views"`  // how many times the link can be viewed
+		Password  string     `json:"password"`   // password needed to view the note
+	}
+
+	// every setting is optional, so an empty body makes a plain link
+	if r.ContentLength != 0 {
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	_, err = app.models.Notes.Get(r.Context(), noteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	link := &data.PublicLink{
+		NoteID:    noteID,
+		ExpiresAt: input.ExpiresAt,
+		MaxViews:  input.MaxViews,
+	}
+
+	v := validator.New()
+	if data.ValidatePublicLink(v, link, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = link.SetPassword(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.PublicLinks.Insert(r.Context(), link)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	url := fmt.Sprintf("/v1/public/%s", link.Token)
+
+	headers := make(http.Header)
+	headers.Set("Location", url)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"public_link": link, "url": url}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPublicLinksHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Notes.Get(r.Context(), noteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	links, err := app.models.PublicLinks.GetAllForNote(r.Context(), noteID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeList(w, r, "public_links", links, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePublicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	noteID, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "link_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.PublicLinks.Delete(r.Context(), noteID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "public link successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showPublicNoteHandler serves a shared note to anyone holding the token. Links
+// that are unknown, revoked, expired or out of views all look the same from the
+// outside. The password, if there is one, is taken from the X-Link-Password
+// header or the password part of basic auth so that browsers can prompt for it.
+// Too many wrong passwords in a row lock the link for a while, see
+// data.MaxPasswordFailures.
+func (app *application) showPublicNoteHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	// shared notes should never end up in caches, search engines or referrers
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	link, err := app.models.PublicLinks.GetByToken(r.Context(), params.ByName("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !link.Usable(time.Now()) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	password := r.Header.Get("X-Link-Password")
+	if password == "" {
+		_, password, _ = r.BasicAuth()
+	}
+
+	if link.HasPassword {
+		if link.Locked(time.Now()) {
+			app.tooManyPasswordAttemptsResponse(w, r, *link.LockedUntil)
+			return
+		}
+
+		// nothing to check, so it doesn't count as a wrong password
+		if password == "" {
+			app.passwordRequiredResponse(w, r, false)
+			return
+		}
+
+		err := app.models.PublicLinks.ClaimPasswordAttempt(r.Context(), link)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrLinkLocked):
+				// locked since it was read, by a guess sent at the same time
+				app.tooManyPasswordAttemptsResponse(w, r, time.Now().Add(data.PasswordLockout))
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	ok, err := link.PasswordMatches(password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.passwordRequiredResponse(w, r, password != "")
+		return
+	}
+
+	if link.HasPassword {
+		err := app.models.PublicLinks.PasswordAccepted(r.Context(), link)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// the token is all that's needed to read the note, whichever workspace it's in
+	note, err := app.models.Notes.Get(data.WithWorkspace(r.Context(), link.WorkspaceID), link.NoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.PublicLinks.RecordView(r.Context(), link)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if wantsHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+		w.WriteHeader(http.StatusOK)
+
+		if err := publicNoteHTML.Execute(w, note); err != nil {
+			app.logError(r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"note": note}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// wantsHTML reports whether the client asked for HTML, either with ?format=html
+// or by listing text/html ahead of application/json in its Accept header.
+func wantsHTML(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "html":
+		return true
+	case "json":
+		return false
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case "text/html":
+			return true
+		case "application/json":
+			return false
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPublicLinkPasswordLockout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	app := &application{models: data.NewModels(db), metrics: newAppMetrics(db)}
+	handler := app.routes()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := []string{"id", "note_id", "created_at", "token_hash", "expires_at", "max_views", "views",
+		"password_hash", "last_accessed_at", "locked_until", "workspace_id"}
+
+	expectLink := func(lockedUntil driver.Value) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM public_links")).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, 1, time.Now(), []byte("hash"), nil, nil, 0, hash, nil, lockedUntil, data.DefaultWorkspaceID))
+	}
+
+	get := func(password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/public/token", nil)
+		if password != "" {
+			r.Header.Set("X-Link-Password", password)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// no password is sent back for one without being counted as a wrong one
+	expectLink(nil)
+	if w := get(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a password got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// a wrong password is counted before it's checked
+	expectLink(nil)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE public_links")).
+		WithArgs(int64(1), data.MaxPasswordFailures, data.PasswordLockout.Seconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(nil))
+	if w := get("guess"); w.Code != http.StatusUnauthorized {
+		t.Errorf("with a wrong password got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// a locked link is turned away without looking at the password
+	expectLink(time.Now().Add(10 * time.Minute))
+	w := get("hunter2")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("while locked got %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After")); retryAfter < 590 || retryAfter > 600 {
+		t.Errorf("got Retry-After %q, want about 600", w.Header().Get("Retry-After"))
+	}
+
+	// guesses that lost the race to the one which locked the link
+	expectLink(nil)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE public_links")).
+		WillReturnRows(sqlmock.NewRows([]string{"locked_until"}))
+	if w := get("guess"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("when locked by another request got %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	// the right password clears the count
+	expectLink(nil)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE public_links")).
+		WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(nil))
+	mock.ExpectExec(regexp.QuoteMeta("SET failed_attempts = 0, locked_until = NULL")).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM notes WHERE id = $1 AND workspace_id = $2")).
+		WillReturnRows(sqlmock.NewRows(testNoteColumns).AddRow(testNoteRow(1, "Shared", 1)...))
+	mock.ExpectQuery(regexp.QuoteMeta("SET views = views + 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"views", "last_accessed_at"}).AddRow(1, time.Now()))
+	if w := get("hunter2"); w.Code != http.StatusOK {
+		t.Errorf("with the right password got %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/notify"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+func (app *application) listRemindersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Before *time.Time
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	// ?before= limits the listing to reminders due before a RFC 3339 time
+	if before := app.readString(qs, "before", ""); before != "" {
+		t, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			v.AddError("before", validator.CodeInvalidFormat, "must be a RFC 3339 time")
+		}
+		input.Before = &t
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "remind_at")
+	input.Filters.SortSafelist = []string{"remind_at", "-remind_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	reminders, metadata, err := app.models.Reminders.GetUpcoming(r.Context(), input.Before, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeList(w, r, "reminders", reminders, &metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reminderStreamBuffer is how many reminders can queue up for a stream before the
+// client is too far behind and the stream is ended, and reminderStreamKeepAlive
+// is how often a comment is sent down an idle stream so proxies don't close it.
+const (
+	reminderStreamBuffer    = 64
+	reminderStreamKeepAlive = 30 * time.Second
+)
+
+// streamRemindersHandler sends the reminders in the workspace as they fire, as
+// server-sent events. Only the reminders fired by this instance's scheduler are
+// seen, since the event bus is in-process.
+func (app *application) streamRemindersHandler(w http.ResponseWriter, r *http.Request) {
+	reminders, unsubscribe := app.events.Subscribe(reminderStreamBuffer)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+
+	// the stream is open for as long as the client wants, not just the server's
+	// WriteTimeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	workspaceID := data.WorkspaceID(r.Context())
+
+	keepAlive := time.NewTicker(reminderStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case reminder, ok := <-reminders:
+			// the client fell behind, and an EventSource reconnects by itself
+			if !ok {
+				return
+			}
+
+			if reminder.WorkspaceID != workspaceID {
+				continue
+			}
+
+			js, err := json.Marshal(reminder)
+			if err != nil {
+				app.logError(r, err)
+				return
+			}
+
+			fmt.Fprintf(w, "event: reminder\ndata: %s\n\n", js)
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Fired reminders are queued for each sink and sent by the scheduler once the
+// notes are updated. A failed delivery is retried with backoff, on its own.
+const (
+	deliveryTimeout     = 30 * time.Second
+	deliveryBatchSize   = 10
+	maxDeliveryAttempts = 8
+	maxDeliveryBackoff  = time.Hour
+
+	// how long a claimed batch is held back from other schedulers, which is
+	// comfortably longer than sending every delivery in it can take
+	deliveryLease = deliveryBatchSize*deliveryTimeout + time.Minute
+)
+
+// runReminderScheduler polls for due reminders every interval until ctx is done,
+// and sends them to each of the application's sinks. It beats wk after every poll,
+// and reports progress after every batch and delivery along the way, so the
+// readiness check can tell if it gets stuck but not mistake a long backlog for it.
+func (app *application) runReminderScheduler(ctx context.Context, wk *worker) {
+	// reminders moving on to their next occurrence show up in the audit log as
+	// changes made by the scheduler
+	ctx = data.WithAuditSource(ctx, data.AuditSource{Actor: "reminder-scheduler"})
+
+	ticker := time.NewTicker(app.config.reminders.interval)
+	defer ticker.Stop()
+
+	sinks := notify.Names(app.sinks)
+
+	for {
+		var pollErr error
+
+		// keep going until a batch comes back short, so a backlog of due reminders
+		// is worked through without waiting on the ticker each time
+		for {
+			fired, err := app.models.Reminders.FireDue(ctx, time.Now(), app.config.reminders.batchSize, sinks)
+			if err != nil {
+				app.logError(nil, err)
+				pollErr = err
+				break
+			}
+
+			for _, reminder := range fired {
+				app.events.Publish(*reminder)
+			}
+
+			wk.Progress()
+
+			if len(fired) < app.config.reminders.batchSize {
+				break
+			}
+		}
+
+		if err := app.deliverReminders(ctx, wk, sinks); err != nil {
+			app.logError(nil, err)
+			pollErr = err
+		}
+
+		wk.Beat(pollErr)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverReminders sends the queued deliveries which are due to be attempted. A
+// delivery which fails is logged and retried later, and only database errors are
+// returned.
+func (app *application) deliverReminders(ctx context.Context, wk *worker, sinks []string) error {
+	for {
+		deliveries, err := app.models.Reminders.ClaimDeliveries(ctx, time.Now(), deliveryBatchSize, sinks, deliveryLease)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range deliveries {
+			if err := app.deliverReminder(ctx, d); err != nil {
+				return err
+			}
+
+			wk.Progress()
+		}
+
+		if len(deliveries) < deliveryBatchSize {
+			return nil
+		}
+	}
+}
+
+func (app *application) deliverReminder(ctx context.Context, d *data.ReminderDelivery) error {
+	var notifier notify.Notifier
+	for _, sink := range app.sinks {
+		if sink.Name == d.Sink {
+			notifier = sink.Notifier
+		}
+	}
+
+	notifyCtx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	sendErr := notifier.Notify(notifyCtx, d.Reminder)
+	if sendErr == nil {
+		return app.models.Reminders.DeliverySent(ctx, d.ID)
+	}
+
+	app.logError(nil, fmt.Errorf("reminder for note %d to %s, attempt %d: %w", d.Reminder.NoteID, d.Sink, d.Attempts, sendErr))
+
+	var retryAt *time.Time
+	if d.Attempts < maxDeliveryAttempts {
+		backoff := min(30*time.Second<<(d.Attempts-1), maxDeliveryBackoff)
+		t := time.Now().Add(backoff)
+		retryAt = &t
+	}
+
+	return app.models.Reminders.DeliveryFailed(ctx, d.ID, sendErr, retryAt)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/notify"
+)
+
+func TestStreamReminders(t *testing.T) {
+	app := &application{metrics: newAppMetrics(nil), events: notify.NewBus()}
+
+	srv := httptest.NewServer(app.routes())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/reminders/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got Content-Type %q, want text/event-stream", ct)
+	}
+
+	// the stream has subscribed by the time the headers arrive
+	remindAt := time.Date(2024, time.July, 1, 9, 0, 0, 0, time.UTC)
+	app.events.Publish(data.Reminder{NoteID: 8, Title: "Elsewhere", RemindAt: remindAt, Occurrence: 1, WorkspaceID: data.DefaultWorkspaceID + 1})
+	app.events.Publish(data.Reminder{NoteID: 7, Title: "Standup", RemindAt: remindAt, Occurrence: 1, WorkspaceID: data.DefaultWorkspaceID})
+
+	sc := bufio.NewScanner(resp.Body)
+
+	var lines []string
+	for sc.Scan() && sc.Text() != "" {
+		lines = append(lines, sc.Text())
+	}
+
+	want := []string{
+		"event: reminder",
+		`data: {"note_id":7,"title":"Standup","remind_at":"2024-07-01T09:00:00Z","occurrence":1}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got event:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
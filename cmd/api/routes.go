@@ -1,24 +1,100 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
-
-	"github.com/julienschmidt/httprouter"
 )
 
 func (app *application) routes() http.Handler {
-	router := httprouter.New()
+	router := newInstrumentedRouter()
+
+	// send our own JSON responses for unknown routes and methods
+	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 
 	// a route to handle 405 METHOD NOT ALLOWED response
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
+	doc := app.openAPIDocument()
+
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openAPIHandler(doc))
+	router.HandlerFunc(http.MethodGet, "/v1/docs", app.docsHandler)
+
 	router.HandlerFunc(http.MethodGet, "/v1/ping", app.pingHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/live", app.livenessHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/ready", app.readinessHandler)
 
+	router.HandlerFunc(http.MethodGet, "/v1/notes", app.listNotesHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/notes", app.createNoteHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/notes/:id", app.showNoteHandler)
 	router.HandlerFunc(http.MethodPatch, "/v1/notes/:id", app.updateNoteHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id", app.deleteNoteHandler)
 
-	return router
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/items", app.listItemsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/items", app.createItemHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/notes/:id/items/order", app.reorderItemsHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/notes/:id/items/:item_id", app.updateItemHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/items/:item_id/toggle", app.toggleItemHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id/items/:item_id", app.deleteItemHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/tasks", app.listTasksHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/public-links", app.listPublicLinksHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/public-links", app.createPublicLinkHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id/public-links/:link_id", app.deletePublicLinkHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/public/:token", app.showPublicNoteHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/templates", app.listTemplatesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/templates", app.createTemplateHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/templates/:id", app.showTemplateHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/templates/:id", app.updateTemplateHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/templates/:id", app.deleteTemplateHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/reminders", app.listRemindersHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/reminders/stream", app.streamRemindersHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/links", app.listLinksHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/backlinks", app.listBacklinksHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/graph", app.showGraphHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/graphql", app.graphqlHandler())
+
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/attachments", app.listAttachmentsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/attachments", app.createAttachmentHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/attachments/:attachment_id", app.showAttachmentHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id/attachments/:attachment_id", app.deleteAttachmentHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/import", app.createImportHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/import/:job", app.showImportHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces", app.createWorkspaceHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:ws", app.showWorkspaceHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:ws", app.deleteWorkspaceHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:ws/members", app.listMembersHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/workspaces/:ws/members/:member_id", app.updateMemberHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:ws/members/:member_id", app.deleteMemberHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:ws/invitations", app.listInvitationsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces/:ws/invitations", app.createInvitationHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:ws/invitations/:invitation_id", app.deleteInvitationHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/invitations/accept", app.acceptInvitationHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/activity", app.listNoteActivityHandler)
+	if app.config.audit.password != "" {
+		router.HandlerFunc(http.MethodGet, "/v1/audit", app.requireAuditAuth(http.HandlerFunc(app.listAuditEventsHandler)))
+	}
+
+	if app.config.metrics.enabled {
+		router.HandlerFunc(http.MethodGet, "/debug/metrics", app.requireMetricsAuth(http.HandlerFunc(app.metricsHandler)))
+		router.Handler(http.MethodGet, "/debug/vars", app.requireMetricsAuth(expvar.Handler()))
+	}
+
+	var handler http.Handler = router
+	if app.config.env == "development" && app.config.openAPI.validate {
+		handler = app.validateOpenAPI(doc, router)
+	}
+
+	// workspace prefixes come off before the path is routed or checked against the
+	// document, and idempotency keys are kept per workspace
+	handler = app.workspaceScope(app.idempotent(handler))
+
+	return app.requestID(app.auditSource(app.strictTransportSecurity(app.enableCORS(router.allowedMethods(), app.compress(app.jsonFormat(app.recordMetrics(app.traceRequests(handler))))))))
 }
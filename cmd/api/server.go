@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// serve runs the API until the server fails. With a certificate configured it is
+// served over HTTPS (and HTTP/2), optionally alongside a plain HTTP listener that
+// redirects to it. The gRPC API runs next to it when a grpc-port is set.
+func (app *application) serve() error {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.routes(),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	if app.config.tls.certFile != "" {
+		certs, err := newCertReloader(app.config.tls.certFile, app.config.tls.keyFile)
+		if err != nil {
+			return err
+		}
+
+		wk := app.workers.Register("tls-cert-reloader", app.config.tls.reloadInterval)
+		go certs.watch(context.Background(), app.config.tls.reloadInterval, wk, func(err error) {
+			app.logError(nil, err)
+		})
+
+		srv.TLSConfig = newTLSConfig(certs)
+	}
+
+	if app.config.grpc.port != 0 {
+		grpcSrv := app.newGRPCServer(srv.TLSConfig)
+
+		go func() {
+			if err := app.serveGRPC(grpcSrv); err != nil {
+				app.logError(nil, err)
+			}
+		}()
+	}
+
+	if srv.TLSConfig == nil {
+		fmt.Printf("Launching %s server on port %d...\n", app.config.env, app.config.port)
+		return srv.ListenAndServe()
+	}
+
+	if app.config.tls.redirectPort != 0 {
+		redirect := &http.Server{
+			Addr:         fmt.Sprintf(":%d", app.config.tls.redirectPort),
+			Handler:      http.HandlerFunc(app.redirectToHTTPS),
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 5 * time.Second,
+		}
+
+		go func() {
+			fmt.Printf("Redirecting HTTP on port %d to HTTPS...\n", app.config.tls.redirectPort)
+			if err := redirect.ListenAndServe(); err != nil {
+				app.logError(nil, err)
+			}
+		}()
+	}
+
+	fmt.Printf("Launching %s server with TLS on port %d...\n", app.config.env, app.config.port)
+
+	// the certificate comes from TLSConfig, so no files are passed here
+	return srv.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+func (app *application) listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := app.models.Templates.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeList(w, r, "templates", templates, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string   `json:"name"`    // name of the template
+		Title   string   `json:"title"`   // template for the title of new notes
+		Content string   `json:"content"` // template for the content of new notes
+		Tags    []string `json:"tags"`    // templates for the default tags of new notes
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	t := &data.Template{
+		Name:    input.Name,
+		Title:   input.Title,
+		Content: input.Content,
+		Tags:    input.Tags,
+	}
+
+	v := validator.New()
+	if data.ValidateTemplate(v, t); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Templates.Insert(r.Context(), t)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", workspacePath(r, fmt.Sprintf("/v1/templates/%d", t.ID)))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"template": t}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	t, err := app.models.Templates.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"template": t}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	t, err := app.models.Templates.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name    *string  `json:"name"`
+		Title   *string  `json:"title"`
+		Content *string  `json:"content"`
+		Tags    []string `json:"tags"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		t.Name = *input.Name
+	}
+
+	if input.Title != nil {
+		t.Title = *input.Title
+	}
+
+	if input.Content != nil {
+		t.Content = *input.Content
+	}
+
+	if input.Tags != nil {
+		t.Tags = input.Tags
+	}
+
+	v := validator.New()
+	if data.ValidateTemplate(v, t); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Templates.Update(r.Context(), t)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"template": t}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Templates.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "template successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createNoteFromTemplateHandler handles POST /v1/notes?template=:id. The body is
+// optional, and can hold values for the template along with tags to add on top
+// of the template's defaults.
+func (app *application) createNoteFromTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("template"), 10, 64)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, errors.New("template must be a positive integer"))
+		return
+	}
+
+	var input struct {
+		Values map[string]string `json:"values"` // values for the template's variables
+		Tags   []string          `json:"tags"`   // tags to add on top of the defaults
+	}
+
+	// an empty body is fine here, since a template might not need any values
+	if r.ContentLength != 0 {
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateTemplateValues(v, input.Values); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	t, err := app.models.Templates.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	counter, err := app.models.Templates.NextCounter(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the user is the member making the request, and the default workspace has no
+	// members to go by
+	user := "anonymous"
+	if member := memberFromContext(r.Context()); member != nil {
+		user = member.Email
+	}
+
+	note, err := t.Render(counter, user, input.Values, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTemplateRender):
+			v.AddError("template", validator.CodeInvalid, err.Error())
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	note.Tags = append(note.Tags, input.Tags...)
+
+	if data.ValidateNote(v, note); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Notes.Insert(r.Context(), note)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.noteCreated(note)
+
+	headers := make(http.Header)
+	headers.Set("Location", workspacePath(r, fmt.Sprintf("/v1/notes/%d", note.ID)))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"note": note}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves a certificate loaded from disk, and loads it again whenever
+// the files change so that renewed certificates are picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the certificate and key, failing if they can't be used.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+
+	if _, err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	return cr.cert, nil
+}
+
+// reload loads the files again if either of them has been modified since the last
+// load, reporting whether it did. A pair that fails to load leaves the current
+// certificate in place, since renewals often write the two files one at a time.
+func (cr *certReloader) reload() (bool, error) {
+	modTime, err := latestModTime(cr.certFile, cr.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	cr.mu.RLock()
+	unchanged := cr.cert != nil && modTime.Equal(cr.modTime)
+	cr.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.modTime = modTime
+	cr.mu.Unlock()
+
+	return true, nil
+}
+
+// watch checks the files for changes every interval until ctx is done, beating wk
+// each time.
+func (cr *certReloader) watch(ctx context.Context, interval time.Duration, wk *worker, logError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := cr.reload()
+		if err != nil {
+			logError(err)
+		} else if reloaded {
+			fmt.Printf("reloaded TLS certificate from %s\n", cr.certFile)
+		}
+
+		wk.Beat(err)
+	}
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// newTLSConfig returns the TLS settings for the server. Only TLS 1.2 and up are
+// accepted, and the TLS 1.2 cipher suites are limited to those with forward
+// secrecy and AEAD. HTTP/2 is turned on by net/http itself.
+func newTLSConfig(cr *certReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		GetCertificate:   cr.GetCertificate,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+}
+
+// redirectToHTTPS sends every request on to the same URL over HTTPS, on the port
+// the main server is listening on.
+func (app *application) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+
+	if app.config.port != 443 {
+		host = net.JoinHostPort(host, fmt.Sprint(app.config.port))
+	}
+
+	target := "https://" + host + r.URL.RequestURI()
+
+	// 308 rather than 301 so the method and body of the request are kept
+	http.Redirect(w, r, target, http.StatusPermanentRedirect)
+}
+
+// strictTransportSecurity tells browsers to only ever use HTTPS for this host. It's
+// only sent in production, so that a self-signed certificate used while developing
+// doesn't get stuck in a browser.
+func (app *application) strictTransportSecurity(next http.Handler) http.Handler {
+	if app.config.tls.certFile == "" || app.config.env != "production" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		next.ServeHTTP(w, r)
+	})
+}
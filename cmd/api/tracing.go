@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is used for the spans started by the handlers and middleware. Spans for
+// the database are started by the data package.
+var tracer = otel.Tracer("github.com/KevuTheDev/notes-backend-api/cmd/api")
+
+// setupTracing registers the tracer provider and W3C trace context propagator
+// picked with the -trace-* flags. The returned function flushes any spans that
+// are still buffered and must be called before exiting.
+func setupTracing(cfg config) (func(context.Context) error, error) {
+	// incoming traceparent headers are honoured even when tracing is off, so the
+	// ids still make it to any services we call
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+
+	switch cfg.tracing.exporter {
+	case "none", "":
+		return func(context.Context) error { return nil }, nil
+
+	case "stdout":
+		var err error
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+
+	case "file":
+		f, err := os.OpenFile(cfg.tracing.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		closeFile = f.Close
+
+		// one span per line, so the file can be read back as JSON lines
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+	case "otlp":
+		// options left unset are read by the exporter from the standard
+		// OTEL_EXPORTER_OTLP_* environment variables
+		var opts []otlptracehttp.Option
+		if cfg.tracing.otlpEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.tracing.otlpEndpoint))
+		}
+		if cfg.tracing.otlpInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		var err error
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.tracing.exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", "notes-backend-api"),
+		attribute.String("service.version", version),
+		attribute.String("deployment.environment", cfg.env),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(5*time.Second)),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.tracing.sampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	shutdown := func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeFile != nil {
+			err = errors.Join(err, closeFile())
+		}
+		return err
+	}
+
+	return shutdown, nil
+}
+
+// traceRequests starts a server span for every request, continuing the trace from
+// the traceparent header if the client sent one. The span is named after the
+// route pattern, which is only known once the router has run, so this has to sit
+// inside recordMetrics.
+func (app *application) traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("user_agent.original", r.UserAgent()),
+				attribute.String("http.request.id", requestIDFromContext(r.Context())),
+			),
+		)
+		defer span.End()
+
+		mw := &metricsResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next.ServeHTTP(mw, r.WithContext(ctx))
+
+		if route, ok := r.Context().Value(routeContextKey).(*string); ok {
+			span.SetName(r.Method + " " + *route)
+			span.SetAttributes(attribute.String("http.route", *route))
+		}
+
+		span.SetAttributes(attribute.Int("http.response.status_code", mw.statusCode))
+		if mw.statusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(mw.statusCode))
+		}
+	})
+}
+
+// endSpan marks span as failed if err is set, then ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// worker is a long running background task that reports in with a heartbeat each
+// time it goes around its loop. It is considered stuck if it misses a few beats.
+type worker struct {
+	name     string
+	interval time.Duration
+
+	mu       sync.Mutex
+	lastBeat time.Time
+	lastErr  string
+}
+
+// Beat records that the worker is still making progress. err is the error from
+// the last round of work, if any, and is shown in the readiness report.
+func (wk *worker) Beat(err error) {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+
+	wk.lastBeat = time.Now()
+	wk.lastErr = ""
+	if err != nil {
+		wk.lastErr = err.Error()
+	}
+}
+
+// Progress records that the worker is still making progress partway through a
+// round of work, without changing the error shown for the last round. Workers
+// with rounds that can run longer than their interval call it as they go, so
+// they aren't reported as stuck while they work.
+func (wk *worker) Progress() {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+
+	wk.lastBeat = time.Now()
+}
+
+// workerStatus is the readiness report for a single worker.
+type workerStatus struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	LastBeat  time.Time `json:"last_beat"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+func (wk *worker) status(now time.Time) workerStatus {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+
+	status := workerStatus{
+		Name:      wk.name,
+		Status:    statusOK,
+		LastBeat:  wk.lastBeat,
+		LastError: wk.lastErr,
+	}
+
+	// give the worker three intervals before calling it stuck, so one slow round
+	// doesn't fail the readiness check
+	if now.Sub(wk.lastBeat) > 3*wk.interval {
+		status.Status = statusDegraded
+	}
+
+	return status
+}
+
+// workerRegistry keeps track of the background workers so the readiness check
+// can see whether they are still alive.
+type workerRegistry struct {
+	mu      sync.Mutex
+	workers map[string]*worker
+}
+
+func newWorkerRegistry() *workerRegistry {
+	return &workerRegistry{workers: make(map[string]*worker)}
+}
+
+// Register adds a worker that is expected to beat at least once per interval. It
+// starts off with a beat, so it isn't reported as stuck before it gets going.
+func (reg *workerRegistry) Register(name string, interval time.Duration) *worker {
+	wk := &worker{name: name, interval: interval, lastBeat: time.Now()}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.workers[name] = wk
+
+	return wk
+}
+
+// Statuses returns a report for every registered worker, sorted by name.
+func (reg *workerRegistry) Statuses() []workerStatus {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]workerStatus, 0, len(reg.workers))
+
+	for _, wk := range reg.workers {
+		statuses = append(statuses, wk.status(now))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	return statuses
+}
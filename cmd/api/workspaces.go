@@ -0,0 +1,664 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// workspaceScopedPaths are the first parts of the paths, after /v1/, which work
+// on the notes or templates of a workspace. Each can be reached under /v1/workspaces/:ws/ as
+// well as with the X-Workspace header.
+var workspaceScopedPaths = []string{"notes", "tasks", "reminders", "graph", "graphql", "import", "templates"}
+
+var (
+	errInvalidToken = errors.New("invalid or missing workspace member token")
+	errForbidden    = errors.New("role does not allow this")
+)
+
+// memberContextKey holds the member making a request to a workspace. Requests to
+// the default workspace don't have one.
+const memberContextKey = contextKey("workspace_member")
+
+// workspacePrefixContextKey holds the /v1/workspaces/:ws prefix that was taken
+// off a request's path before it was routed, if it had one.
+const workspacePrefixContextKey = contextKey("workspace_prefix")
+
+func memberFromContext(ctx context.Context) *data.Member {
+	member, _ := ctx.Value(memberContextKey).(*data.Member)
+	return member
+}
+
+// roleFromContext returns the role of whoever is making a request. Anyone can
+// read and write the notes in the default workspace, so they are treated as an
+// editor of it.
+func roleFromContext(ctx context.Context) string {
+	if member := memberFromContext(ctx); member != nil {
+		return member.Role
+	}
+	return data.RoleEditor
+}
+
+// workspaceScope picks the workspace that a request's notes are read from and
+// written to, from a /v1/workspaces/:ws/ prefix on the path or else from the
+// X-Workspace header, and checks the member token sent with it. The prefix is
+// taken off before the request is routed, so /v1/workspaces/design/notes is
+// served by the same handler as /v1/notes. Requests which pick neither use the
+// default workspace.
+//
+// Checklist items, attachments and public links are looked up by id within
+// their note, so the note itself is checked to be in the workspace first.
+func (app *application) workspaceScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ref := r.Header.Get("X-Workspace")
+		prefix := ""
+
+		if prefixRef, rest, ok := splitWorkspacePath(r.URL.Path); ok {
+			ref = prefixRef
+			prefix = "/v1/workspaces/" + url.PathEscape(prefixRef)
+
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = rest
+			r2.URL.RawPath = ""
+			r = r2
+		}
+
+		if !isWorkspaceScoped(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		if prefix != "" {
+			ctx = context.WithValue(ctx, workspacePrefixContextKey, prefix)
+		}
+
+		if ref != "" {
+			min := data.RoleEditor
+			// GraphQL mutations check for themselves, since they come in as a POST
+			// like every other query
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.URL.Path == "/v1/graphql" {
+				min = data.RoleViewer
+			}
+
+			ws, member, err := app.authorizeWorkspace(ctx, ref, bearerToken(r), min)
+			if err != nil {
+				app.workspaceErrorResponse(w, r, err)
+				return
+			}
+
+			ctx = data.WithWorkspace(ctx, ws.ID)
+			if member != nil {
+				ctx = context.WithValue(ctx, memberContextKey, member)
+				ctx = data.WithAuditActor(ctx, member.Email)
+			}
+		}
+
+		if noteID, ok := noteSubresource(r.URL.Path); ok {
+			_, err := app.models.Notes.Get(ctx, noteID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.notFoundResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// workspacePath returns path, a /v1/ path as the router sees it, under the
+// /v1/workspaces/:ws prefix the request came in with. Links and Location headers
+// are built with it, so that following them stays in the same workspace.
+func workspacePath(r *http.Request, path string) string {
+	prefix, ok := r.Context().Value(workspacePrefixContextKey).(string)
+	if !ok {
+		return path
+	}
+
+	return prefix + strings.TrimPrefix(path, "/v1")
+}
+
+// splitWorkspacePath splits /v1/workspaces/:ws/rest into :ws and /v1/rest, as
+// long as rest is one of the workspaceScopedPaths.
+func splitWorkspacePath(path string) (string, string, bool) {
+	after, ok := strings.CutPrefix(path, "/v1/workspaces/")
+	if !ok {
+		return "", "", false
+	}
+
+	ref, rest, ok := strings.Cut(after, "/")
+	if !ok || ref == "" || !isWorkspaceScoped("/v1/"+rest) {
+		return "", "", false
+	}
+
+	return ref, "/v1/" + rest, true
+}
+
+func isWorkspaceScoped(path string) bool {
+	after, ok := strings.CutPrefix(path, "/v1/")
+	if !ok {
+		return false
+	}
+
+	first, _, _ := strings.Cut(after, "/")
+	for _, scoped := range workspaceScopedPaths {
+		if first == scoped {
+			return true
+		}
+	}
+
+	return false
+}
+
+// noteSubresource returns the note id of paths below a note, such as
+// /v1/notes/7/items.
+func noteSubresource(path string) (int64, bool) {
+	after, ok := strings.CutPrefix(path, "/v1/notes/")
+	if !ok {
+		return 0, false
+	}
+
+	idPart, rest, ok := strings.Cut(after, "/")
+	if !ok || rest == "" {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header, if any.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authorizeWorkspace looks up the workspace picked by ref, which is its id or
+// slug, and the member holding token, and checks their role is at least min.
+// Anyone is an editor of the default workspace, with or without a token.
+func (app *application) authorizeWorkspace(ctx context.Context, ref, token, min string) (*data.Workspace, *data.Member, error) {
+	ws, err := app.models.Workspaces.Get(ctx, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ws.ID == data.DefaultWorkspaceID {
+		if !data.RoleAtLeast(data.RoleEditor, min) {
+			return nil, nil, errForbidden
+		}
+		return ws, nil, nil
+	}
+
+	if token == "" {
+		return nil, nil, errInvalidToken
+	}
+
+	member, err := app.models.Members.GetByToken(ctx, ws.ID, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil, errInvalidToken
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if !data.RoleAtLeast(member.Role, min) {
+		return nil, nil, errForbidden
+	}
+
+	return ws, member, nil
+}
+
+// workspaceErrorResponse sends the response for an error from authorizeWorkspace.
+func (app *application) workspaceErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, errInvalidToken):
+		app.invalidTokenResponse(w, r)
+	case errors.Is(err, errForbidden):
+		app.forbiddenResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// workspaceFromParams authorizes a request to the workspace in its :ws parameter,
+// sending an error response and returning false if it isn't allowed. The
+// member's email is recorded as the actor of any changes.
+func (app *application) workspaceFromParams(w http.ResponseWriter, r *http.Request, min string) (*http.Request, *data.Workspace, *data.Member, bool) {
+	ref := httprouter.ParamsFromContext(r.Context()).ByName("ws")
+
+	ws, member, err := app.authorizeWorkspace(r.Context(), ref, bearerToken(r), min)
+	if err != nil {
+		app.workspaceErrorResponse(w, r, err)
+		return nil, nil, nil, false
+	}
+
+	if member != nil {
+		r = r.WithContext(data.WithAuditActor(r.Context(), member.Email))
+	}
+
+	return r, ws, member, true
+}
+
+func (app *application) createWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name  string `json:"name"`  // name of the workspace
+		Slug  string `json:"slug"`  // short name used in URLs
+		Email string `json:"email"` // email address of the owner
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ws := &data.Workspace{Name: input.Name, Slug: strings.ToLower(input.Slug)}
+	owner := &data.Member{Email: strings.ToLower(input.Email)}
+
+	v := validator.New()
+	data.ValidateWorkspace(v, ws)
+	if data.ValidateMemberEmail(v, owner.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx := data.WithAuditActor(r.Context(), owner.Email)
+
+	err = app.models.Workspaces.Insert(ctx, ws, owner)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", validator.CodeDuplicate, "a workspace with this slug already exists")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%s", ws.Slug))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"workspace": ws, "member": owner}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	r, ws, _, ok := app.workspaceFromParams(w, r, data.RoleViewer)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"workspace": ws}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWorkspaceHandler deletes a workspace along with all of its notes. The
+// blobs of their attachments are left in storage.
+func (app *application) deleteWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	r, ws, _, ok := app.workspaceFromParams(w, r, data.RoleOwner)
+	if !ok {
+		return
+	}
+
+	err := app.models.Workspaces.Delete(r.Context(), ws.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "workspace successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listMembersHandler(w http.ResponseWriter, r *http.Request) {
+	r, ws, _, ok := app.workspaceFromParams(w, r, data.RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := app.models.Members.GetAllForWorkspace(r.Context(), ws.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateMemberHandler changes the role of a member. Only owners can make someone
+// an owner or change the role of another owner.
+func (app *application) updateMemberHandler(w http.ResponseWriter, r *http.Request) {
+	r, ws, caller, ok := app.workspaceFromParams(w, r, data.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "member_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	member, err := app.models.Members.Get(r.Context(), ws.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"` // new role of the member
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateRole(v, input.Role); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	if (member.Role == data.RoleOwner || input.Role == data.RoleOwner) && caller.Role != data.RoleOwner {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	member.Role = input.Role
+
+	err = app.models.Members.UpdateRole(r.Context(), member)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLastOwner):
+			v.AddError("role", validator.CodeInvalid, "the workspace must keep at least one owner")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteMemberHandler removes a member from a workspace. Admins can remove anyone
+// but an owner, and any member can remove themselves to leave the workspace.
+func (app *application) deleteMemberHandler(w http.ResponseWriter, r *http.Request) {
+	r, ws, caller, ok := app.workspaceFromParams(w, r, data.RoleViewer)
+	if !ok {
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "member_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	member, err := app.models.Members.Get(r.Context(), ws.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	leaving := caller != nil && caller.ID == member.ID
+	if !leaving {
+		min := data.RoleAdmin
+		if member.Role == data.RoleOwner {
+			min = data.RoleOwner
+		}
+
+		if caller == nil || !data.RoleAtLeast(caller.Role, min) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+
+	err = app.models.Members.Delete(r.Context(), ws.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLastOwner):
+			v := validator.New()
+			v.AddError("member", validator.CodeInvalid, "the workspace must keep at least one owner")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	r, ws, _, ok := app.workspaceFromParams(w, r, data.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	invitations, err := app.models.Invitations.GetPending(r.Context(), ws.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"invitations": invitations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createInvitationHandler invites someone to a workspace by email. The token is
+// emailed to them when an SMTP host is set, and otherwise is handed back in the
+// response for the admin to pass on.
+func (app *application) createInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	r, ws, caller, ok := app.workspaceFromParams(w, r, data.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"` // email address to send the invitation to
+		Role  string `json:"role"`  // role given when the invitation is accepted
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	inv := &data.Invitation{
+		WorkspaceID: ws.ID,
+		Email:       strings.ToLower(input.Email),
+		Role:        input.Role,
+		ExpiresAt:   time.Now().Add(app.config.invitations.ttl).Truncate(time.Second),
+	}
+
+	v := validator.New()
+	data.ValidateMemberEmail(v, inv.Email)
+	if data.ValidateRole(v, inv.Role); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	if inv.Role == data.RoleOwner && caller.Role != data.RoleOwner {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	err = app.models.Invitations.Insert(r.Context(), inv)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if app.mailer != nil {
+		app.sendInvitation(ws, inv)
+		inv.Token = ""
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"invitation": inv}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// sendInvitation emails an invitation in the background. A failure is only
+// logged, and the invitation can be deleted and sent again.
+func (app *application) sendInvitation(ws *data.Workspace, inv *data.Invitation) {
+	subject := fmt.Sprintf("You're invited to %s", ws.Name)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "You've been invited to join the %q workspace with the %s role.\r\n", ws.Name, inv.Role)
+	fmt.Fprintf(&body, "\r\nTo accept, POST this token to /v1/invitations/accept before %s:\r\n", inv.ExpiresAt.Format(time.RFC1123))
+	fmt.Fprintf(&body, "\r\n%s\r\n", inv.Token)
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := app.mailer.Send(ctx, inv.Email, subject, body.String()); err != nil {
+			app.logError(nil, fmt.Errorf("sending invitation %d: %w", inv.ID, err))
+		}
+	})
+}
+
+func (app *application) deleteInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	r, ws, _, ok := app.workspaceFromParams(w, r, data.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "invitation_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Invitations.Delete(r.Context(), ws.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "invitation successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// acceptInvitationHandler turns an invitation token into a member token. No other
+// credentials are needed, since holding the token shows the email was received.
+func (app *application) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"` // token from the invitation email
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Token != "", "token", validator.CodeRequired, "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	member, err := app.models.Invitations.Accept(r.Context(), input.Token, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("token", validator.CodeInvalid, "the invited email address is already a member of the workspace")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ws, err := app.models.Workspaces.Get(r.Context(), strconv.FormatInt(member.WorkspaceID, 10))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"workspace": ws, "member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
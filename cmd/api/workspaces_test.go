@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+func TestWorkspacePrefixKeptInLinks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	app := &application{models: data.NewModels(db), cursorKey: []byte("links test cursor key")}
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		wantPrefix string
+	}{
+		{name: "path prefix", path: "/v1/workspaces/1/notes?sort=title&page=2", wantPrefix: "/v1/workspaces/1/notes"},
+		{name: "header", path: "/v1/notes?sort=title&page=2", header: "1", wantPrefix: "/v1/notes"},
+		{name: "default workspace", path: "/v1/notes?sort=title&page=2", wantPrefix: "/v1/notes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.HasPrefix(tt.path, "/v1/workspaces/") || tt.header != "" {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM workspaces")).
+					WithArgs(data.DefaultWorkspaceID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "slug"}).
+						AddRow(data.DefaultWorkspaceID, time.Now(), "Default", "default"))
+			}
+
+			var location string
+			metadata := data.Metadata{
+				NextCursor: &data.Cursor{Sort: "title", Value: "b", ID: 2},
+				PrevCursor: &data.Cursor{Sort: "title", Value: "a", ID: 1, Before: true},
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/notes" {
+					t.Errorf("routed as %s, want /v1/notes", r.URL.Path)
+				}
+				app.setPageLinks(w, r, &metadata)
+				location = workspacePath(r, "/v1/notes/7")
+			})
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("X-Workspace", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			app.workspaceScope(next).ServeHTTP(w, r)
+
+			for _, link := range []string{metadata.Next, metadata.Prev} {
+				if !strings.HasPrefix(link, tt.wantPrefix+"?") || !strings.Contains(link, "sort=title") || strings.Contains(link, "page=") {
+					t.Errorf("got link %q, want it under %s keeping the sort and dropping the page", link, tt.wantPrefix)
+				}
+			}
+
+			if header := w.Header().Get("Link"); !strings.Contains(header, "<"+metadata.Next+`>; rel="next"`) {
+				t.Errorf("Link header %q doesn't hold the next link", header)
+			}
+
+			if want := strings.TrimSuffix(tt.wantPrefix, "/notes") + "/notes/7"; location != want {
+				t.Errorf("got location %q, want %q", location, want)
+			}
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
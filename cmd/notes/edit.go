@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/pkg/client"
+	"gopkg.in/yaml.v3"
+)
+
+// editableNote is the front matter of the file a note is edited in. The content
+// follows it as the body of the file.
+type editableNote struct {
+	Title      string     `yaml:"title"`
+	Tags       []string   `yaml:"tags"`
+	Pinned     bool       `yaml:"pinned"`
+	Archived   bool       `yaml:"archived"`
+	Color      string     `yaml:"color"`
+	RemindAt   *time.Time `yaml:"remind_at"`
+	Recurrence string     `yaml:"recurrence"`
+	Content    string     `yaml:"-"`
+}
+
+func runEdit(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet("edit")
+	rewriteLinks := flags.Bool("rewrite-links", false, "Update [[title]] links in other notes when the title changes")
+
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	ids, err := parseIDs(positional)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return errUsage
+	}
+
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	note, err := api.GetNote(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+
+	before := editableNote{
+		Title:      note.Title,
+		Tags:       note.Tags,
+		Pinned:     note.Pinned,
+		Archived:   note.Archived,
+		Color:      note.Color,
+		RemindAt:   note.RemindAt,
+		Recurrence: note.Recurrence,
+		Content:    note.Content,
+	}
+
+	original, err := marshalEditable(before)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", fmt.Sprintf("note-%d-*.md", note.ID))
+	if err != nil {
+		return err
+	}
+	path := f.Name()
+
+	_, err = f.Write(original)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	err = openEditor(ctx, path)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(edited, original) {
+		os.Remove(path)
+		fmt.Fprintln(c.stderr, "no changes")
+		return nil
+	}
+
+	after, err := unmarshalEditable(edited)
+	if err != nil {
+		return fmt.Errorf("%w, your changes are in %s", err, path)
+	}
+
+	update := diffEditable(before, after)
+	update.Version = note.Version
+	update.RewriteLinks = *rewriteLinks
+
+	note, err = api.UpdateNote(ctx, note.ID, update)
+	if err != nil {
+		if errors.Is(err, client.ErrEditConflict) {
+			return fmt.Errorf("the note was changed by someone else while you were editing it, your changes are in %s", path)
+		}
+		return fmt.Errorf("%w, your changes are in %s", err, path)
+	}
+
+	os.Remove(path)
+
+	return c.print(note, func(w *tabwriter.Writer) {
+		noteDetails(w, c.stdout, note)
+	})
+}
+
+// openEditor edits path with $VISUAL or $EDITOR, falling back to vi.
+func openEditor(ctx context.Context, path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// the editor can come with arguments of its own, such as "code --wait"
+	args := append(strings.Fields(editor), path)
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", editor, err)
+	}
+
+	return nil
+}
+
+const frontMatterDelimiter = "---\n"
+
+func marshalEditable(note editableNote) ([]byte, error) {
+	fm, err := yaml.Marshal(note)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(frontMatterDelimiter)
+	buf.Write(fm)
+	buf.WriteString(frontMatterDelimiter)
+	buf.WriteString("\n")
+	buf.WriteString(note.Content)
+
+	return buf.Bytes(), nil
+}
+
+func unmarshalEditable(contents []byte) (editableNote, error) {
+	var note editableNote
+
+	text := strings.ReplaceAll(string(contents), "\r\n", "\n")
+	if !strings.HasPrefix(text, frontMatterDelimiter) {
+		return note, errors.New("the note must start with its --- front matter")
+	}
+
+	fm, body, ok := strings.Cut(strings.TrimPrefix(text, frontMatterDelimiter), "\n"+frontMatterDelimiter)
+	if !ok {
+		return note, errors.New("the front matter must end with a --- line")
+	}
+
+	if err := yaml.Unmarshal([]byte(fm), &note); err != nil {
+		return note, fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	// the blank line after the front matter was added by marshalEditable
+	note.Content = strings.TrimPrefix(body, "\n")
+
+	return note, nil
+}
+
+// diffEditable returns an update holding only the fields that were changed, so
+// the edit doesn't overwrite anything else.
+func diffEditable(before, after editableNote) client.NoteUpdate {
+	var update client.NoteUpdate
+
+	if after.Title != before.Title {
+		update.Title = &after.Title
+	}
+	if after.Content != before.Content {
+		update.Content = &after.Content
+	}
+	if !slices.Equal(after.Tags, before.Tags) {
+		update.Tags = after.Tags
+		if update.Tags == nil {
+			update.Tags = []string{}
+		}
+	}
+	if after.Pinned != before.Pinned {
+		update.Pinned = &after.Pinned
+	}
+	if after.Archived != before.Archived {
+		update.Archived = &after.Archived
+	}
+	if after.Color != before.Color {
+		update.Color = &after.Color
+	}
+	switch {
+	case after.RemindAt == nil && before.RemindAt != nil:
+		update.ClearRemindAt = true
+	case after.RemindAt != nil && (before.RemindAt == nil || !after.RemindAt.Equal(*before.RemindAt)):
+		update.RemindAt = after.RemindAt
+	}
+	if after.Recurrence != before.Recurrence {
+		update.Recurrence = &after.Recurrence
+	}
+
+	return update
+}
@@ -0,0 +1,184 @@
+// Command notes is a command line client for the notes API.
+//
+//	notes profile set local --url http://localhost:4000
+//	notes create --title Groceries --tags yes
+//	notes ls --tags yes --output table
+//	notes edit 1
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/KevuTheDev/notes-backend-api/pkg/client"
+)
+
+// command is a subcommand of notes, such as "ls".
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands = []command{
+	{"create", "create --title TITLE [flags]", "Create a note", runCreate},
+	{"get", "get ID...", "Show notes", runGet},
+	{"edit", "edit ID", "Edit a note in $EDITOR", runEdit},
+	{"ls", "ls [flags]", "List notes", runList},
+	{"rm", "rm ID...", "Delete notes", runRemove},
+	{"export", "export [flags]", "Export every note as JSON or Markdown", runExport},
+	{"import", "import FILE...", "Import notes from Markdown, ENEX, JSON or ZIP files", runImport},
+	{"profile", "profile ls | set NAME --url URL [--token TOKEN] | use NAME | rm NAME", "Manage the servers notes talks to", runProfile},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		c := &cli{stdout: stdout, stderr: stderr}
+		err := cmd.run(ctx, c, args[1:])
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errUsage):
+			fmt.Fprintf(stderr, "usage: notes %s\n", cmd.usage)
+			return 2
+		default:
+			fmt.Fprintln(stderr, "notes:", err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(stderr, "notes: unknown command %q\n\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: notes <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command takes --profile, --server, --token, --workspace and --output json|table|yaml.")
+	fmt.Fprintln(w, "Run notes <command> -h for its flags.")
+}
+
+// errUsage is returned by commands given the wrong arguments.
+var errUsage = errors.New("usage")
+
+// cli holds the flags every command shares.
+type cli struct {
+	profile   string
+	server    string
+	token     string
+	workspace string
+	output    string
+
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// flagSet returns a flag set for a command, with the shared flags on it.
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("notes "+name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+
+	fs.StringVar(&c.profile, "profile", os.Getenv("NOTES_PROFILE"), "Profile to use, instead of the current one")
+	fs.StringVar(&c.server, "server", os.Getenv("NOTES_SERVER"), "URL of the API, overriding the profile")
+	fs.StringVar(&c.token, "token", os.Getenv("NOTES_TOKEN"), "Token to authenticate with, overriding the profile")
+	fs.StringVar(&c.workspace, "workspace", os.Getenv("NOTES_WORKSPACE"), "Workspace slug or id to work in, instead of the default one")
+	fs.StringVar(&c.output, "output", "table", "Output format: json, table or yaml")
+
+	return fs
+}
+
+// parse parses args with fs, allowing flags to come after the positional
+// arguments, as in "notes get 1 --output json".
+func (c *cli) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	switch c.output {
+	case "json", "table", "yaml":
+	default:
+		return nil, fmt.Errorf("--output must be json, table or yaml, not %q", c.output)
+	}
+
+	return positional, nil
+}
+
+// client returns an API client for the chosen profile.
+func (c *cli) client() (*client.Client, error) {
+	profile, err := c.currentProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	server := profile.URL
+	if c.server != "" {
+		server = c.server
+	}
+
+	token := profile.Token
+	if c.token != "" {
+		token = c.token
+	}
+
+	opts := []client.Option{client.WithToken(token), client.WithUserAgent("notes-cli"), client.WithRetries(3)}
+	if c.workspace != "" {
+		opts = append(opts, client.WithWorkspace(c.workspace))
+	}
+
+	return client.New(server, opts...)
+}
+
+// csv splits a comma separated flag, dropping empty values.
+func csv(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
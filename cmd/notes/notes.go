@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/pkg/client"
+)
+
+func runCreate(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet("create")
+	title := flags.String("title", "", "Title of the note")
+	content := flags.String("content", "", "Content of the note")
+	file := flags.String("file", "", "Read the content from a file, or - for standard input")
+	tags := flags.String("tags", "", "Comma separated tags")
+	pinned := flags.Bool("pinned", false, "Pin the note")
+	archived := flags.Bool("archived", false, "Archive the note")
+	color := flags.String("color", "", "Color of the note")
+	remindAt := flags.String("remind-at", "", "When to send a reminder, in RFC 3339 format")
+	recurrence := flags.String("recurrence", "", "RRULE describing how the reminder repeats")
+
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errUsage
+	}
+
+	input := client.NoteInput{
+		Title:      *title,
+		Content:    *content,
+		Tags:       csv(*tags),
+		Pinned:     *pinned,
+		Archived:   *archived,
+		Color:      *color,
+		Recurrence: *recurrence,
+	}
+
+	if *file != "" {
+		input.Content, err = readFile(*file)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *remindAt != "" {
+		t, err := time.Parse(time.RFC3339, *remindAt)
+		if err != nil {
+			return errors.New("--remind-at must be in RFC 3339 format, such as 2024-07-01T09:00:00Z")
+		}
+		input.RemindAt = &t
+	}
+
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	note, err := api.CreateNote(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	return c.print(note, noteTable([]*client.Note{note}))
+}
+
+func runGet(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet("get")
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	ids, err := parseIDs(positional)
+	if err != nil {
+		return err
+	}
+
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	notes := make([]*client.Note, len(ids))
+	for i, id := range ids {
+		notes[i], err = api.GetNote(ctx, id)
+		if err != nil {
+			return fmt.Errorf("note %d: %w", id, err)
+		}
+	}
+
+	var v any = notes
+	if len(notes) == 1 {
+		v = notes[0]
+	}
+
+	return c.print(v, func(w *tabwriter.Writer) {
+		for i, note := range notes {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			noteDetails(w, c.stdout, note)
+		}
+	})
+}
+
+// noteDetails writes out every field of a note, followed by its content. The
+// content goes straight to out, so tabs in it are left alone.
+func noteDetails(w *tabwriter.Writer, out io.Writer, note *client.Note) {
+	fmt.Fprintf(w, "ID:\t%d\n", note.ID)
+	fmt.Fprintf(w, "Title:\t%s\n", note.Title)
+	fmt.Fprintf(w, "Tags:\t%s\n", strings.Join(note.Tags, ", "))
+	fmt.Fprintf(w, "Pinned:\t%s\n", yesNo(note.Pinned))
+	fmt.Fprintf(w, "Archived:\t%s\n", yesNo(note.Archived))
+	if note.Color != "" {
+		fmt.Fprintf(w, "Color:\t%s\n", note.Color)
+	}
+	if note.RemindAt != nil {
+		fmt.Fprintf(w, "Remind at:\t%s\n", note.RemindAt.Local().Format(time.DateTime))
+	}
+	if note.Recurrence != "" {
+		fmt.Fprintf(w, "Recurrence:\t%s\n", note.Recurrence)
+	}
+	fmt.Fprintf(w, "Created:\t%s\n", note.CreatedAt.Local().Format(time.DateTime))
+	fmt.Fprintf(w, "Updated:\t%s\n", note.LastUpdatedAt.Local().Format(time.DateTime))
+	fmt.Fprintf(w, "Version:\t%d\n", note.Version)
+
+	w.Flush()
+	if note.Content != "" {
+		fmt.Fprintf(out, "\n%s\n", strings.TrimRight(note.Content, "\n"))
+	}
+}
+
+func runList(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet("ls")
+	query := flags.String("query", "", "Only notes matching this full text search")
+	tags := flags.String("tags", "", "Only notes with all of these comma separated tags")
+	archived := flags.Bool("archived", false, "List archived notes instead")
+	pinned := flags.String("pinned", "", "Only pinned (true) or unpinned (false) notes")
+	sort := flags.String("sort", "", "Sort by id, title, created_at or last_updated_at, with a - for descending")
+	page := flags.Int("page", 1, "Page to show")
+	pageSize := flags.Int("page-size", 20, "Notes per page")
+	all := flags.Bool("all", false, "List every page")
+
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errUsage
+	}
+
+	opts := client.ListOptions{
+		Query:    *query,
+		Tags:     csv(*tags),
+		Archived: *archived,
+		Sort:     *sort,
+		Page:     *page,
+		PageSize: *pageSize,
+	}
+
+	if *pinned != "" {
+		b, err := strconv.ParseBool(*pinned)
+		if err != nil {
+			return errors.New("--pinned must be true or false")
+		}
+		opts.Pinned = &b
+	}
+
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	var notes []*client.Note
+	var metadata client.Metadata
+
+	if *all {
+		notes, err = api.ListNotes(ctx, opts).All()
+	} else {
+		var page *client.NotePage
+		page, err = api.ListNotesPage(ctx, opts)
+		if page != nil {
+			notes, metadata = page.Notes, page.Metadata
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if notes == nil {
+		notes = []*client.Note{}
+	}
+
+	err = c.print(notes, noteTable(notes))
+	if err != nil {
+		return err
+	}
+
+	if c.output == "table" && !*all && metadata.LastPage > 1 {
+		fmt.Fprintf(c.stderr, "page %d of %d, %d notes in all\n", metadata.CurrentPage, metadata.LastPage, metadata.TotalRecords)
+	}
+
+	return nil
+}
+
+func runRemove(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet("rm")
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	ids, err := parseIDs(positional)
+	if err != nil {
+		return err
+	}
+
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	deleted := []int64{}
+	for _, id := range ids {
+		err := api.DeleteNote(ctx, id)
+		if err != nil {
+			// report what was deleted before the failure
+			c.print(map[string]any{"deleted": deleted}, deletedTable(deleted))
+			return fmt.Errorf("note %d: %w", id, err)
+		}
+		deleted = append(deleted, id)
+	}
+
+	return c.print(map[string]any{"deleted": deleted}, deletedTable(deleted))
+}
+
+func deletedTable(ids []int64) func(w *tabwriter.Writer) {
+	return func(w *tabwriter.Writer) {
+		for _, id := range ids {
+			fmt.Fprintf(w, "deleted note %d\n", id)
+		}
+	}
+}
+
+// parseIDs parses note ids given as arguments. At least one is needed.
+func parseIDs(args []string) ([]int64, error) {
+	if len(args) == 0 {
+		return nil, errUsage
+	}
+
+	ids := make([]int64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("%q is not a note id", arg)
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+// readFile reads a file, or standard input for "-".
+func readFile(name string) (string, error) {
+	if name == "-" {
+		contents, err := io.ReadAll(os.Stdin)
+		return string(contents), err
+	}
+
+	contents, err := os.ReadFile(name)
+	return string(contents), err
+}
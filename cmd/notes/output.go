@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/pkg/client"
+	"gopkg.in/yaml.v3"
+)
+
+// print writes v out in the --output format. Tables are drawn by table.
+func (c *cli) print(v any, table func(w *tabwriter.Writer)) error {
+	switch c.output {
+	case "json":
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+
+	case "yaml":
+		// going through JSON keeps the field names and order of the API
+		js, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		var node yaml.Node
+		if err := yaml.Unmarshal(js, &node); err != nil {
+			return err
+		}
+		blockStyle(&node)
+
+		enc := yaml.NewEncoder(c.stdout)
+		enc.SetIndent(2)
+		defer enc.Close()
+		return enc.Encode(&node)
+
+	default:
+		w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+}
+
+// blockStyle undoes the flow and quoting styles YAML gives to JSON, so it is
+// printed as ordinary YAML. Strings are still quoted where they need to be.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+func noteTable(notes []*client.Note) func(w *tabwriter.Writer) {
+	return func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tTITLE\tTAGS\tPINNED\tARCHIVED\tUPDATED\tVERSION")
+		for _, note := range notes {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\n",
+				note.ID,
+				truncate(note.Title, 40),
+				strings.Join(note.Tags, ","),
+				yesNo(note.Pinned),
+				yesNo(note.Archived),
+				note.LastUpdatedAt.Local().Format(time.DateTime),
+				note.Version,
+			)
+		}
+	}
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n-1]) + "…"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
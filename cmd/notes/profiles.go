@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultServer is used when there are no profiles yet.
+const defaultServer = "http://localhost:4000"
+
+// profile is a server to talk to, and the token to talk to it with.
+type profile struct {
+	URL   string `yaml:"url" json:"url"`
+	Token string `yaml:"token,omitempty" json:"-"`
+}
+
+// profiles is the config file of the CLI, which lives at NOTES_CONFIG or
+// notes/config.yaml in the user's config directory.
+type profiles struct {
+	Current  string              `yaml:"current,omitempty"`
+	Profiles map[string]*profile `yaml:"profiles"`
+}
+
+func profilesPath() (string, error) {
+	if path := os.Getenv("NOTES_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "notes", "config.yaml"), nil
+}
+
+func loadProfiles() (*profiles, error) {
+	p := &profiles{Profiles: make(map[string]*profile)}
+
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return p, nil
+		}
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(contents, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if p.Profiles == nil {
+		p.Profiles = make(map[string]*profile)
+	}
+
+	return p, nil
+}
+
+// save writes the profiles back. Only the user can read the file, since it holds
+// tokens.
+func (p *profiles) save() error {
+	path, err := profilesPath()
+	if err != nil {
+		return err
+	}
+
+	contents, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, contents, 0o600)
+}
+
+// currentProfile returns the profile named by --profile, or else the current
+// one. Without any profiles, the API is expected on localhost.
+func (c *cli) currentProfile() (*profile, error) {
+	p, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	name := c.profile
+	if name == "" {
+		name = p.Current
+	}
+
+	if name == "" {
+		if len(p.Profiles) == 0 {
+			return &profile{URL: defaultServer}, nil
+		}
+		return nil, errors.New("no profile is in use, pick one with notes profile use NAME")
+	}
+
+	prof, ok := p.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("there is no profile named %q", name)
+	}
+
+	return prof, nil
+}
+
+func runProfile(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "ls":
+		return runProfileList(c, args[1:])
+	case "set":
+		return runProfileSet(c, args[1:])
+	case "use":
+		return runProfileUse(c, args[1:])
+	case "rm":
+		return runProfileRemove(c, args[1:])
+	default:
+		return errUsage
+	}
+}
+
+func runProfileList(c *cli, args []string) error {
+	flags := c.flagSet("profile ls")
+	if _, err := c.parse(flags, args); err != nil {
+		return err
+	}
+
+	p, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(p.Profiles))
+	for name := range p.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type row struct {
+		Name    string `json:"name" yaml:"name"`
+		URL     string `json:"url" yaml:"url"`
+		Current bool   `json:"current" yaml:"current"`
+	}
+
+	rows := make([]row, len(names))
+	for i, name := range names {
+		rows[i] = row{Name: name, URL: p.Profiles[name].URL, Current: name == p.Current}
+	}
+
+	return c.print(rows, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "CURRENT\tNAME\tURL")
+		for _, r := range rows {
+			current := ""
+			if r.Current {
+				current = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", current, r.Name, r.URL)
+		}
+	})
+}
+
+func runProfileSet(c *cli, args []string) error {
+	flags := c.flagSet("profile set")
+	url := flags.String("url", "", "URL of the API")
+
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+	name := positional[0]
+
+	p, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	prof, ok := p.Profiles[name]
+	if !ok {
+		if *url == "" {
+			return errors.New("--url is required for a new profile")
+		}
+		prof = &profile{}
+		p.Profiles[name] = prof
+	}
+
+	if *url != "" {
+		prof.URL = *url
+	}
+	// --token is saved with the profile here, rather than overriding it
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "token" {
+			prof.Token = c.token
+		}
+	})
+
+	// the first profile becomes the current one
+	if p.Current == "" {
+		p.Current = name
+	}
+
+	return p.save()
+}
+
+func runProfileUse(c *cli, args []string) error {
+	flags := c.flagSet("profile use")
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+
+	p, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := p.Profiles[positional[0]]; !ok {
+		return fmt.Errorf("there is no profile named %q", positional[0])
+	}
+	p.Current = positional[0]
+
+	return p.save()
+}
+
+func runProfileRemove(c *cli, args []string) error {
+	flags := c.flagSet("profile rm")
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+
+	p, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := p.Profiles[positional[0]]; !ok {
+		return fmt.Errorf("there is no profile named %q", positional[0])
+	}
+	delete(p.Profiles, positional[0])
+	if p.Current == positional[0] {
+		p.Current = ""
+	}
+
+	return p.save()
+}
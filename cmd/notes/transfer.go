@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/pkg/client"
+	"gopkg.in/yaml.v3"
+)
+
+func runExport(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet("export")
+	format := flags.String("format", "json", "Export format: json or markdown")
+	file := flags.String("file", "-", "File to write the JSON export to, or - for standard output")
+	dir := flags.String("dir", "", "Directory to write the Markdown files to")
+
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errUsage
+	}
+
+	switch {
+	case *format == "markdown" && *dir == "":
+		return fmt.Errorf("--dir is required for a markdown export")
+	case *format != "json" && *format != "markdown":
+		return fmt.Errorf("--format must be json or markdown, not %q", *format)
+	}
+
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	// archived notes are listed separately from the rest
+	var notes []*client.Note
+	for _, archived := range []bool{false, true} {
+		listed, err := api.ListNotes(ctx, client.ListOptions{Archived: archived, Sort: "id", PageSize: 100}).All()
+		if err != nil {
+			return err
+		}
+		notes = append(notes, listed...)
+	}
+
+	if *format == "markdown" {
+		err = exportMarkdown(*dir, notes)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.stderr, "exported %d notes to %s\n", len(notes), *dir)
+		return nil
+	}
+
+	// the {"notes": [...]} envelope can be imported again as it is
+	js, err := json.MarshalIndent(map[string]any{"notes": notes}, "", "  ")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	if *file == "-" {
+		_, err = c.stdout.Write(js)
+		return err
+	}
+
+	err = os.WriteFile(*file, js, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stderr, "exported %d notes to %s\n", len(notes), *file)
+	return nil
+}
+
+// exportFrontMatter is the front matter of an exported Markdown file, holding
+// the fields the importer reads back.
+type exportFrontMatter struct {
+	Title         string    `yaml:"title"`
+	Tags          []string  `yaml:"tags,omitempty"`
+	CreatedAt     time.Time `yaml:"created_at"`
+	LastUpdatedAt time.Time `yaml:"last_updated_at"`
+}
+
+var unsafeFilenameRX = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// exportMarkdown writes each note to a file of its own, with the front matter
+// the importer reads.
+func exportMarkdown(dir string, notes []*client.Note) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		slug := strings.ToLower(unsafeFilenameRX.ReplaceAllString(note.Title, "-"))
+		if len(slug) > 50 {
+			slug = slug[:50]
+		}
+		name := filepath.Join(dir, fmt.Sprintf("%d-%s.md", note.ID, strings.Trim(slug, "-")))
+
+		fm, err := yaml.Marshal(exportFrontMatter{
+			Title:         note.Title,
+			Tags:          note.Tags,
+			CreatedAt:     note.CreatedAt,
+			LastUpdatedAt: note.LastUpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		contents := frontMatterDelimiter + string(fm) + frontMatterDelimiter + "\n" + note.Content
+
+		if err := os.WriteFile(name, []byte(contents), 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runImport(ctx context.Context, c *cli, args []string) error {
+	flags := c.flagSet("import")
+	wait := flags.Bool("wait", true, "Wait for the import to finish and show its report")
+
+	positional, err := c.parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return errUsage
+	}
+
+	var files []client.ImportFile
+	for _, name := range positional {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		files = append(files, client.ImportFile{Name: filepath.Base(name), Data: f})
+	}
+
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	job, err := api.Import(ctx, files...)
+	if err != nil {
+		return err
+	}
+
+	if *wait {
+		job, err = api.WaitForImport(ctx, job.ID, 500*time.Millisecond)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.print(job, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "JOB\tSTATUS\tIMPORTED\tFAILED")
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", job.ID, job.Status, job.Imported, job.Failed)
+		w.Flush()
+
+		for _, e := range job.Errors {
+			msg := e.Error
+			for field, message := range e.Errors {
+				msg = strings.TrimPrefix(msg+"; "+field+" "+message, "; ")
+			}
+			fmt.Fprintf(c.stderr, "%s: %s\n", e.File, msg)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if job.Failed > 0 {
+		return fmt.Errorf("%d of %d notes could not be imported", job.Failed, job.Total)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type Attachment struct {
+	ID          int64     `json:"id"`           // unique id for the attachment
+	NoteID      int64     `json:"note_id"`      // note the attachment belongs to
+	CreatedAt   time.Time `json:"created_at"`   // when the attachment was uploaded
+	Filename    string    `json:"filename"`     // original name of the uploaded file
+	ContentType string    `json:"content_type"` // sniffed media type of the file
+	Size        int64     `json:"size"`         // size of the file in bytes
+	Checksum    string    `json:"checksum"`     // hex encoded SHA-256 of the file
+	StorageKey  string    `json:"-"`            // key of the blob in the BlobStore
+}
+
+// Define a AttachmentModel struct type which wraps a sql.DB connection pool
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+func (m AttachmentModel) Insert(ctx context.Context, attachment *Attachment) (err error) {
+	ctx, span := startSpan(ctx, "AttachmentModel.Insert", "insert_attachment", noteIDAttr(attachment.NoteID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		INSERT INTO note_attachments (note_id, filename, content_type, size, checksum, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	args := []any{
+		attachment.NoteID,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.Checksum,
+		attachment.StorageKey,
+	}
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, stmt, args...).Scan(&attachment.ID, &attachment.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditAttachmentCreate, attachment.ID, attachment.NoteID, nil, attachment)
+	})
+}
+
+// Get returns an attachment only if it belongs to the given note.
+func (m AttachmentModel) Get(ctx context.Context, noteID, id int64) (_ *Attachment, err error) {
+	ctx, span := startSpan(ctx, "AttachmentModel.Get", "select_attachment", noteIDAttr(noteID), attribute.Int64("attachment.id", id))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT id, note_id, created_at, filename, content_type, size, checksum, storage_key
+		FROM note_attachments
+		WHERE id = $1 AND note_id = $2`
+
+	var attachment Attachment
+
+	err = m.DB.QueryRowContext(ctx, stmt, id, noteID).Scan(
+		&attachment.ID,
+		&attachment.NoteID,
+		&attachment.CreatedAt,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.Checksum,
+		&attachment.StorageKey,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &attachment, nil
+}
+
+// GetAllForNote returns the attachments of a note, oldest first.
+func (m AttachmentModel) GetAllForNote(ctx context.Context, noteID int64) (_ []*Attachment, err error) {
+	ctx, span := startSpan(ctx, "AttachmentModel.GetAllForNote", "select_attachments", noteIDAttr(noteID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT id, note_id, created_at, filename, content_type, size, checksum, storage_key
+		FROM note_attachments
+		WHERE note_id = $1
+		ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+
+	for rows.Next() {
+		var attachment Attachment
+
+		err := rows.Scan(
+			&attachment.ID,
+			&attachment.NoteID,
+			&attachment.CreatedAt,
+			&attachment.Filename,
+			&attachment.ContentType,
+			&attachment.Size,
+			&attachment.Checksum,
+			&attachment.StorageKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, &attachment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(attachments)))
+
+	return attachments, nil
+}
+
+func (m AttachmentModel) Delete(ctx context.Context, noteID, id int64) (err error) {
+	ctx, span := startSpan(ctx, "AttachmentModel.Delete", "delete_attachment", noteIDAttr(noteID), attribute.Int64("attachment.id", id))
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		DELETE FROM note_attachments
+		WHERE id = $1 AND note_id = $2
+		RETURNING id, note_id, created_at, filename, content_type, size, checksum, storage_key`
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var attachment Attachment
+
+		err := tx.QueryRowContext(ctx, query, id, noteID).Scan(
+			&attachment.ID,
+			&attachment.NoteID,
+			&attachment.CreatedAt,
+			&attachment.Filename,
+			&attachment.ContentType,
+			&attachment.Size,
+			&attachment.Checksum,
+			&attachment.StorageKey,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		return recordAudit(ctx, tx, AuditAttachmentDelete, id, noteID, &attachment, nil)
+	})
+}
+
+// GetBatch returns up to limit attachments of any note with ids above afterID, in
+// id order, for stepping through every attachment a batch at a time.
+func (m AttachmentModel) GetBatch(ctx context.Context, afterID int64, limit int) (_ []*Attachment, err error) {
+	ctx, span := startSpan(ctx, "AttachmentModel.GetBatch", "select_attachments_batch", batchAttr(limit))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT id, note_id, created_at, filename, content_type, size, checksum, storage_key
+		FROM note_attachments
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+
+	for rows.Next() {
+		var attachment Attachment
+
+		err := rows.Scan(
+			&attachment.ID,
+			&attachment.NoteID,
+			&attachment.CreatedAt,
+			&attachment.Filename,
+			&attachment.ContentType,
+			&attachment.Size,
+			&attachment.Checksum,
+			&attachment.StorageKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, &attachment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(attachments)))
+
+	return attachments, nil
+}
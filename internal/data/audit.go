@@ -0,0 +1,296 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+// Actions recorded in the audit log, named after the kind of record they change.
+const (
+	AuditNoteCreate       = "note.create"
+	AuditNoteImport       = "note.import"
+	AuditNoteUpdate       = "note.update"
+	AuditNoteDelete       = "note.delete"
+	AuditItemCreate       = "item.create"
+	AuditItemUpdate       = "item.update"
+	AuditItemReorder      = "item.reorder"
+	AuditItemDelete       = "item.delete"
+	AuditAttachmentCreate = "attachment.create"
+	AuditAttachmentDelete = "attachment.delete"
+	AuditShareCreate      = "share.create"
+	AuditShareDelete      = "share.delete"
+	AuditTemplateCreate   = "template.create"
+	AuditTemplateUpdate   = "template.update"
+	AuditTemplateDelete   = "template.delete"
+	AuditWorkspaceCreate  = "workspace.create"
+	AuditWorkspaceDelete  = "workspace.delete"
+	AuditMemberCreate     = "member.create"
+	AuditMemberUpdate     = "member.update"
+	AuditMemberDelete     = "member.delete"
+	AuditInviteCreate     = "invitation.create"
+	AuditInviteAccept     = "invitation.accept"
+	AuditInviteDelete     = "invitation.delete"
+)
+
+// AuditActions lists every action, for validating filters on the audit log.
+var AuditActions = []string{
+	AuditNoteCreate, AuditNoteImport, AuditNoteUpdate, AuditNoteDelete,
+	AuditItemCreate, AuditItemUpdate, AuditItemReorder, AuditItemDelete,
+	AuditAttachmentCreate, AuditAttachmentDelete,
+	AuditShareCreate, AuditShareDelete,
+	AuditTemplateCreate, AuditTemplateUpdate, AuditTemplateDelete,
+	AuditWorkspaceCreate, AuditWorkspaceDelete,
+	AuditMemberCreate, AuditMemberUpdate, AuditMemberDelete,
+	AuditInviteCreate, AuditInviteAccept, AuditInviteDelete,
+}
+
+// AuditEvent is one change in the audit log.
+type AuditEvent struct {
+	ID        int64                  `json:"id"`                   // unique id for the event
+	CreatedAt time.Time              `json:"created_at"`           // when the change was made
+	Actor     string                 `json:"actor,omitempty"`      // who made the change
+	IP        string                 `json:"ip,omitempty"`         // address the change came from
+	RequestID string                 `json:"request_id,omitempty"` // X-Request-Id of the request that made the change
+	Action    string                 `json:"action"`               // what was done, such as "note.update"
+	EntityID  int64                  `json:"entity_id"`            // id of the note, item, link... that changed
+	NoteID    *int64                 `json:"note_id,omitempty"`    // note the change belongs to, if any
+	Changes   map[string]AuditChange `json:"changes"`              // fields that changed
+}
+
+// AuditChange is the value of a field before and after a change. Before is null
+// for created records and After is null for deleted ones.
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditSource says who is making changes. It is carried in the context so that
+// the models can record it in the same transaction as the change itself.
+type AuditSource struct {
+	Actor     string
+	IP        string
+	RequestID string
+}
+
+type auditSourceContextKey struct{}
+
+// WithAuditSource returns a context whose changes are recorded as made by source.
+func WithAuditSource(ctx context.Context, source AuditSource) context.Context {
+	return context.WithValue(ctx, auditSourceContextKey{}, source)
+}
+
+// WithAuditActor returns a context whose changes are recorded as made by actor,
+// keeping the rest of the source already in ctx.
+func WithAuditActor(ctx context.Context, actor string) context.Context {
+	source := auditSourceFromContext(ctx)
+	source.Actor = actor
+	return WithAuditSource(ctx, source)
+}
+
+func auditSourceFromContext(ctx context.Context) AuditSource {
+	source, _ := ctx.Value(auditSourceContextKey{}).(AuditSource)
+	return source
+}
+
+// auditIgnoredFields are bookkeeping fields which change on every write, so
+// recording them would only add noise.
+var auditIgnoredFields = map[string]bool{
+	"id":              true,
+	"created_at":      true,
+	"last_updated_at": true,
+	"version":         true,
+}
+
+// auditChanges compares the JSON fields of before and after, either of which can
+// be a nil interface for a created or deleted record, and returns the ones that
+// differ.
+func auditChanges(before, after any) (map[string]AuditChange, error) {
+	b, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]AuditChange)
+
+	for _, fields := range []map[string]any{b, a} {
+		for name := range fields {
+			if auditIgnoredFields[name] || reflect.DeepEqual(b[name], a[name]) {
+				continue
+			}
+			changes[name] = AuditChange{Before: b[name], After: a[name]}
+		}
+	}
+
+	return changes, nil
+}
+
+func auditFields(v any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if v == nil {
+		return fields, nil
+	}
+
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// numbers are kept as they are written, so ids don't lose precision
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	return fields, dec.Decode(&fields)
+}
+
+// recordAudit writes an event for the change from before to after in tx, the
+// transaction which made the change, so the two are saved or lost together.
+// noteID is 0 for records that don't belong to a note.
+func recordAudit(ctx context.Context, tx *sql.Tx, action string, entityID, noteID int64, before, after any) error {
+	changes, err := auditChanges(before, after)
+	if err != nil {
+		return err
+	}
+
+	js, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	source := auditSourceFromContext(ctx)
+
+	stmt := `
+		INSERT INTO audit_events (actor, ip, request_id, action, entity_id, note_id, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	args := []any{
+		source.Actor,
+		source.IP,
+		source.RequestID,
+		action,
+		entityID,
+		sql.NullInt64{Int64: noteID, Valid: noteID != 0},
+		js,
+	}
+
+	_, err = tx.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// AuditQuery narrows down which events are returned by GetAll. Zero values
+// match everything.
+type AuditQuery struct {
+	Action    string
+	Actor     string
+	RequestID string
+	NoteID    int64
+	Since     *time.Time
+	Until     *time.Time
+}
+
+func ValidateAuditQuery(v *validator.Validator, q AuditQuery) {
+	v.Check(q.Action == "" || validator.PermittedValue(q.Action, AuditActions...), "action", validator.CodeNotPermitted, "must be a known action")
+
+	if q.Since != nil && q.Until != nil {
+		v.Check(!q.Until.Before(*q.Since), "until", validator.CodeInvalid, "must not be before since")
+	}
+}
+
+// Define a AuditModel struct type which wraps a sql.DB connection pool
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns a page of the events matching query.
+func (m AuditModel) GetAll(ctx context.Context, query AuditQuery, filters Filters) (_ []*AuditEvent, _ Metadata, err error) {
+	ctx, span := startSpan(ctx, "AuditModel.GetAll", "select_audit_events")
+	defer func() { endSpan(span, err) }()
+
+	// ids go up with created_at, and tell apart events made in the same second
+	stmt := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, actor, ip, request_id, action, entity_id, note_id, changes
+		FROM audit_events
+		WHERE (action = $1 OR $1 = '')
+		AND (actor = $2 OR $2 = '')
+		AND (request_id = $3 OR $3 = '')
+		AND (note_id = $4 OR $4 = 0)
+		AND (created_at >= $5 OR $5 IS NULL)
+		AND (created_at < $6 OR $6 IS NULL)
+		ORDER BY id %s
+		LIMIT $7 OFFSET $8`, filters.sortDirection())
+
+	args := []any{
+		query.Action,
+		query.Actor,
+		query.RequestID,
+		query.NoteID,
+		query.Since,
+		query.Until,
+		filters.limit(),
+		filters.offset(),
+	}
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		var event AuditEvent
+		var noteID sql.NullInt64
+		var changes []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&event.ID,
+			&event.CreatedAt,
+			&event.Actor,
+			&event.IP,
+			&event.RequestID,
+			&event.Action,
+			&event.EntityID,
+			&noteID,
+			&changes,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		if noteID.Valid {
+			event.NoteID = &noteID.Int64
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(changes))
+		dec.UseNumber()
+		if err := dec.Decode(&event.Changes); err != nil {
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	span.SetAttributes(rowsAttr(len(events)))
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return events, metadata, nil
+}
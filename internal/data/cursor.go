@@ -0,0 +1,148 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a place in a keyset paginated listing, by the sort values of the
+// row next to it. Cursors are handed to clients as opaque tokens, signed so they
+// can't be tampered with to build arbitrary queries.
+type Cursor struct {
+	Sort   string `json:"s"`           // the sort the cursor was made for
+	Pinned *bool  `json:"p,omitempty"` // set when pinned notes are listed first
+	Value  string `json:"v"`           // the sort column of the row, as text
+	ID     int64  `json:"id"`          // the id of the row, to break ties
+	Before bool   `json:"b,omitempty"` // the page is the rows before the cursor rather than after
+}
+
+// Encode turns the cursor into a token signed with key.
+func (c Cursor) Encode(key []byte) string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		// a Cursor is always encodable
+		panic(err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(js)
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signCursor(payload, key))
+}
+
+// DecodeCursor checks the signature of a token from Encode and returns the cursor
+// in it. Anything wrong with the token is reported as ErrInvalidCursor.
+func DecodeCursor(token string, key []byte) (Cursor, error) {
+	var c Cursor
+
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, ErrInvalidCursor
+	}
+
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, signCursor(payload, key)) {
+		return c, ErrInvalidCursor
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(js, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func signCursor(payload string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// keysetKey is one column of the ORDER BY of a keyset paginated query, along with
+// the value it has in the row at the cursor.
+type keysetKey struct {
+	column string
+	desc   bool
+	value  any
+}
+
+// keysetOrder returns the ORDER BY clause for keys.
+func keysetOrder(keys []keysetKey) string {
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		terms[i] = key.column + " ASC"
+		if key.desc {
+			terms[i] = key.column + " DESC"
+		}
+	}
+
+	return strings.Join(terms, ", ")
+}
+
+// keysetWhere returns the condition matching the rows that come after the cursor
+// in the order given by keys, with the values as arguments numbered from argN.
+// Columns can be sorted in different directions, so rather than a single row
+// comparison it is spelled out as
+//
+//	a > $1 OR (a = $1 AND b > $2) OR (a = $1 AND b = $2 AND c > $3)
+func keysetWhere(keys []keysetKey, argN int) (string, []any) {
+	args := make([]any, len(keys))
+	terms := make([]string, len(keys))
+
+	for i, key := range keys {
+		args[i] = key.value
+
+		var conds []string
+		for j := 0; j < i; j++ {
+			conds = append(conds, fmt.Sprintf("%s = $%d", keys[j].column, argN+j))
+		}
+
+		op := ">"
+		if key.desc {
+			op = "<"
+		}
+		conds = append(conds, fmt.Sprintf("%s %s $%d", key.column, op, argN+i))
+
+		terms[i] = "(" + strings.Join(conds, " AND ") + ")"
+	}
+
+	return "(" + strings.Join(terms, " OR ") + ")", args
+}
+
+// reverseKeys flips the direction of every key, for reading the rows before a
+// cursor.
+func reverseKeys(keys []keysetKey) []keysetKey {
+	reversed := make([]keysetKey, len(keys))
+	for i, key := range keys {
+		key.desc = !key.desc
+		reversed[i] = key
+	}
+
+	return reversed
+}
+
+// parseSortValue converts the text form of a sort value from a cursor back to the
+// type of its column.
+func parseSortValue(column, value string) (any, error) {
+	switch column {
+	case "id":
+		return strconv.ParseInt(value, 10, 64)
+	case "created_at", "last_updated_at":
+		return time.Parse(time.RFC3339Nano, value)
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"math"
+	"strings"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+// Filters holds the paging and sorting options for a listing. Listings which
+// support keyset pagination read the page from Cursor when it is set, instead of
+// Page.
+type Filters struct {
+	Page         int
+	PageSize     int
+	Sort         string
+	SortSafelist []string
+	Cursor       *Cursor
+}
+
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", validator.CodeTooSmall, "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", validator.CodeTooLarge, "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", validator.CodeTooSmall, "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", validator.CodeTooLarge, "must be a maximum of 100")
+
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", validator.CodeNotPermitted, "invalid sort value")
+}
+
+// sortColumn returns the column to sort by, after checking it against the
+// safelist. The value ends up in the SQL statement, so anything that slipped past
+// validation is treated as a bug.
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+// sortDirection returns DESC when the sort value has a leading "-".
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata describes where a page sits within the full listing. Keyset paginated
+// listings fill in NextCursor and PrevCursor when there are pages either side,
+// which the caller turns into the Next and Prev links.
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	Next         string `json:"next,omitempty"`
+	Prev         string `json:"prev,omitempty"`
+
+	NextCursor *Cursor `json:"-"`
+	PrevCursor *Cursor `json:"-"`
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// A key is kept for IdempotencyKeyTTL after it was first used, and can be used
+// for a new request after that. A key whose first request still has no response
+// after IdempotencyKeyLease is taken to have been abandoned, such as by a server
+// that was stopped partway through, and can be used again as well.
+const (
+	IdempotencyKeyTTL   = 24 * time.Hour
+	IdempotencyKeyLease = 10 * time.Minute
+)
+
+// IdempotencyKey is a key sent by a client with a request it may need to repeat,
+// along with the response to the first request sent with it. Keys belong to the
+// workspace and member which sent them, so they can't collide with anyone else's.
+type IdempotencyKey struct {
+	ID          int64             // unique id for the key
+	MemberID    int64             // member which sent the key, or 0 in the default workspace
+	Key         string            // the Idempotency-Key header
+	Method      string            // method of the first request
+	Path        string            // path and query of the first request
+	RequestHash []byte            // SHA-256 of the body of the first request
+	Status      int               // status of the response, or 0 while it's being handled
+	Headers     map[string]string // headers of the response which are sent again
+	Body        []byte            // body of the response
+}
+
+// Define an IdempotencyKeyModel struct type which wraps a sql.DB connection pool
+type IdempotencyKeyModel struct {
+	DB *sql.DB
+}
+
+// Claim records that a request is being handled with key, unless the key is
+// already in use. It returns nil once the key is claimed, and otherwise the key
+// as it was saved by the first request, which is still being handled if it has
+// no Status yet. ErrRecordNotFound means the key was in use but went away in the
+// meantime.
+func (m IdempotencyKeyModel) Claim(ctx context.Context, key *IdempotencyKey) (_ *IdempotencyKey, err error) {
+	workspaceID := WorkspaceID(ctx)
+
+	ctx, span := startSpan(ctx, "IdempotencyKeyModel.Claim", "claim_idempotency_key", workspaceIDAttr(workspaceID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		INSERT INTO idempotency_keys (workspace_id, member_id, key, method, path)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (workspace_id, member_id, key) DO UPDATE
+		SET created_at = NOW(), method = EXCLUDED.method, path = EXCLUDED.path,
+			request_hash = NULL, status = NULL, headers = '{}', body = NULL
+		WHERE idempotency_keys.created_at <= NOW() - $6 * interval '1 second'
+		OR (idempotency_keys.status IS NULL AND idempotency_keys.created_at <= NOW() - $7 * interval '1 second')
+		RETURNING id`
+
+	args := []any{workspaceID, key.MemberID, key.Key, key.Method, key.Path, IdempotencyKeyTTL.Seconds(), IdempotencyKeyLease.Seconds()}
+
+	err = m.DB.QueryRowContext(ctx, stmt, args...).Scan(&key.ID)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	stmt = `
+		SELECT id, member_id, key, method, path, request_hash, COALESCE(status, 0), headers, body
+		FROM idempotency_keys
+		WHERE workspace_id = $1 AND member_id = $2 AND key = $3`
+
+	var (
+		saved   IdempotencyKey
+		headers []byte
+	)
+
+	err = m.DB.QueryRowContext(ctx, stmt, workspaceID, key.MemberID, key.Key).Scan(
+		&saved.ID,
+		&saved.MemberID,
+		&saved.Key,
+		&saved.Method,
+		&saved.Path,
+		&saved.RequestHash,
+		&saved.Status,
+		&headers,
+		&saved.Body,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(headers, &saved.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+// Complete saves the response to the request which claimed key, to be sent again
+// for any request repeated with it.
+func (m IdempotencyKeyModel) Complete(ctx context.Context, key *IdempotencyKey) (err error) {
+	ctx, span := startSpan(ctx, "IdempotencyKeyModel.Complete", "complete_idempotency_key")
+	defer func() { endSpan(span, err) }()
+
+	headers, err := json.Marshal(key.Headers)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		UPDATE idempotency_keys
+		SET request_hash = $2, status = $3, headers = $4, body = $5
+		WHERE id = $1`
+
+	_, err = m.DB.ExecContext(ctx, stmt, key.ID, key.RequestHash, key.Status, headers, key.Body)
+	return err
+}
+
+// Release gives up a claimed key without saving a response, so the request can be
+// repeated with it and handled again.
+func (m IdempotencyKeyModel) Release(ctx context.Context, key *IdempotencyKey) (err error) {
+	ctx, span := startSpan(ctx, "IdempotencyKeyModel.Release", "delete_idempotency_key")
+	defer func() { endSpan(span, err) }()
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE id = $1`, key.ID)
+	return err
+}
+
+// DeleteExpired deletes every key older than IdempotencyKeyTTL and returns how
+// many there were.
+func (m IdempotencyKeyModel) DeleteExpired(ctx context.Context) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "IdempotencyKeyModel.DeleteExpired", "delete_expired_idempotency_keys")
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		DELETE FROM idempotency_keys
+		WHERE created_at <= NOW() - $1 * interval '1 second'`
+
+	result, err := m.DB.ExecContext(ctx, stmt, IdempotencyKeyTTL.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	span.SetAttributes(rowsAttr(int(n)))
+
+	return n, nil
+}
@@ -0,0 +1,419 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type Item struct {
+	ID        int64      `json:"id"`               // unique id for the item
+	NoteID    int64      `json:"note_id"`          // note the item belongs to
+	CreatedAt time.Time  `json:"created_at"`       // when the item was added
+	Text      string     `json:"text"`             // text of the item
+	Checked   bool       `json:"checked"`          // whether the item has been done
+	Position  int        `json:"position"`         // order of the item within the note, starting at 1
+	DueAt     *time.Time `json:"due_at,omitempty"` // when the item is due, if ever
+}
+
+// Task is a checklist item along with the title of the note it is on, as shown in
+// the listing of tasks across all notes.
+type Task struct {
+	Item
+	NoteTitle string `json:"note_title"`
+}
+
+func ValidateItem(v *validator.Validator, item *Item) {
+	v.Check(item.Text != "", "text", validator.CodeRequired, "must be provided")
+	v.Check(len(item.Text) <= 1000, "text", validator.CodeTooLong, "must not be more than 1000 bytes long")
+}
+
+// Define a ItemModel struct type which wraps a sql.DB connection pool
+type ItemModel struct {
+	DB *sql.DB
+}
+
+const itemColumns = `id, note_id, created_at, text, checked, position, due_at`
+
+// scanDest returns the destinations to Scan a row of itemColumns into.
+func (item *Item) scanDest() []any {
+	return []any{
+		&item.ID,
+		&item.NoteID,
+		&item.CreatedAt,
+		&item.Text,
+		&item.Checked,
+		&item.Position,
+		&item.DueAt,
+	}
+}
+
+// Insert adds an item to the end of a note's checklist.
+func (m ItemModel) Insert(ctx context.Context, item *Item) (err error) {
+	ctx, span := startSpan(ctx, "ItemModel.Insert", "insert_item", noteIDAttr(item.NoteID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		INSERT INTO note_items (note_id, text, checked, due_at, position)
+		VALUES ($1, $2, $3, $4, (SELECT COALESCE(MAX(position), 0) + 1 FROM note_items WHERE note_id = $1))
+		RETURNING id, created_at, position`
+
+	args := []any{item.NoteID, item.Text, item.Checked, item.DueAt}
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		// bumping the note first also locks it, so two items added at the same time
+		// can't end up with the same position
+		if err := touchNote(ctx, tx, item.NoteID); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowContext(ctx, stmt, args...).Scan(&item.ID, &item.CreatedAt, &item.Position)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditItemCreate, item.ID, item.NoteID, nil, item)
+	})
+}
+
+// Get returns an item only if it belongs to the given note.
+func (m ItemModel) Get(ctx context.Context, noteID, id int64) (_ *Item, err error) {
+	ctx, span := startSpan(ctx, "ItemModel.Get", "select_item", noteIDAttr(noteID), attribute.Int64("item.id", id))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + itemColumns + `
+		FROM note_items
+		WHERE id = $1 AND note_id = $2`
+
+	var item Item
+
+	err = m.DB.QueryRowContext(ctx, stmt, id, noteID).Scan(item.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &item, nil
+}
+
+// GetAllForNote returns the checklist of a note in order.
+func (m ItemModel) GetAllForNote(ctx context.Context, noteID int64) (_ []*Item, err error) {
+	ctx, span := startSpan(ctx, "ItemModel.GetAllForNote", "select_items", noteIDAttr(noteID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + itemColumns + `
+		FROM note_items
+		WHERE note_id = $1
+		ORDER BY position, id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*Item{}
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(item.scanDest()...); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(items)))
+
+	return items, nil
+}
+
+// GetAllForNotes returns the checklists of a batch of notes, keyed by note id.
+func (m ItemModel) GetAllForNotes(ctx context.Context, noteIDs []int64) (_ map[int64][]*Item, err error) {
+	ctx, span := startSpan(ctx, "ItemModel.GetAllForNotes", "select_items_for_notes", batchAttr(len(noteIDs)))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + itemColumns + `
+		FROM note_items
+		WHERE note_id = ANY($1)
+		ORDER BY note_id, position, id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, pq.Array(noteIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[int64][]*Item, len(noteIDs))
+	count := 0
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(item.scanDest()...); err != nil {
+			return nil, err
+		}
+		items[item.NoteID] = append(items[item.NoteID], &item)
+		count++
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(count))
+
+	return items, nil
+}
+
+// Update saves the text, checked state and due date of an item.
+func (m ItemModel) Update(ctx context.Context, item *Item) (err error) {
+	ctx, span := startSpan(ctx, "ItemModel.Update", "update_item", noteIDAttr(item.NoteID), attribute.Int64("item.id", item.ID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE note_items
+		SET text = $1, checked = $2, due_at = $3
+		WHERE id = $4 AND note_id = $5`
+
+	args := []any{item.Text, item.Checked, item.DueAt, item.ID, item.NoteID}
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		if err := touchNote(ctx, tx, item.NoteID); err != nil {
+			return err
+		}
+
+		before, err := getItemForUpdate(ctx, tx, item.NoteID, item.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := execOne(ctx, tx, stmt, args...); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditItemUpdate, item.ID, item.NoteID, before, item)
+	})
+}
+
+// Toggle flips the checked state of an item and returns the updated item.
+func (m ItemModel) Toggle(ctx context.Context, noteID, id int64) (_ *Item, err error) {
+	ctx, span := startSpan(ctx, "ItemModel.Toggle", "toggle_item", noteIDAttr(noteID), attribute.Int64("item.id", id))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE note_items
+		SET checked = NOT checked
+		WHERE id = $1 AND note_id = $2
+		RETURNING ` + itemColumns
+
+	var item Item
+
+	err = withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		if err := touchNote(ctx, tx, noteID); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowContext(ctx, stmt, id, noteID).Scan(item.scanDest()...)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+
+		before, after := map[string]bool{"checked": !item.Checked}, map[string]bool{"checked": item.Checked}
+		return recordAudit(ctx, tx, AuditItemUpdate, item.ID, noteID, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// Reorder puts the items of a note into the order given by ids, which must hold
+// every item of the note exactly once.
+func (m ItemModel) Reorder(ctx context.Context, noteID int64, ids []int64) (err error) {
+	ctx, span := startSpan(ctx, "ItemModel.Reorder", "reorder_items", noteIDAttr(noteID), rowsAttr(len(ids)))
+	defer func() { endSpan(span, err) }()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		if err := touchNote(ctx, tx, noteID); err != nil {
+			return err
+		}
+
+		var order []int64
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM note_items WHERE note_id = $1 ORDER BY position`, noteID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			order = append(order, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(order) != len(ids) {
+			return fmt.Errorf("%w: expected %d item ids, got %d", ErrInvalidOrder, len(order), len(ids))
+		}
+
+		for i, id := range ids {
+			stmt := `
+				UPDATE note_items
+				SET position = $1
+				WHERE id = $2 AND note_id = $3`
+
+			err := execOne(ctx, tx, stmt, i+1, id, noteID)
+			if err != nil {
+				if errors.Is(err, ErrRecordNotFound) {
+					return fmt.Errorf("%w: item %d does not belong to the note", ErrInvalidOrder, id)
+				}
+				return err
+			}
+		}
+
+		before, after := map[string][]int64{"item_ids": order}, map[string][]int64{"item_ids": ids}
+		return recordAudit(ctx, tx, AuditItemReorder, noteID, noteID, before, after)
+	})
+}
+
+func (m ItemModel) Delete(ctx context.Context, noteID, id int64) (err error) {
+	ctx, span := startSpan(ctx, "ItemModel.Delete", "delete_item", noteIDAttr(noteID), attribute.Int64("item.id", id))
+	defer func() { endSpan(span, err) }()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		if err := touchNote(ctx, tx, noteID); err != nil {
+			return err
+		}
+
+		var item Item
+
+		err := tx.QueryRowContext(ctx, `DELETE FROM note_items WHERE id = $1 AND note_id = $2 RETURNING `+itemColumns, id, noteID).Scan(item.scanDest()...)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditItemDelete, id, noteID, &item, nil)
+	})
+}
+
+// GetTasks returns a page of checklist items across every note in the workspace
+// that isn't archived. done filters on whether the items are checked, or is nil for all.
+func (m ItemModel) GetTasks(ctx context.Context, done *bool, filters Filters) (_ []*Task, _ Metadata, err error) {
+	ctx, span := startSpan(ctx, "ItemModel.GetTasks", "select_tasks")
+	defer func() { endSpan(span, err) }()
+
+	// items without a due date sort after those with one either way
+	stmt := fmt.Sprintf(`
+		SELECT count(*) OVER(), i.id, i.note_id, i.created_at, i.text, i.checked, i.position, i.due_at, n.title
+		FROM note_items i
+		INNER JOIN notes n ON n.id = i.note_id
+		WHERE NOT n.archived AND n.workspace_id = $4
+		AND (i.checked = $1 OR $1 IS NULL)
+		ORDER BY i.%s %s NULLS LAST, i.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	rows, err := m.DB.QueryContext(ctx, stmt, nullBool(done), filters.limit(), filters.offset(), WorkspaceID(ctx))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	tasks := []*Task{}
+
+	for rows.Next() {
+		var task Task
+
+		dest := append([]any{&totalRecords}, task.scanDest()...)
+		if err := rows.Scan(append(dest, &task.NoteTitle)...); err != nil {
+			return nil, Metadata{}, err
+		}
+
+		tasks = append(tasks, &task)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	span.SetAttributes(rowsAttr(len(tasks)))
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return tasks, metadata, nil
+}
+
+// touchNote bumps the version and last_updated_at of a note when something that
+// belongs to it changes, such as its checklist. Notes outside of the workspace
+// aren't found, which rolls back the change.
+func touchNote(ctx context.Context, tx *sql.Tx, noteID int64) error {
+	stmt := `
+		UPDATE notes
+		SET last_updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND workspace_id = $2`
+
+	return execOne(ctx, tx, stmt, noteID, WorkspaceID(ctx))
+}
+
+// getItemForUpdate reads an item as it is before a change, locking it for the rest
+// of the transaction.
+func getItemForUpdate(ctx context.Context, tx *sql.Tx, noteID, id int64) (*Item, error) {
+	var item Item
+
+	err := tx.QueryRowContext(ctx, `SELECT `+itemColumns+` FROM note_items WHERE id = $1 AND note_id = $2 FOR UPDATE`, id, noteID).Scan(item.scanDest()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// execOne runs a statement which should affect exactly one row, returning
+// ErrRecordNotFound if it matched nothing.
+func execOne(ctx context.Context, tx *sql.Tx, stmt string, args ...any) error {
+	result, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
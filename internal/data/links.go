@@ -0,0 +1,319 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// The kinds of link that can appear in the content of a note.
+const (
+	LinkKindWiki = "wiki" // [[Other Note]], resolved by title
+	LinkKindID   = "id"   // note://123, resolved by id
+)
+
+var (
+	// [[Title]] or [[Title|label shown instead]]
+	wikiLinkRX = regexp.MustCompile(`\[\[([^\[\]|\n]+)(?:\|[^\[\]\n]*)?\]\]`)
+	idLinkRX   = regexp.MustCompile(`note://([0-9]+)`)
+)
+
+// Link is a reference from one note to another. Wiki links are matched against
+// note titles without regard to case whenever they are read, so a link to a note
+// that doesn't exist yet starts resolving as soon as that note is created.
+type Link struct {
+	Kind        string  `json:"kind"`                   // wiki or id
+	Text        string  `json:"text"`                   // the title or id as written in the content
+	TargetID    *int64  `json:"target_id"`              // note the link resolves to, null if none
+	TargetTitle *string `json:"target_title,omitempty"` // title of the note the link resolves to
+}
+
+// LinkedNote is the short form of a note used in link listings and the graph.
+type LinkedNote struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// Edge is a resolved link between two notes in the graph.
+type Edge struct {
+	Source int64 `json:"source"`
+	Target int64 `json:"target"`
+}
+
+type parsedLink struct {
+	kind  string
+	id    int64
+	title string
+}
+
+// parseLinks finds every wiki and note:// link in content, with duplicates removed.
+func parseLinks(content string) []parsedLink {
+	var links []parsedLink
+	seen := make(map[string]bool)
+
+	for _, m := range wikiLinkRX.FindAllStringSubmatch(content, -1) {
+		title := strings.TrimSpace(m[1])
+		key := LinkKindWiki + ":" + strings.ToLower(title)
+		if title == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		links = append(links, parsedLink{kind: LinkKindWiki, title: title})
+	}
+
+	for _, m := range idLinkRX.FindAllStringSubmatch(content, -1) {
+		id, err := strconv.ParseInt(m[1], 10, 64)
+		key := LinkKindID + ":" + m[1]
+		if err != nil || id < 1 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		links = append(links, parsedLink{kind: LinkKindID, id: id})
+	}
+
+	return links
+}
+
+// replaceLinks swaps out the stored links of a note for those found in its
+// content. It runs inside the transaction that saves the note itself.
+func replaceLinks(ctx context.Context, tx *sql.Tx, noteID int64, content string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM note_links WHERE source_id = $1`, noteID)
+	if err != nil {
+		return err
+	}
+
+	for _, link := range parseLinks(content) {
+		stmt := `
+			INSERT INTO note_links (source_id, kind, target_id, target_title)
+			VALUES ($1, $2, $3, $4)`
+
+		args := []any{
+			noteID,
+			link.kind,
+			sql.NullInt64{Int64: link.id, Valid: link.kind == LinkKindID},
+			sql.NullString{String: link.title, Valid: link.kind == LinkKindWiki},
+		}
+
+		if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rewriteWikiLinks replaces every [[oldTitle]] reference in content with newTitle,
+// matching the old title without regard to case and keeping any |label part.
+func rewriteWikiLinks(content, oldTitle, newTitle string) string {
+	rx := regexp.MustCompile(`(?i)\[\[\s*` + regexp.QuoteMeta(strings.TrimSpace(oldTitle)) + `\s*(\||\]\])`)
+	return rx.ReplaceAllStringFunc(content, func(match string) string {
+		// keep whichever of "|" or "]]" ended the title
+		if strings.HasSuffix(match, "|") {
+			return "[[" + newTitle + "|"
+		}
+		return "[[" + newTitle + "]]"
+	})
+}
+
+// Define a LinkModel struct type which wraps a sql.DB connection pool
+type LinkModel struct {
+	DB *sql.DB
+}
+
+// resolvedLinks joins each link onto the note it is found in, src, and the notes
+// it points at, t. A wiki link can match more than one note when titles are
+// shared, and matches none if no note has the title yet. Links only ever resolve
+// to notes in the same workspace as src.
+const resolvedLinks = `
+	note_links l
+	INNER JOIN notes src ON src.id = l.source_id
+	LEFT JOIN notes t ON t.workspace_id = src.workspace_id AND (
+		(l.kind = 'id' AND t.id = l.target_id) OR
+		(l.kind = 'wiki' AND lower(t.title) = lower(l.target_title)))`
+
+// GetOutgoing returns the links found in the content of a note.
+func (m LinkModel) GetOutgoing(ctx context.Context, noteID int64) (_ []*Link, err error) {
+	ctx, span := startSpan(ctx, "LinkModel.GetOutgoing", "select_outgoing_links", noteIDAttr(noteID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT l.kind, COALESCE(l.target_title, l.target_id::text), t.id, t.title
+		FROM ` + resolvedLinks + `
+		WHERE l.source_id = $1 AND src.workspace_id = $2
+		ORDER BY l.kind, COALESCE(l.target_title, l.target_id::text), t.id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, noteID, WorkspaceID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*Link{}
+
+	for rows.Next() {
+		var link Link
+		var targetID sql.NullInt64
+		var targetTitle sql.NullString
+
+		err := rows.Scan(&link.Kind, &link.Text, &targetID, &targetTitle)
+		if err != nil {
+			return nil, err
+		}
+
+		if targetID.Valid {
+			link.TargetID = &targetID.Int64
+			link.TargetTitle = &targetTitle.String
+		}
+
+		links = append(links, &link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(links)))
+
+	return links, nil
+}
+
+// GetBacklinks returns the notes which link to the given note.
+func (m LinkModel) GetBacklinks(ctx context.Context, noteID int64) (_ []*LinkedNote, err error) {
+	ctx, span := startSpan(ctx, "LinkModel.GetBacklinks", "select_backlinks", noteIDAttr(noteID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT DISTINCT src.id, src.title
+		FROM ` + resolvedLinks + `
+		WHERE t.id = $1 AND src.id <> $1 AND src.workspace_id = $2
+		ORDER BY src.id`
+
+	notes, err := m.queryLinkedNotes(ctx, stmt, noteID, WorkspaceID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(notes)))
+
+	return notes, nil
+}
+
+// GetBacklinkNotes returns the notes linking to each of a batch of notes, keyed by
+// the id of the note they link to. Unlike GetBacklinks the whole of each linking
+// note is returned.
+func (m LinkModel) GetBacklinkNotes(ctx context.Context, noteIDs []int64) (_ map[int64][]*Note, err error) {
+	ctx, span := startSpan(ctx, "LinkModel.GetBacklinkNotes", "select_backlink_notes", batchAttr(len(noteIDs)))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT b.target_id, ` + noteColumns + `
+		FROM notes
+		INNER JOIN (
+			SELECT DISTINCT t.id AS target_id, l.source_id
+			FROM ` + resolvedLinks + `
+			WHERE t.id = ANY($1) AND l.source_id <> t.id AND src.workspace_id = $2
+		) b ON b.source_id = notes.id
+		ORDER BY b.target_id, notes.id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, pq.Array(noteIDs), WorkspaceID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backlinks := make(map[int64][]*Note, len(noteIDs))
+	count := 0
+
+	for rows.Next() {
+		var targetID int64
+		var note Note
+
+		if err := rows.Scan(append([]any{&targetID}, note.scanDest()...)...); err != nil {
+			return nil, err
+		}
+
+		backlinks[targetID] = append(backlinks[targetID], &note)
+		count++
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(count))
+
+	return backlinks, nil
+}
+
+// GetGraph returns every note in the workspace as a node along with an edge for
+// each resolved link.
+func (m LinkModel) GetGraph(ctx context.Context) (_ []*LinkedNote, _ []*Edge, err error) {
+	ctx, span := startSpan(ctx, "LinkModel.GetGraph", "select_graph")
+	defer func() { endSpan(span, err) }()
+
+	workspaceID := WorkspaceID(ctx)
+
+	nodes, err := m.queryLinkedNotes(ctx, `SELECT id, title FROM notes WHERE workspace_id = $1 ORDER BY id`, workspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stmt := `
+		SELECT DISTINCT l.source_id, t.id
+		FROM ` + resolvedLinks + `
+		WHERE t.id IS NOT NULL AND t.id <> l.source_id AND src.workspace_id = $1
+		ORDER BY l.source_id, t.id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, workspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	edges := []*Edge{}
+
+	for rows.Next() {
+		var edge Edge
+		if err := rows.Scan(&edge.Source, &edge.Target); err != nil {
+			return nil, nil, err
+		}
+		edges = append(edges, &edge)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	span.SetAttributes(attribute.Int("graph.nodes", len(nodes)), attribute.Int("graph.edges", len(edges)))
+
+	return nodes, edges, nil
+}
+
+func (m LinkModel) queryLinkedNotes(ctx context.Context, stmt string, args ...any) ([]*LinkedNote, error) {
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*LinkedNote{}
+
+	for rows.Next() {
+		var note LinkedNote
+		if err := rows.Scan(&note.ID, &note.Title); err != nil {
+			return nil, err
+		}
+		notes = append(notes, &note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
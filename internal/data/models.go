@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -10,18 +11,64 @@ import (
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
+	ErrInvalidOrder   = errors.New("invalid order")
+	ErrTemplateRender = errors.New("template could not be rendered")
+	ErrDuplicateSlug  = errors.New("duplicate slug")
+	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrLastOwner      = errors.New("last owner")
+	ErrLinkLocked     = errors.New("link locked")
 )
 
 // Create a Models struct which wraps the MovieModel. We'll add other models to this,
 // like a UserModel and PermissionModel, as our build progresses.
 type Models struct {
-	Notes NoteModel
+	Notes           NoteModel
+	Attachments     AttachmentModel
+	Links           LinkModel
+	Reminders       ReminderModel
+	Items           ItemModel
+	Templates       TemplateModel
+	PublicLinks     PublicLinkModel
+	Schema          SchemaModel
+	Audit           AuditModel
+	Workspaces      WorkspaceModel
+	Members         MemberModel
+	Invitations     InvitationModel
+	IdempotencyKeys IdempotencyKeyModel
 }
 
 // For ease of use, we also add a New() method which returns a Models struct containing
 // the initialized MovieModel.
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Notes: NoteModel{DB: db},
+		Notes:           NoteModel{DB: db},
+		Attachments:     AttachmentModel{DB: db},
+		Links:           LinkModel{DB: db},
+		Reminders:       ReminderModel{DB: db},
+		Items:           ItemModel{DB: db},
+		Templates:       TemplateModel{DB: db},
+		PublicLinks:     PublicLinkModel{DB: db},
+		Schema:          SchemaModel{DB: db},
+		Audit:           AuditModel{DB: db},
+		Workspaces:      WorkspaceModel{DB: db},
+		Members:         MemberModel{DB: db},
+		Invitations:     InvitationModel{DB: db},
+		IdempotencyKeys: IdempotencyKeyModel{DB: db},
 	}
 }
+
+// withTx runs fn inside of a transaction, committing if it returns nil and rolling
+// back otherwise.
+func withTx(ctx context.Context, db *sql.DB, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -1,12 +1,20 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/KevuTheDev/notes-backend-api/internal/validator"
 	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Must be in LOWERCASE
@@ -17,59 +25,178 @@ var ValidTags = map[string]string{
 }
 
 type Note struct {
-	ID           int64     `json:"id"`                // unique id for the note
-	CreatedAt    time.Time `json:"created_at"`        // when the note was created
-	LastUpdateAt time.Time `json:"last_updated_at"`   // when the note was last updated
-	Title        string    `json:"title"`             // title of note
-	Content      string    `json:"content,omitempty"` // content of note
-	Tags         []string  `json:"tags,omitempty"`    // tags of note
-	Version      int32     `json:"version"`           // number of times the note was updated
+	ID           int64      `json:"id"`                   // unique id for the note
+	CreatedAt    time.Time  `json:"created_at"`           // when the note was created
+	LastUpdateAt time.Time  `json:"last_updated_at"`      // when the note was last updated
+	Title        string     `json:"title"`                // title of note
+	Content      string     `json:"content,omitempty"`    // content of note
+	Tags         []string   `json:"tags,omitempty"`       // tags of note
+	Pinned       bool       `json:"pinned"`               // pinned notes are listed first
+	Archived     bool       `json:"archived"`             // archived notes are hidden from listings
+	Color        string     `json:"color,omitempty"`      // background color of the note
+	RemindAt     *time.Time `json:"remind_at,omitempty"`  // when the next reminder for the note fires
+	Recurrence   string     `json:"recurrence,omitempty"` // RRULE describing how the reminder repeats
+	Version      int32      `json:"version"`              // number of times the note was updated
+	WorkspaceID  int64      `json:"-"`                    // workspace the note belongs to
 }
 
+// noteColumns lists the columns of the notes table in the order that scanDest
+// expects them.
+const noteColumns = `id, created_at, last_updated_at, title, content, tags, pinned, archived, color,
+	remind_at, recurrence, version, workspace_id`
+
+// scanDest returns the destinations to Scan a row of noteColumns into.
+func (note *Note) scanDest() []any {
+	return []any{
+		&note.ID,
+		&note.CreatedAt,
+		&note.LastUpdateAt,
+		&note.Title,
+		&note.Content,
+		pq.Array(&note.Tags),
+		&note.Pinned,
+		&note.Archived,
+		&note.Color,
+		&note.RemindAt,
+		&note.Recurrence,
+		&note.Version,
+		&note.WorkspaceID,
+	}
+}
+
+// Named colors a note can be given, on top of any "#rrggbb" hex color.
+var NoteColors = []string{"red", "orange", "yellow", "green", "teal", "blue", "purple", "pink", "brown", "gray"}
+
+var hexColorRX = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
+
 func ValidateNote(v *validator.Validator, note *Note) {
-	v.Check(note.Title != "", "title", "must be provided")
-	v.Check(len(note.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(note.Title != "", "title", validator.CodeRequired, "must be provided")
+	v.Check(len(note.Title) <= 500, "title", validator.CodeTooLong, "must not be more than 500 bytes long")
 
 	// TODO
 	// VALID TAGS ARE OFF
-	// v.Check(validator.PermittedValues(note.Tags, ValidTags), "tags", "invalid tags accepted")
+	// v.Check(validator.PermittedValues(note.Tags, ValidTags), "tags", validator.CodeNotPermitted, "invalid tags accepted")
+
+	v.Check(validator.Unique(note.Tags), "tags", validator.CodeDuplicate, "must not contain duplicate values")
 
-	v.Check(validator.Unique(note.Tags), "tags", "must not contain duplicate values")
+	v.Check(note.Color == "" || validator.PermittedValue(note.Color, NoteColors...) || validator.Matches(note.Color, hexColorRX),
+		"color", validator.CodeInvalidFormat, "must be a named color or a #rrggbb hex value")
+
+	if note.Recurrence != "" {
+		_, err := ParseRecurrence(note.Recurrence)
+		v.Check(err == nil, "recurrence", validator.CodeInvalidFormat, fmt.Sprintf("must be a valid RRULE: %v", err))
+		v.Check(note.RemindAt != nil, "remind_at", validator.CodeRequired, "must be provided when recurrence is set")
+	}
 }
 
-// Define a NoteModel struct type which wraps a sql.DB connection pool
+// Define a NoteModel struct type which wraps a sql.DB connection pool. Every
+// method only sees the notes in the workspace picked for its context with
+// WithWorkspace.
 type NoteModel struct {
 	DB *sql.DB
 }
 
-func (n NoteModel) Insert(note *Note) error {
+func (n NoteModel) Insert(ctx context.Context, note *Note) (err error) {
+	ctx, span := startSpan(ctx, "NoteModel.Insert", "insert_note")
+	defer func() { endSpan(span, err) }()
+
 	stmt := `
-		INSERT INTO notes (title, content, tags)
-		VALUES ($1, $2, $3)
+		INSERT INTO notes (title, content, tags, pinned, archived, color, remind_at, recurrence, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, created_at, last_updated_at, version`
 
-	args := []any{note.Title, note.Content, pq.Array(note.Tags)}
+	note.WorkspaceID = WorkspaceID(ctx)
+
+	args := []any{
+		note.Title,
+		note.Content,
+		pq.Array(note.Tags),
+		note.Pinned,
+		note.Archived,
+		note.Color,
+		note.RemindAt,
+		note.Recurrence,
+		note.WorkspaceID,
+	}
+
+	// the note and the links found in its content are saved together
+	return withTx(ctx, n.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, stmt, args...).Scan(&note.ID, &note.CreatedAt, &note.LastUpdateAt, &note.Version)
+		if err != nil {
+			return err
+		}
+
+		span.SetAttributes(noteIDAttr(note.ID))
+
+		if err := replaceLinks(ctx, tx, note.ID, note.Content); err != nil {
+			return err
+		}
 
-	return n.DB.QueryRow(stmt, args...).Scan(&note.ID, &note.CreatedAt, &note.LastUpdateAt, &note.Version)
+		return recordAudit(ctx, tx, AuditNoteCreate, note.ID, note.ID, nil, note)
+	})
 }
 
-func (n NoteModel) Get(id int64) (*Note, error) {
+// Import inserts a note while keeping the created_at and last_updated_at values
+// that came with it, falling back to NOW() for any timestamp that is not set.
+func (n NoteModel) Import(ctx context.Context, note *Note) (err error) {
+	ctx, span := startSpan(ctx, "NoteModel.Import", "import_note")
+	defer func() { endSpan(span, err) }()
+
 	stmt := `
-		SELECT id, created_at, last_updated_at, title, content, tags, version 
+		INSERT INTO notes (title, content, tags, pinned, archived, color, remind_at, recurrence,
+			created_at, last_updated_at, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, NOW()), COALESCE($10, COALESCE($9, NOW())), $11)
+		RETURNING id, created_at, last_updated_at, version`
+
+	// the tags column does not allow NULL, which is what a nil slice becomes
+	if note.Tags == nil {
+		note.Tags = []string{}
+	}
+
+	note.WorkspaceID = WorkspaceID(ctx)
+
+	args := []any{
+		note.Title,
+		note.Content,
+		pq.Array(note.Tags),
+		note.Pinned,
+		note.Archived,
+		note.Color,
+		note.RemindAt,
+		note.Recurrence,
+		nullTime(note.CreatedAt),
+		nullTime(note.LastUpdateAt),
+		note.WorkspaceID,
+	}
+
+	return withTx(ctx, n.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, stmt, args...).Scan(&note.ID, &note.CreatedAt, &note.LastUpdateAt, &note.Version)
+		if err != nil {
+			return err
+		}
+
+		span.SetAttributes(noteIDAttr(note.ID))
+
+		if err := replaceLinks(ctx, tx, note.ID, note.Content); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditNoteImport, note.ID, note.ID, nil, note)
+	})
+}
+
+func (n NoteModel) Get(ctx context.Context, id int64) (_ *Note, err error) {
+	ctx, span := startSpan(ctx, "NoteModel.Get", "select_note", noteIDAttr(id))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + noteColumns + `
 		FROM notes
-		WHERE id = $1`
+		WHERE id = $1 AND workspace_id = $2`
 
 	var note Note
 
-	err := n.DB.QueryRow(stmt, id).Scan(
-		&note.ID,
-		&note.CreatedAt,
-		&note.LastUpdateAt,
-		&note.Title,
-		&note.Content,
-		pq.Array(&note.Tags),
-		&note.Version,
-	)
+	err = n.DB.QueryRowContext(ctx, stmt, id, WorkspaceID(ctx)).Scan(note.scanDest()...)
 
 	if err != nil {
 		switch {
@@ -83,22 +210,458 @@ func (n NoteModel) Get(id int64) (*Note, error) {
 	return &note, nil
 }
 
-func (n NoteModel) Update(note *Note) error {
+// GetMany looks up a batch of notes by id in one query, returning them keyed by
+// id. Ids with no note are left out of the map.
+func (n NoteModel) GetMany(ctx context.Context, ids []int64) (_ map[int64]*Note, err error) {
+	ctx, span := startSpan(ctx, "NoteModel.GetMany", "select_notes_by_id", batchAttr(len(ids)))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + noteColumns + `
+		FROM notes
+		WHERE id = ANY($1) AND workspace_id = $2`
+
+	rows, err := n.DB.QueryContext(ctx, stmt, pq.Array(ids), WorkspaceID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := make(map[int64]*Note, len(ids))
+
+	for rows.Next() {
+		var note Note
+		if err := rows.Scan(note.scanDest()...); err != nil {
+			return nil, err
+		}
+		notes[note.ID] = &note
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(notes)))
+
+	return notes, nil
+}
+
+// GetBatch returns up to limit notes with ids above afterID, in id order. Passing
+// the id of the last note returned steps through every note a batch at a time.
+func (n NoteModel) GetBatch(ctx context.Context, afterID int64, limit int) (_ []*Note, err error) {
+	ctx, span := startSpan(ctx, "NoteModel.GetBatch", "select_notes_batch", batchAttr(limit))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + noteColumns + `
+		FROM notes
+		WHERE id > $1 AND workspace_id = $3
+		ORDER BY id
+		LIMIT $2`
+
+	rows, err := n.DB.QueryContext(ctx, stmt, afterID, limit, WorkspaceID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*Note{}
+
+	for rows.Next() {
+		var note Note
+		if err := rows.Scan(note.scanDest()...); err != nil {
+			return nil, err
+		}
+		notes = append(notes, &note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(notes)))
+
+	return notes, nil
+}
+
+// TagCount is a tag along with the number of notes that have it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Notes int    `json:"notes"`
+}
+
+// GetTags returns every tag in use, in alphabetical order.
+func (n NoteModel) GetTags(ctx context.Context) (_ []*TagCount, err error) {
+	ctx, span := startSpan(ctx, "NoteModel.GetTags", "select_tags")
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT tag, count(*)
+		FROM notes, unnest(tags) AS tag
+		WHERE workspace_id = $1
+		GROUP BY tag
+		ORDER BY tag`
+
+	rows, err := n.DB.QueryContext(ctx, stmt, WorkspaceID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*TagCount{}
+
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Notes); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(tags)))
+
+	return tags, nil
+}
+
+// NoteQuery narrows down which notes are returned by GetAll.
+type NoteQuery struct {
+	Search      string   // full text search over the title and content
+	Tags        []string // notes must have all of these tags
+	Archived    bool     // list archived notes instead of active ones
+	Pinned      *bool    // only pinned or only unpinned notes, if set
+	PinnedFirst bool     // list pinned notes ahead of the rest
+}
+
+// GetAll returns a page of notes matching the query. Archived notes are only ever
+// listed when asked for, though they can still be fetched directly with Get.
+//
+// Pages are picked by number, or by the cursor in filters if there is one. A
+// cursor picks the page by the sort values of the note next to it, so the page
+// doesn't shift when notes are added or removed in the meantime. The total isn't
+// counted for those pages, since that would mean reading every matching note.
+func (n NoteModel) GetAll(ctx context.Context, query NoteQuery, filters Filters) (_ []*Note, _ Metadata, err error) {
+	ctx, span := startSpan(ctx, "NoteModel.GetAll", "select_notes")
+	defer func() { endSpan(span, err) }()
+
+	tags := query.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	args := []any{
+		query.Search,
+		pq.Array(tags),
+		query.Archived,
+		nullBool(query.Pinned),
+		WorkspaceID(ctx),
+	}
+
+	keys := noteSortKeys(query, filters)
+	cursor := filters.Cursor
+
+	count := "count(*) OVER()"
+	keyset := ""
+	limit, offset := filters.limit(), filters.offset()
+
+	if cursor != nil {
+		// the rows before a cursor are read backwards, then put back in order
+		if cursor.Before {
+			keys = reverseKeys(keys)
+		}
+
+		if err := setCursorValues(keys, *cursor); err != nil {
+			return nil, Metadata{}, err
+		}
+
+		var keysetArgs []any
+		keyset, keysetArgs = keysetWhere(keys, len(args)+1)
+		keyset = "AND " + keyset
+		args = append(args, keysetArgs...)
+
+		// one extra row says whether there's another page
+		count = "0"
+		limit, offset = limit+1, 0
+	}
+
+	stmt := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM notes
+		WHERE (to_tsvector('simple', title || ' ' || content) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (tags @> $2 OR $2 = '{}')
+		AND archived = $3
+		AND (pinned = $4 OR $4 IS NULL)
+		AND workspace_id = $5
+		%s
+		ORDER BY %s
+		LIMIT %d OFFSET %d`, count, noteColumns, keyset, keysetOrder(keys), limit, offset)
+
+	rows, err := n.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	notes := []*Note{}
+
+	for rows.Next() {
+		var note Note
+
+		err := rows.Scan(append([]any{&totalRecords}, note.scanDest()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		notes = append(notes, &note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	span.SetAttributes(rowsAttr(len(notes)))
+
+	if cursor == nil {
+		metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+		if len(notes) > 0 {
+			if filters.offset()+len(notes) < totalRecords {
+				metadata.NextCursor = noteCursor(notes[len(notes)-1], query, filters, false)
+			}
+			if filters.Page > 1 {
+				metadata.PrevCursor = noteCursor(notes[0], query, filters, true)
+			}
+		}
+
+		return notes, metadata, nil
+	}
+
+	more := len(notes) > filters.limit()
+	if more {
+		notes = notes[:filters.limit()]
+	}
+
+	if cursor.Before {
+		slices.Reverse(notes)
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+
+	// there's always a page back the way the cursor came from
+	if len(notes) > 0 {
+		if more || cursor.Before {
+			metadata.NextCursor = noteCursor(notes[len(notes)-1], query, filters, false)
+		}
+		if more || !cursor.Before {
+			metadata.PrevCursor = noteCursor(notes[0], query, filters, true)
+		}
+	}
+
+	return notes, metadata, nil
+}
+
+// noteSortKeys returns the order notes are listed in. Ties are broken by id, in
+// the same direction as the sort so that the composite indexes can be used.
+func noteSortKeys(query NoteQuery, filters Filters) []keysetKey {
+	desc := filters.sortDirection() == "DESC"
+
+	var keys []keysetKey
+
+	if query.PinnedFirst {
+		keys = append(keys, keysetKey{column: "pinned", desc: true})
+	}
+
+	if column := filters.sortColumn(); column != "id" {
+		keys = append(keys, keysetKey{column: column, desc: desc})
+	}
+
+	return append(keys, keysetKey{column: "id", desc: desc})
+}
+
+// setCursorValues fills in the value of each key from the cursor.
+func setCursorValues(keys []keysetKey, cursor Cursor) error {
+	for i := range keys {
+		switch keys[i].column {
+		case "pinned":
+			if cursor.Pinned == nil {
+				return ErrInvalidCursor
+			}
+			keys[i].value = *cursor.Pinned
+		case "id":
+			keys[i].value = cursor.ID
+		default:
+			value, err := parseSortValue(keys[i].column, cursor.Value)
+			if err != nil {
+				return ErrInvalidCursor
+			}
+			keys[i].value = value
+		}
+	}
+
+	return nil
+}
+
+// noteCursor returns the cursor for the page after note, or before it.
+func noteCursor(note *Note, query NoteQuery, filters Filters, before bool) *Cursor {
+	c := &Cursor{Sort: filters.Sort, ID: note.ID, Before: before}
+
+	if query.PinnedFirst {
+		pinned := note.Pinned
+		c.Pinned = &pinned
+	}
+
+	switch filters.sortColumn() {
+	case "id":
+		c.Value = strconv.FormatInt(note.ID, 10)
+	case "title":
+		c.Value = note.Title
+	case "created_at":
+		c.Value = note.CreatedAt.Format(time.RFC3339Nano)
+	case "last_updated_at":
+		c.Value = note.LastUpdateAt.Format(time.RFC3339Nano)
+	}
+
+	return c
+}
+
+func (n NoteModel) Update(ctx context.Context, note *Note) (err error) {
+	ctx, span := startSpan(ctx, "NoteModel.Update", "update_note", noteIDAttr(note.ID))
+	defer func() { endSpan(span, err) }()
+
+	return withTx(ctx, n.DB, func(tx *sql.Tx) error {
+		return update(ctx, tx, note)
+	})
+}
+
+// UpdateAndRewriteLinks saves a note whose title changed from oldTitle, and in the
+// same transaction rewrites every [[oldTitle]] reference in other notes to point
+// at the new title. The ids of the rewritten notes are returned.
+func (n NoteModel) UpdateAndRewriteLinks(ctx context.Context, note *Note, oldTitle string) (_ []int64, err error) {
+	ctx, span := startSpan(ctx, "NoteModel.UpdateAndRewriteLinks", "update_note_and_rewrite_links", noteIDAttr(note.ID))
+	defer func() { endSpan(span, err) }()
+
+	var rewritten []int64
+
+	err = withTx(ctx, n.DB, func(tx *sql.Tx) error {
+		if err := update(ctx, tx, note); err != nil {
+			return err
+		}
+
+		if strings.EqualFold(strings.TrimSpace(oldTitle), strings.TrimSpace(note.Title)) {
+			return nil
+		}
+
+		// lock the linking notes so a concurrent edit can't slip in between reading
+		// and rewriting their content
+		stmt := `
+			SELECT n.id, n.content
+			FROM notes n
+			WHERE n.id <> $2 AND n.workspace_id = $3 AND EXISTS (
+				SELECT 1 FROM note_links l
+				WHERE l.source_id = n.id AND l.kind = 'wiki' AND lower(l.target_title) = lower($1)
+			)
+			FOR UPDATE`
+
+		rows, err := tx.QueryContext(ctx, stmt, strings.TrimSpace(oldTitle), note.ID, WorkspaceID(ctx))
+		if err != nil {
+			return err
+		}
+
+		contents := make(map[int64]string)
+		for rows.Next() {
+			var id int64
+			var content string
+			if err := rows.Scan(&id, &content); err != nil {
+				rows.Close()
+				return err
+			}
+			contents[id] = content
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for id, content := range contents {
+			content = rewriteWikiLinks(content, oldTitle, note.Title)
+
+			stmt := `
+				UPDATE notes
+				SET content = $1, last_updated_at = NOW(), version = version + 1
+				WHERE id = $2`
+
+			if _, err := tx.ExecContext(ctx, stmt, content, id); err != nil {
+				return err
+			}
+
+			if err := replaceLinks(ctx, tx, id, content); err != nil {
+				return err
+			}
+
+			before, after := map[string]string{"content": contents[id]}, map[string]string{"content": content}
+			if err := recordAudit(ctx, tx, AuditNoteUpdate, id, id, before, after); err != nil {
+				return err
+			}
+
+			rewritten = append(rewritten, id)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(rewritten, func(i, j int) bool { return rewritten[i] < rewritten[j] })
+
+	span.SetAttributes(attribute.Int("notes.rewritten", len(rewritten)))
+
+	return rewritten, nil
+}
+
+// update saves the changes to a note as long as its version has not moved on,
+// along with the links found in its new content and an audit event.
+func update(ctx context.Context, tx *sql.Tx, note *Note) error {
+	// the note as it was is locked and read first, for the audit event
+	var before Note
+
+	err := tx.QueryRowContext(ctx, `SELECT `+noteColumns+` FROM notes WHERE id = $1 AND workspace_id = $2 FOR UPDATE`, note.ID, WorkspaceID(ctx)).Scan(before.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
 	stmt := `
 		UPDATE notes
-		SET title = $1, content = $2, tags = $3, last_updated_at = NOW(), version = version + 1
-		WHERE id = $4 AND version= $5
+		SET title = $1, content = $2, tags = $3, pinned = $4, archived = $5, color = $6,
+			reminder_count = CASE WHEN remind_at IS DISTINCT FROM $7 OR recurrence <> $8 THEN 0 ELSE reminder_count END,
+			remind_at = $7, recurrence = $8,
+			last_updated_at = NOW(), version = version + 1
+		WHERE id = $9 AND version= $10
 		RETURNING version, last_updated_at`
 
 	args := []any{
 		note.Title,
 		note.Content,
 		pq.Array(note.Tags),
+		note.Pinned,
+		note.Archived,
+		note.Color,
+		note.RemindAt,
+		note.Recurrence,
 		note.ID,
 		note.Version,
 	}
 
-	err := n.DB.QueryRow(stmt, args...).Scan(&note.Version, &note.LastUpdateAt)
+	err = tx.QueryRowContext(ctx, stmt, args...).Scan(&note.Version, &note.LastUpdateAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -108,31 +671,82 @@ func (n NoteModel) Update(note *Note) error {
 		}
 	}
 
-	return nil
+	if err := replaceLinks(ctx, tx, note.ID, note.Content); err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, tx, AuditNoteUpdate, note.ID, note.ID, &before, note)
 }
 
-func (n NoteModel) Delete(id int64) error {
+// Delete deletes a note along with its attachments, and returns the storage keys
+// of the attachments so their blobs can be deleted too. The note is locked first,
+// so an attachment can't be added while it's being deleted and lose its row to
+// the cascade without its blob being cleaned up.
+func (n NoteModel) Delete(ctx context.Context, id int64) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "NoteModel.Delete", "delete_note", noteIDAttr(id))
+	defer func() { endSpan(span, err) }()
+
 	if id < 1 {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
 	}
 
-	query := `
-		DELETE FROM notes
-		WHERE id = $1`
+	var keys []string
 
-	result, err := n.DB.Exec(query, id)
-	if err != nil {
-		return err
-	}
+	err = withTx(ctx, n.DB, func(tx *sql.Tx) error {
+		var note Note
+
+		err := tx.QueryRowContext(ctx, `SELECT `+noteColumns+` FROM notes WHERE id = $1 AND workspace_id = $2 FOR UPDATE`, id, WorkspaceID(ctx)).Scan(note.scanDest()...)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
 
-	rowsAffected, err := result.RowsAffected()
+		rows, err := tx.QueryContext(ctx, `DELETE FROM note_attachments WHERE note_id = $1 RETURNING storage_key`, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM notes WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+
+		// the note as it was goes in the audit event, so it holds everything it had
+		return recordAudit(ctx, tx, AuditNoteDelete, id, id, &note, nil)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	return keys, nil
+}
+
+// nullBool converts an optional bool into a value that is NULL when unset.
+func nullBool(b *bool) sql.NullBool {
+	if b == nil {
+		return sql.NullBool{}
 	}
+	return sql.NullBool{Bool: *b, Valid: true}
+}
 
-	return nil
+// nullTime converts a zero time into a NULL so the database default can be used.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
 }
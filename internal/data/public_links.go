@@ -0,0 +1,336 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PublicLink gives read-only access to a single note to anyone holding its token.
+// Only a hash of the token is stored, so the plaintext is only ever seen in the
+// response to creating the link.
+type PublicLink struct {
+	ID             int64      `json:"id"`                         // unique id for the link
+	NoteID         int64      `json:"note_id"`                    // note shared by the link
+	CreatedAt      time.Time  `json:"created_at"`                 // when the link was created
+	Token          string     `json:"token,omitempty"`            // plaintext token, only set on creation
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`       // when the link stops working, if ever
+	MaxViews       *int       `json:"max_views,omitempty"`        // how many times the link can be viewed, if limited
+	Views          int        `json:"views"`                      // how many times the link has been viewed
+	HasPassword    bool       `json:"has_password"`               // whether a password is needed to view the note
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"` // when the link was last viewed
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`     // when the link can be tried again after too many wrong passwords
+	WorkspaceID    int64      `json:"-"`                          // workspace of the note, only set by GetByToken
+	tokenHash      []byte
+	passwordHash   []byte
+}
+
+func ValidatePublicLink(v *validator.Validator, link *PublicLink, password string) {
+	if link.ExpiresAt != nil {
+		v.Check(link.ExpiresAt.After(time.Now()), "expires_at", validator.CodeInvalid, "must be in the future")
+	}
+
+	if link.MaxViews != nil {
+		v.Check(*link.MaxViews > 0, "max_views", validator.CodeTooSmall, "must be greater than zero")
+	}
+
+	// bcrypt only looks at the first 72 bytes
+	v.Check(len(password) <= 72, "password", validator.CodeTooLong, "must not be more than 72 bytes long")
+}
+
+// SetPassword stores a bcrypt hash of password, or clears it if empty.
+func (link *PublicLink) SetPassword(password string) error {
+	if password == "" {
+		link.passwordHash = nil
+		link.HasPassword = false
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	link.passwordHash = hash
+	link.HasPassword = true
+	return nil
+}
+
+// PasswordMatches reports whether password unlocks the link. Links without a
+// password always match.
+func (link *PublicLink) PasswordMatches(password string) (bool, error) {
+	if !link.HasPassword {
+		return true, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword(link.passwordHash, []byte(password))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// A link is locked for PasswordLockout once MaxPasswordFailures wrong passwords
+// have been tried in a row, so its password can't be guessed at any speed.
+const (
+	MaxPasswordFailures = 5
+	PasswordLockout     = 15 * time.Minute
+)
+
+// Locked reports whether the link is locked after too many wrong passwords.
+func (link *PublicLink) Locked(now time.Time) bool {
+	return link.LockedUntil != nil && now.Before(*link.LockedUntil)
+}
+
+// Usable reports whether the link has neither expired nor run out of views.
+func (link *PublicLink) Usable(now time.Time) bool {
+	if link.ExpiresAt != nil && !now.Before(*link.ExpiresAt) {
+		return false
+	}
+
+	if link.MaxViews != nil && link.Views >= *link.MaxViews {
+		return false
+	}
+
+	return true
+}
+
+// Define a PublicLinkModel struct type which wraps a sql.DB connection pool
+type PublicLinkModel struct {
+	DB *sql.DB
+}
+
+const publicLinkColumns = `id, note_id, created_at, token_hash, expires_at, max_views, views, password_hash, last_accessed_at,
+	locked_until`
+
+// scanDest returns the destinations to Scan a row of publicLinkColumns into.
+func (link *PublicLink) scanDest() []any {
+	return []any{
+		&link.ID,
+		&link.NoteID,
+		&link.CreatedAt,
+		&link.tokenHash,
+		&link.ExpiresAt,
+		&link.MaxViews,
+		&link.Views,
+		&link.passwordHash,
+		&link.LastAccessedAt,
+		&link.LockedUntil,
+	}
+}
+
+// Insert generates a new token for the link and saves it. The plaintext token is
+// set on the link so it can be handed back to the caller.
+func (m PublicLinkModel) Insert(ctx context.Context, link *PublicLink) (err error) {
+	ctx, span := startSpan(ctx, "PublicLinkModel.Insert", "insert_public_link", noteIDAttr(link.NoteID))
+	defer func() { endSpan(span, err) }()
+
+	link.Token, link.tokenHash, err = newToken()
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		INSERT INTO public_links (note_id, token_hash, expires_at, max_views, password_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, views`
+
+	args := []any{link.NoteID, link.tokenHash, link.ExpiresAt, link.MaxViews, link.passwordHash}
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, stmt, args...).Scan(&link.ID, &link.CreatedAt, &link.Views)
+		if err != nil {
+			return err
+		}
+
+		// the plaintext token must never be written anywhere
+		audited := *link
+		audited.Token = ""
+
+		return recordAudit(ctx, tx, AuditShareCreate, link.ID, link.NoteID, nil, &audited)
+	})
+}
+
+// GetByToken looks up a link from its plaintext token, along with the workspace
+// its note is in. It does not check whether the link is still usable.
+func (m PublicLinkModel) GetByToken(ctx context.Context, token string) (_ *PublicLink, err error) {
+	ctx, span := startSpan(ctx, "PublicLinkModel.GetByToken", "select_public_link_by_token")
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + publicLinkColumns + `,
+			(SELECT workspace_id FROM notes WHERE notes.id = public_links.note_id)
+		FROM public_links
+		WHERE token_hash = $1`
+
+	var link PublicLink
+
+	err = m.DB.QueryRowContext(ctx, stmt, hashToken(token)).Scan(append(link.scanDest(), &link.WorkspaceID)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	link.HasPassword = link.passwordHash != nil
+
+	span.SetAttributes(noteIDAttr(link.NoteID), publicLinkIDAttr(link.ID))
+
+	return &link, nil
+}
+
+// GetAllForNote returns every link to a note, newest first.
+func (m PublicLinkModel) GetAllForNote(ctx context.Context, noteID int64) (_ []*PublicLink, err error) {
+	ctx, span := startSpan(ctx, "PublicLinkModel.GetAllForNote", "select_public_links", noteIDAttr(noteID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + publicLinkColumns + `
+		FROM public_links
+		WHERE note_id = $1
+		ORDER BY id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*PublicLink{}
+
+	for rows.Next() {
+		var link PublicLink
+		if err := rows.Scan(link.scanDest()...); err != nil {
+			return nil, err
+		}
+		link.HasPassword = link.passwordHash != nil
+		links = append(links, &link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(links)))
+
+	return links, nil
+}
+
+// RecordView counts a view of the link. The check that the link is still usable
+// is repeated in the update itself, so two viewers racing for the last view can't
+// both get it. ErrRecordNotFound means the link can no longer be used.
+func (m PublicLinkModel) RecordView(ctx context.Context, link *PublicLink) (err error) {
+	ctx, span := startSpan(ctx, "PublicLinkModel.RecordView", "record_public_link_view", noteIDAttr(link.NoteID), publicLinkIDAttr(link.ID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE public_links
+		SET views = views + 1, last_accessed_at = NOW()
+		WHERE id = $1
+		AND (expires_at IS NULL OR expires_at > NOW())
+		AND (max_views IS NULL OR views < max_views)
+		RETURNING views, last_accessed_at`
+
+	err = m.DB.QueryRowContext(ctx, stmt, link.ID).Scan(&link.Views, &link.LastAccessedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClaimPasswordAttempt counts an attempt at the link's password before it is
+// checked, so that guesses sent at the same time can't all get in under the
+// limit. The attempt which reaches MaxPasswordFailures locks the link, and
+// ErrLinkLocked is returned for any made while it's locked. PasswordAccepted
+// clears the count once the password turns out to be right.
+func (m PublicLinkModel) ClaimPasswordAttempt(ctx context.Context, link *PublicLink) (err error) {
+	ctx, span := startSpan(ctx, "PublicLinkModel.ClaimPasswordAttempt", "claim_public_link_password_attempt", noteIDAttr(link.NoteID), publicLinkIDAttr(link.ID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE public_links
+		SET failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+			locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN NOW() + $3 * interval '1 second' ELSE NULL END
+		WHERE id = $1
+		AND (locked_until IS NULL OR locked_until <= NOW())
+		RETURNING locked_until`
+
+	err = m.DB.QueryRowContext(ctx, stmt, link.ID, MaxPasswordFailures, PasswordLockout.Seconds()).Scan(&link.LockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrLinkLocked
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PasswordAccepted clears the count of wrong passwords tried on the link.
+func (m PublicLinkModel) PasswordAccepted(ctx context.Context, link *PublicLink) (err error) {
+	ctx, span := startSpan(ctx, "PublicLinkModel.PasswordAccepted", "reset_public_link_password_attempts", noteIDAttr(link.NoteID), publicLinkIDAttr(link.ID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE public_links
+		SET failed_attempts = 0, locked_until = NULL
+		WHERE id = $1`
+
+	_, err = m.DB.ExecContext(ctx, stmt, link.ID)
+	if err != nil {
+		return err
+	}
+
+	link.LockedUntil = nil
+	return nil
+}
+
+// Delete revokes a link, as long as it belongs to the given note.
+func (m PublicLinkModel) Delete(ctx context.Context, noteID, id int64) (err error) {
+	ctx, span := startSpan(ctx, "PublicLinkModel.Delete", "delete_public_link", noteIDAttr(noteID), publicLinkIDAttr(id))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		DELETE FROM public_links
+		WHERE id = $1 AND note_id = $2
+		RETURNING ` + publicLinkColumns
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var link PublicLink
+
+		err := tx.QueryRowContext(ctx, stmt, id, noteID).Scan(link.scanDest()...)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		link.HasPassword = link.passwordHash != nil
+
+		return recordAudit(ctx, tx, AuditShareDelete, id, noteID, &link, nil)
+	})
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+// Recurrence is the subset of an iCalendar RRULE (RFC 5545) that reminders
+// support: FREQ, INTERVAL, COUNT and UNTIL. For example "FREQ=WEEKLY;INTERVAL=2"
+// repeats every other week, and "FREQ=DAILY;COUNT=5" fires five times in total.
+type Recurrence struct {
+	Freq     string    // HOURLY, DAILY, WEEKLY, MONTHLY or YEARLY
+	Interval int       // how many periods between occurrences, at least 1
+	Count    int       // total number of occurrences, 0 for no limit
+	Until    time.Time // last time an occurrence may fall on, zero for no limit
+}
+
+var recurrenceFreqs = []string{"HOURLY", "DAILY", "WEEKLY", "MONTHLY", "YEARLY"}
+
+// ParseRecurrence parses a rule such as "FREQ=DAILY;INTERVAL=2". An optional
+// "RRULE:" prefix is allowed so rules can be copied straight from calendar apps.
+func ParseRecurrence(rule string) (Recurrence, error) {
+	r := Recurrence{Interval: 1}
+
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if rule == "" {
+		return r, errors.New("rule must not be empty")
+	}
+
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if !validator.PermittedValue(r.Freq, recurrenceFreqs...) {
+				return r, fmt.Errorf("FREQ must be one of %s", strings.Join(recurrenceFreqs, ", "))
+			}
+
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, errors.New("INTERVAL must be a positive integer")
+			}
+			r.Interval = n
+
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, errors.New("COUNT must be a positive integer")
+			}
+			r.Count = n
+
+		case "UNTIL":
+			t, err := parseRRULETime(value)
+			if err != nil {
+				return r, errors.New("UNTIL must be a date (20060102) or UTC time (20060102T150405Z)")
+			}
+			r.Until = t
+
+		default:
+			return r, fmt.Errorf("%s is not supported", strings.ToUpper(key))
+		}
+	}
+
+	if r.Freq == "" {
+		return r, errors.New("FREQ must be provided")
+	}
+
+	if r.Count > 0 && !r.Until.IsZero() {
+		return r, errors.New("COUNT and UNTIL must not both be provided")
+	}
+
+	return r, nil
+}
+
+// Next returns the occurrence that follows the one at t, which is the n'th
+// occurrence of the rule (counting from 1). ok is false once the rule has run out.
+func (r Recurrence) Next(t time.Time, n int) (next time.Time, ok bool) {
+	if r.Count > 0 && n >= r.Count {
+		return time.Time{}, false
+	}
+
+	switch r.Freq {
+	case "HOURLY":
+		next = t.Add(time.Duration(r.Interval) * time.Hour)
+	case "DAILY":
+		next = t.AddDate(0, 0, r.Interval)
+	case "WEEKLY":
+		next = t.AddDate(0, 0, 7*r.Interval)
+	case "MONTHLY":
+		next = t.AddDate(0, r.Interval, 0)
+	case "YEARLY":
+		next = t.AddDate(r.Interval, 0, 0)
+	default:
+		return time.Time{}, false
+	}
+
+	if !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, false
+	}
+
+	return next, true
+}
+
+func parseRRULETime(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+
+	// a bare date runs until the end of that day
+	t, err := time.Parse("20060102", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(24*time.Hour - time.Second), nil
+}
@@ -0,0 +1,312 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Reminder is a note with a remind_at time set, as seen by the scheduler and the
+// reminders listing.
+type Reminder struct {
+	NoteID      int64     `json:"note_id"`              // note the reminder belongs to
+	Title       string    `json:"title"`                // title of the note
+	RemindAt    time.Time `json:"remind_at"`            // when the reminder is due
+	Recurrence  string    `json:"recurrence,omitempty"` // RRULE describing how the reminder repeats
+	Occurrence  int       `json:"occurrence"`           // 1 for the first time the reminder fires, 2 for the next...
+	WorkspaceID int64     `json:"-"`                    // workspace of the note, only set by FireDue
+}
+
+// Define a ReminderModel struct type which wraps a sql.DB connection pool
+type ReminderModel struct {
+	DB *sql.DB
+}
+
+// GetUpcoming returns a page of the reminders in the workspace that have not
+// fired yet, including any which are overdue and waiting on the scheduler.
+// Reminders on archived notes are left out, the same as they are never fired.
+func (m ReminderModel) GetUpcoming(ctx context.Context, before *time.Time, filters Filters) (_ []*Reminder, _ Metadata, err error) {
+	ctx, span := startSpan(ctx, "ReminderModel.GetUpcoming", "select_upcoming_reminders")
+	defer func() { endSpan(span, err) }()
+
+	stmt := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, title, remind_at, recurrence, reminder_count + 1
+		FROM notes
+		WHERE remind_at IS NOT NULL AND NOT archived AND workspace_id = $4
+		AND (remind_at <= $1 OR $1 IS NULL)
+		ORDER BY remind_at %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortDirection())
+
+	rows, err := m.DB.QueryContext(ctx, stmt, before, filters.limit(), filters.offset(), WorkspaceID(ctx))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reminders := []*Reminder{}
+
+	for rows.Next() {
+		var reminder Reminder
+
+		err := rows.Scan(
+			&totalRecords,
+			&reminder.NoteID,
+			&reminder.Title,
+			&reminder.RemindAt,
+			&reminder.Recurrence,
+			&reminder.Occurrence,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reminders = append(reminders, &reminder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	span.SetAttributes(rowsAttr(len(reminders)))
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reminders, metadata, nil
+}
+
+// FireDue claims up to limit reminders that are due, in any workspace, moves each
+// one on to its next occurrence, or clears it if it does not repeat, and queues a
+// delivery of it to every one of sinks. The rows are locked with SKIP LOCKED, so
+// several instances of the API can run their schedulers against the same database
+// without firing a reminder twice.
+//
+// Nothing is sent here. The transaction only lasts as long as the updates, and the
+// queued deliveries are sent afterwards with ClaimDeliveries, so a slow or failing
+// sink can neither hold the notes locked nor make a reminder fire again. The
+// reminders fired are returned.
+func (m ReminderModel) FireDue(ctx context.Context, now time.Time, limit int, sinks []string) (_ []*Reminder, err error) {
+	ctx, span := startSpan(ctx, "ReminderModel.FireDue", "fire_due_reminders")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		SELECT id, title, remind_at, recurrence, reminder_count + 1, workspace_id
+		FROM notes
+		WHERE remind_at <= $1 AND NOT archived
+		ORDER BY remind_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.QueryContext(ctx, stmt, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []*Reminder
+
+	for rows.Next() {
+		var reminder Reminder
+
+		err := rows.Scan(
+			&reminder.NoteID,
+			&reminder.Title,
+			&reminder.RemindAt,
+			&reminder.Recurrence,
+			&reminder.Occurrence,
+			&reminder.WorkspaceID,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		due = append(due, &reminder)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, reminder := range due {
+		next, count := nextReminder(reminder, now)
+
+		stmt := `
+			UPDATE notes
+			SET remind_at = $1, reminder_count = $2
+			WHERE id = $3`
+
+		_, err = tx.ExecContext(ctx, stmt, next, count, reminder.NoteID)
+		if err != nil {
+			return nil, err
+		}
+
+		before, after := map[string]any{"remind_at": reminder.RemindAt}, map[string]any{"remind_at": next}
+		err = recordAudit(ctx, tx, AuditNoteUpdate, reminder.NoteID, reminder.NoteID, before, after)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(sinks) == 0 {
+			continue
+		}
+
+		stmt = `
+			INSERT INTO reminder_deliveries (note_id, sink, title, remind_at, recurrence, occurrence)
+			SELECT $1, sink, $3, $4, $5, $6 FROM unnest($2::text[]) AS sink`
+
+		args := []any{reminder.NoteID, pq.Array(sinks), reminder.Title, reminder.RemindAt, reminder.Recurrence, reminder.Occurrence}
+
+		_, err = tx.ExecContext(ctx, stmt, args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("reminders.fired", len(due)))
+
+	return due, nil
+}
+
+// ReminderDelivery is a fired reminder waiting to be sent to one sink, such as
+// the webhook or email.
+type ReminderDelivery struct {
+	ID       int64
+	Sink     string
+	Attempts int // including the attempt it was claimed for
+	Reminder Reminder
+}
+
+// ClaimDeliveries claims up to limit deliveries to the given sinks which are due
+// to be attempted. Claiming one counts an attempt and holds it back until lease
+// has passed, so a delivery that was claimed by an instance which then died is
+// picked up again later. Nothing stays locked while the deliveries are sent.
+func (m ReminderModel) ClaimDeliveries(ctx context.Context, now time.Time, limit int, sinks []string, lease time.Duration) (_ []*ReminderDelivery, err error) {
+	ctx, span := startSpan(ctx, "ReminderModel.ClaimDeliveries", "claim_reminder_deliveries")
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE reminder_deliveries
+		SET attempts = attempts + 1, next_attempt_at = $2
+		WHERE id IN (
+			SELECT id
+			FROM reminder_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1 AND sink = ANY($3)
+			ORDER BY next_attempt_at, id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, sink, attempts, note_id, title, remind_at, recurrence, occurrence`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, now, now.Add(lease), pq.Array(sinks), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*ReminderDelivery
+
+	for rows.Next() {
+		var d ReminderDelivery
+
+		err := rows.Scan(
+			&d.ID,
+			&d.Sink,
+			&d.Attempts,
+			&d.Reminder.NoteID,
+			&d.Reminder.Title,
+			&d.Reminder.RemindAt,
+			&d.Reminder.Recurrence,
+			&d.Reminder.Occurrence,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(deliveries)))
+
+	return deliveries, nil
+}
+
+// DeliverySent marks a delivery as sent.
+func (m ReminderModel) DeliverySent(ctx context.Context, id int64) (err error) {
+	ctx, span := startSpan(ctx, "ReminderModel.DeliverySent", "update_reminder_delivery")
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE reminder_deliveries
+		SET status = 'sent', last_error = ''
+		WHERE id = $1`
+
+	_, err = m.DB.ExecContext(ctx, stmt, id)
+	return err
+}
+
+// DeliveryFailed records why a delivery failed. It is tried again at retryAt, or
+// given up on if retryAt is nil.
+func (m ReminderModel) DeliveryFailed(ctx context.Context, id int64, sendErr error, retryAt *time.Time) (err error) {
+	ctx, span := startSpan(ctx, "ReminderModel.DeliveryFailed", "update_reminder_delivery")
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE reminder_deliveries
+		SET status = CASE WHEN $3::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+			next_attempt_at = COALESCE($3, next_attempt_at),
+			last_error = $2
+		WHERE id = $1`
+
+	_, err = m.DB.ExecContext(ctx, stmt, id, sendErr.Error(), retryAt)
+	return err
+}
+
+// nextReminder works out when a reminder that just fired is due again, or returns
+// nil if it doesn't repeat, along with how many occurrences are used up. Any that
+// were missed while nothing was running are skipped and counted, rather than all
+// firing at once.
+func nextReminder(reminder *Reminder, now time.Time) (*time.Time, int) {
+	n := reminder.Occurrence
+
+	if reminder.Recurrence == "" {
+		return nil, n
+	}
+
+	rule, err := ParseRecurrence(reminder.Recurrence)
+	if err != nil {
+		return nil, n
+	}
+
+	next := reminder.RemindAt
+	for {
+		var ok bool
+		if next, ok = rule.Next(next, n); !ok {
+			return nil, n
+		}
+
+		if next.After(now) {
+			return &next, n
+		}
+
+		n++
+	}
+}
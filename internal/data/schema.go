@@ -0,0 +1,58 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrNoMigrations is returned when the schema_migrations table doesn't exist, which
+// means the migrations have never been run against the database.
+var ErrNoMigrations = errors.New("no migrations have been run")
+
+// SearchIndexes are the indexes behind full text search and tag filtering.
+var SearchIndexes = []string{"notes_search_idx", "notes_tags_idx"}
+
+// Define a SchemaModel struct type which wraps a sql.DB connection pool
+type SchemaModel struct {
+	DB *sql.DB
+}
+
+// Version returns the schema version recorded by the migrate tool, and whether the
+// last migration failed part way through and left the schema dirty.
+func (m SchemaModel) Version(ctx context.Context) (_ int64, _ bool, err error) {
+	ctx, span := startSpan(ctx, "SchemaModel.Version", "select_schema_version")
+	defer func() { endSpan(span, err) }()
+
+	var version int64
+	var dirty bool
+
+	err = m.DB.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, ErrNoMigrations
+		// 42P01 is undefined_table
+		case errors.As(err, &pqErr) && pqErr.Code == "42P01":
+			return 0, false, ErrNoMigrations
+		default:
+			return 0, false, err
+		}
+	}
+
+	return version, dirty, nil
+}
+
+// Reindex rebuilds an index without locking out writes to its table. It can't be
+// run inside of a transaction.
+func (m SchemaModel) Reindex(ctx context.Context, index string) (err error) {
+	ctx, span := startSpan(ctx, "SchemaModel.Reindex", "reindex", attribute.String("db.index", index))
+	defer func() { endSpan(span, err) }()
+
+	_, err = m.DB.ExecContext(ctx, `REINDEX INDEX CONCURRENTLY `+pq.QuoteIdentifier(index))
+	return err
+}
@@ -0,0 +1,331 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	"github.com/lib/pq"
+)
+
+type Template struct {
+	ID           int64     `json:"id"`              // unique id for the template
+	CreatedAt    time.Time `json:"created_at"`      // when the template was created
+	LastUpdateAt time.Time `json:"last_updated_at"` // when the template was last updated
+	Name         string    `json:"name"`            // name of the template, e.g. "Standup"
+	Title        string    `json:"title"`           // text/template for the title of new notes
+	Content      string    `json:"content"`         // text/template for the content of new notes
+	Tags         []string  `json:"tags"`            // text/templates for the default tags of new notes
+	Counter      int64     `json:"counter"`         // number of notes created from the template
+	Version      int32     `json:"version"`         // number of times the template was updated
+	WorkspaceID  int64     `json:"-"`               // workspace the template belongs to
+}
+
+// Built in variables available to every template. Callers can pass their own
+// values alongside these, but only "user" may be overridden.
+var templateBuiltins = []string{"date", "time", "weekday", "now", "counter", "user"}
+
+func ValidateTemplate(v *validator.Validator, t *Template) {
+	v.Check(t.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.Check(len(t.Name) <= 200, "name", validator.CodeTooLong, "must not be more than 200 bytes long")
+	v.Check(t.Title != "", "title", validator.CodeRequired, "must be provided")
+	v.Check(len(t.Title) <= 500, "title", validator.CodeTooLong, "must not be more than 500 bytes long")
+	v.Check(validator.Unique(t.Tags), "tags", validator.CodeDuplicate, "must not contain duplicate values")
+
+	if _, err := parseTemplate("title", t.Title); err != nil {
+		v.AddError("title", validator.CodeInvalidFormat, err.Error())
+	}
+
+	if _, err := parseTemplate("content", t.Content); err != nil {
+		v.AddError("content", validator.CodeInvalidFormat, err.Error())
+	}
+
+	for _, tag := range t.Tags {
+		if _, err := parseTemplate("tags", tag); err != nil {
+			v.AddError("tags", validator.CodeInvalidFormat, err.Error())
+		}
+	}
+}
+
+// ValidateTemplateValues checks the values a caller wants to render a template
+// with, making sure none of them clash with the built in variables.
+func ValidateTemplateValues(v *validator.Validator, values map[string]string) {
+	for key := range values {
+		v.Check(!validator.PermittedValue(key, templateBuiltins...),
+			"values."+key, validator.CodeNotPermitted, "must not override a built in variable")
+	}
+}
+
+// Render executes the template with the built in variables and the caller's
+// values, returning the note it describes. counter is the number to give this
+// note, and user the name of whoever is creating it. Values never take the place
+// of a built in variable. Referring to a variable that doesn't exist is an error
+// rather than rendering "<no value>".
+func (t *Template) Render(counter int64, user string, values map[string]string, now time.Time) (*Note, error) {
+	vars := map[string]any{
+		"date":    now.Format("2006-01-02"),
+		"time":    now.Format("15:04"),
+		"weekday": now.Weekday().String(),
+		"now":     now,
+		"counter": counter,
+		"user":    user,
+	}
+
+	for key, value := range values {
+		if _, builtin := vars[key]; !builtin {
+			vars[key] = value
+		}
+	}
+
+	title, err := renderTemplate("title", t.Title, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := renderTemplate("content", t.Content, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	for _, tag := range t.Tags {
+		rendered, err := renderTemplate("tags", tag, vars)
+		if err != nil {
+			return nil, err
+		}
+
+		// tags that render to nothing are dropped rather than saved empty
+		if rendered = strings.TrimSpace(rendered); rendered != "" {
+			tags = append(tags, rendered)
+		}
+	}
+
+	note := &Note{
+		Title:   strings.TrimSpace(title),
+		Content: content,
+		Tags:    tags,
+	}
+
+	return note, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+func renderTemplate(name, text string, vars map[string]any) (string, error) {
+	tmpl, err := parseTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrTemplateRender, err)
+	}
+
+	return buf.String(), nil
+}
+
+// Define a TemplateModel struct type which wraps a sql.DB connection pool. Like
+// NoteModel, every method only sees the templates in the workspace picked for its
+// context.
+type TemplateModel struct {
+	DB *sql.DB
+}
+
+const templateColumns = `id, created_at, last_updated_at, name, title, content, tags, counter, version, workspace_id`
+
+// scanDest returns the destinations to Scan a row of templateColumns into.
+func (t *Template) scanDest() []any {
+	return []any{
+		&t.ID,
+		&t.CreatedAt,
+		&t.LastUpdateAt,
+		&t.Name,
+		&t.Title,
+		&t.Content,
+		pq.Array(&t.Tags),
+		&t.Counter,
+		&t.Version,
+		&t.WorkspaceID,
+	}
+}
+
+func (m TemplateModel) Insert(ctx context.Context, t *Template) (err error) {
+	ctx, span := startSpan(ctx, "TemplateModel.Insert", "insert_template")
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		INSERT INTO templates (name, title, content, tags, workspace_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, last_updated_at, counter, version`
+
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+
+	t.WorkspaceID = WorkspaceID(ctx)
+
+	args := []any{t.Name, t.Title, t.Content, pq.Array(t.Tags), t.WorkspaceID}
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, stmt, args...).Scan(&t.ID, &t.CreatedAt, &t.LastUpdateAt, &t.Counter, &t.Version)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditTemplateCreate, t.ID, 0, nil, t)
+	})
+}
+
+func (m TemplateModel) Get(ctx context.Context, id int64) (_ *Template, err error) {
+	ctx, span := startSpan(ctx, "TemplateModel.Get", "select_template", templateIDAttr(id))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + templateColumns + `
+		FROM templates
+		WHERE id = $1 AND workspace_id = $2`
+
+	var t Template
+
+	err = m.DB.QueryRowContext(ctx, stmt, id, WorkspaceID(ctx)).Scan(t.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+// GetAll returns every template in the workspace, sorted by name.
+func (m TemplateModel) GetAll(ctx context.Context) (_ []*Template, err error) {
+	ctx, span := startSpan(ctx, "TemplateModel.GetAll", "select_templates")
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + templateColumns + `
+		FROM templates
+		WHERE workspace_id = $1
+		ORDER BY lower(name), id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, WorkspaceID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*Template{}
+
+	for rows.Next() {
+		var t Template
+		if err := rows.Scan(t.scanDest()...); err != nil {
+			return nil, err
+		}
+		templates = append(templates, &t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(templates)))
+
+	return templates, nil
+}
+
+func (m TemplateModel) Update(ctx context.Context, t *Template) (err error) {
+	ctx, span := startSpan(ctx, "TemplateModel.Update", "update_template", templateIDAttr(t.ID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE templates
+		SET name = $1, title = $2, content = $3, tags = $4, last_updated_at = NOW(), version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version, last_updated_at`
+
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+
+	args := []any{t.Name, t.Title, t.Content, pq.Array(t.Tags), t.ID, t.Version}
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		// the template as it was is locked and read first, for the audit event
+		var before Template
+
+		err := tx.QueryRowContext(ctx, `SELECT `+templateColumns+` FROM templates WHERE id = $1 AND workspace_id = $2 FOR UPDATE`, t.ID, WorkspaceID(ctx)).Scan(before.scanDest()...)
+		if err == nil {
+			err = tx.QueryRowContext(ctx, stmt, args...).Scan(&t.Version, &t.LastUpdateAt)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		return recordAudit(ctx, tx, AuditTemplateUpdate, t.ID, 0, &before, t)
+	})
+}
+
+// NextCounter increments and returns the counter of a template. Numbers are never
+// handed out twice, though one is skipped if the note it was for isn't saved.
+func (m TemplateModel) NextCounter(ctx context.Context, id int64) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "TemplateModel.NextCounter", "increment_template_counter", templateIDAttr(id))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		UPDATE templates
+		SET counter = counter + 1
+		WHERE id = $1 AND workspace_id = $2
+		RETURNING counter`
+
+	var counter int64
+
+	err = m.DB.QueryRowContext(ctx, stmt, id, WorkspaceID(ctx)).Scan(&counter)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return counter, nil
+}
+
+func (m TemplateModel) Delete(ctx context.Context, id int64) (err error) {
+	ctx, span := startSpan(ctx, "TemplateModel.Delete", "delete_template", templateIDAttr(id))
+	defer func() { endSpan(span, err) }()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var t Template
+
+		err := tx.QueryRowContext(ctx, `DELETE FROM templates WHERE id = $1 AND workspace_id = $2 RETURNING `+templateColumns, id, WorkspaceID(ctx)).Scan(t.scanDest()...)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		return recordAudit(ctx, tx, AuditTemplateDelete, id, 0, &t, nil)
+	})
+}
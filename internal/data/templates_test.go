@@ -0,0 +1,38 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+)
+
+func TestValidateTemplateValues(t *testing.T) {
+	v := validator.New()
+	ValidateTemplateValues(v, map[string]string{"project": "notes", "user": "someone else", "counter": "1"})
+
+	for _, field := range []string{"values.user", "values.counter"} {
+		if _, ok := v.Errors[field]; !ok {
+			t.Errorf("no error for %s in %v", field, v.Errors)
+		}
+	}
+	if _, ok := v.Errors["values.project"]; ok {
+		t.Errorf("values.project was turned away: %v", v.Errors)
+	}
+}
+
+func TestTemplateRenderKeepsBuiltins(t *testing.T) {
+	tmpl := &Template{Title: "{{.project}} by {{.user}} #{{.counter}}", Tags: []string{"{{.user}}"}}
+
+	note, err := tmpl.Render(3, "ada@example.com", map[string]string{"project": "Notes", "user": "mallory", "counter": "99"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "Notes by ada@example.com #3"; note.Title != want {
+		t.Errorf("got title %q, want %q", note.Title, want)
+	}
+	if len(note.Tags) != 1 || note.Tags[0] != "ada@example.com" {
+		t.Errorf("got tags %v", note.Tags)
+	}
+}
@@ -0,0 +1,27 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+)
+
+// newToken returns a random token along with the hash of it that is stored in
+// place of the token itself.
+func newToken() (string, []byte, error) {
+	// 20 random bytes make a 32 character base32 token
+	randomBytes := make([]byte, 20)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", nil, err
+	}
+
+	token := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hash a token is stored and looked up by.
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is used for the spans around each model method. It picks up whichever
+// tracer provider is registered globally, and does nothing if there isn't one.
+var tracer = otel.Tracer("github.com/KevuTheDev/notes-backend-api/internal/data")
+
+// startSpan starts a span for a model method. statement is a short name for the
+// SQL the method runs, since the statements themselves are too long to be useful
+// as attributes.
+func startSpan(ctx context.Context, method, statement string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement.name", statement),
+	)
+
+	return tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan records the result of a model method and ends its span. Records that
+// aren't found and edit conflicts are expected outcomes, so they don't mark the
+// span as failed.
+func endSpan(span trace.Span, err error) {
+	result := "ok"
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrRecordNotFound):
+		result = "not_found"
+	case errors.Is(err, ErrEditConflict):
+		result = "edit_conflict"
+	case errors.Is(err, ErrInvalidOrder):
+		result = "invalid_order"
+	default:
+		result = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.SetAttributes(attribute.String("db.result", result))
+	span.End()
+}
+
+func noteIDAttr(id int64) attribute.KeyValue {
+	return attribute.Int64("note.id", id)
+}
+
+func templateIDAttr(id int64) attribute.KeyValue {
+	return attribute.Int64("template.id", id)
+}
+
+func publicLinkIDAttr(id int64) attribute.KeyValue {
+	return attribute.Int64("public_link.id", id)
+}
+
+func workspaceIDAttr(id int64) attribute.KeyValue {
+	return attribute.Int64("workspace.id", id)
+}
+
+func rowsAttr(n int) attribute.KeyValue {
+	return attribute.Int("db.rows", n)
+}
+
+// batchAttr records how many keys a batched lookup was made for.
+func batchAttr(n int) attribute.KeyValue {
+	return attribute.Int("db.batch_size", n)
+}
@@ -0,0 +1,673 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/validator"
+	"github.com/lib/pq"
+)
+
+// DefaultWorkspaceID is the workspace that notes belong to unless a request picks
+// another. It has no members and is open to anyone, as the whole API was before
+// workspaces were added.
+const DefaultWorkspaceID int64 = 1
+
+// Roles a member can have in a workspace, from most to least access. Each role
+// can do everything the roles after it can.
+const (
+	RoleOwner  = "owner"  // can also delete the workspace and manage owners
+	RoleAdmin  = "admin"  // can also manage members and invitations
+	RoleEditor = "editor" // can also create, change and delete notes
+	RoleViewer = "viewer" // can read notes
+)
+
+// WorkspaceRoles lists every role, for validating input.
+var WorkspaceRoles = []string{RoleOwner, RoleAdmin, RoleEditor, RoleViewer}
+
+var roleRanks = map[string]int{
+	RoleOwner:  4,
+	RoleAdmin:  3,
+	RoleEditor: 2,
+	RoleViewer: 1,
+}
+
+// RoleAtLeast reports whether role gives at least the access of min.
+func RoleAtLeast(role, min string) bool {
+	return roleRanks[role] >= roleRanks[min]
+}
+
+type workspaceContextKey struct{}
+
+// WithWorkspace returns a context whose note queries only see the notes in the
+// workspace with the given id.
+func WithWorkspace(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, workspaceContextKey{}, id)
+}
+
+// WorkspaceID returns the workspace picked for ctx, which is the default
+// workspace unless WithWorkspace was used.
+func WorkspaceID(ctx context.Context) int64 {
+	id, ok := ctx.Value(workspaceContextKey{}).(int64)
+	if !ok {
+		return DefaultWorkspaceID
+	}
+	return id
+}
+
+// Workspace keeps a set of notes apart from every other workspace.
+type Workspace struct {
+	ID        int64     `json:"id"`         // unique id for the workspace
+	CreatedAt time.Time `json:"created_at"` // when the workspace was created
+	Name      string    `json:"name"`       // name of the workspace
+	Slug      string    `json:"slug"`       // short name used in URLs, e.g. "design-team"
+}
+
+// slugs can't be all digits, so that a workspace can be picked by id or by slug
+var slugRX = regexp.MustCompile("^[a-z0-9]+(-[a-z0-9]+)*$")
+var digitsRX = regexp.MustCompile("^[0-9]+$")
+
+func ValidateWorkspace(v *validator.Validator, ws *Workspace) {
+	v.Check(ws.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.Check(len(ws.Name) <= 200, "name", validator.CodeTooLong, "must not be more than 200 bytes long")
+
+	v.Check(ws.Slug != "", "slug", validator.CodeRequired, "must be provided")
+	v.Check(len(ws.Slug) <= 63, "slug", validator.CodeTooLong, "must not be more than 63 bytes long")
+	v.Check(ws.Slug == "" || validator.Matches(ws.Slug, slugRX), "slug", validator.CodeInvalidFormat, "must be lowercase letters, digits and single dashes")
+	v.Check(!validator.Matches(ws.Slug, digitsRX), "slug", validator.CodeInvalidFormat, "must not be only digits")
+}
+
+// ValidateMemberEmail checks the email address of a member or invitation.
+func ValidateMemberEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", validator.CodeRequired, "must be provided")
+	v.Check(len(email) <= 500, "email", validator.CodeTooLong, "must not be more than 500 bytes long")
+	v.Check(email == "" || validator.Matches(email, validator.EmailRX), "email", validator.CodeInvalidFormat, "must be a valid email address")
+}
+
+// ValidateRole checks role is one of WorkspaceRoles.
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(role != "", "role", validator.CodeRequired, "must be provided")
+	v.Check(role == "" || validator.PermittedValue(role, WorkspaceRoles...), "role", validator.CodeNotPermitted, "must be one of owner, admin, editor or viewer")
+}
+
+// Member gives someone a role in a workspace. The token is how they prove who
+// they are, and only a hash of it is stored, so the plaintext is only ever seen
+// when the member is added.
+type Member struct {
+	ID          int64     `json:"id"`              // unique id for the member
+	WorkspaceID int64     `json:"workspace_id"`    // workspace the member belongs to
+	CreatedAt   time.Time `json:"created_at"`      // when the member joined
+	Email       string    `json:"email"`           // email address of the member
+	Role        string    `json:"role"`            // one of owner, admin, editor or viewer
+	Token       string    `json:"token,omitempty"` // plaintext bearer token, only set when added
+	tokenHash   []byte
+}
+
+const memberColumns = `id, workspace_id, created_at, email, role, token_hash`
+
+// scanDest returns the destinations to Scan a row of memberColumns into.
+func (m *Member) scanDest() []any {
+	return []any{&m.ID, &m.WorkspaceID, &m.CreatedAt, &m.Email, &m.Role, &m.tokenHash}
+}
+
+// audited returns a copy of the member that is safe to write to the audit log.
+func (m *Member) audited() *Member {
+	member := *m
+	member.Token = ""
+	return &member
+}
+
+// Invitation asks someone to join a workspace. Like a member token, only a hash
+// of the invitation token is stored.
+type Invitation struct {
+	ID          int64      `json:"id"`                    // unique id for the invitation
+	WorkspaceID int64      `json:"workspace_id"`          // workspace the invitation is to
+	CreatedAt   time.Time  `json:"created_at"`            // when the invitation was sent
+	Email       string     `json:"email"`                 // email address the invitation was sent to
+	Role        string     `json:"role"`                  // role given when the invitation is accepted
+	ExpiresAt   time.Time  `json:"expires_at"`            // when the invitation can no longer be accepted
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"` // when the invitation was accepted, if it has been
+	Token       string     `json:"token,omitempty"`       // plaintext token, only set on creation
+	tokenHash   []byte
+}
+
+const invitationColumns = `id, workspace_id, created_at, email, role, token_hash, expires_at, accepted_at`
+
+// scanDest returns the destinations to Scan a row of invitationColumns into.
+func (inv *Invitation) scanDest() []any {
+	return []any{&inv.ID, &inv.WorkspaceID, &inv.CreatedAt, &inv.Email, &inv.Role, &inv.tokenHash, &inv.ExpiresAt, &inv.AcceptedAt}
+}
+
+// isUniqueViolation reports whether err is from breaking the named unique
+// constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	// 23505 is unique_violation
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// Define a WorkspaceModel struct type which wraps a sql.DB connection pool
+type WorkspaceModel struct {
+	DB *sql.DB
+}
+
+// Insert saves a new workspace along with its first member, who is made its owner
+// and given a token.
+func (m WorkspaceModel) Insert(ctx context.Context, ws *Workspace, owner *Member) (err error) {
+	ctx, span := startSpan(ctx, "WorkspaceModel.Insert", "insert_workspace")
+	defer func() { endSpan(span, err) }()
+
+	owner.Role = RoleOwner
+	owner.Token, owner.tokenHash, err = newToken()
+	if err != nil {
+		return err
+	}
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		stmt := `
+			INSERT INTO workspaces (name, slug)
+			VALUES ($1, $2)
+			RETURNING id, created_at`
+
+		err := tx.QueryRowContext(ctx, stmt, ws.Name, ws.Slug).Scan(&ws.ID, &ws.CreatedAt)
+		if err != nil {
+			if isUniqueViolation(err, "workspaces_slug_key") {
+				return ErrDuplicateSlug
+			}
+			return err
+		}
+
+		span.SetAttributes(workspaceIDAttr(ws.ID))
+
+		if err := recordAudit(ctx, tx, AuditWorkspaceCreate, ws.ID, 0, nil, ws); err != nil {
+			return err
+		}
+
+		owner.WorkspaceID = ws.ID
+
+		return insertMember(ctx, tx, owner)
+	})
+}
+
+// Get looks up a workspace by its id, or by its slug if ref isn't a number.
+func (m WorkspaceModel) Get(ctx context.Context, ref string) (_ *Workspace, err error) {
+	ctx, span := startSpan(ctx, "WorkspaceModel.Get", "select_workspace")
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT id, created_at, name, slug
+		FROM workspaces
+		WHERE slug = $1`
+
+	var arg any = strings.ToLower(ref)
+
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		stmt = `
+			SELECT id, created_at, name, slug
+			FROM workspaces
+			WHERE id = $1`
+		arg = id
+	}
+
+	var ws Workspace
+
+	err = m.DB.QueryRowContext(ctx, stmt, arg).Scan(&ws.ID, &ws.CreatedAt, &ws.Name, &ws.Slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	span.SetAttributes(workspaceIDAttr(ws.ID))
+
+	return &ws, nil
+}
+
+// GetAll returns every workspace in id order.
+func (m WorkspaceModel) GetAll(ctx context.Context) (_ []*Workspace, err error) {
+	ctx, span := startSpan(ctx, "WorkspaceModel.GetAll", "select_workspaces")
+	defer func() { endSpan(span, err) }()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT id, created_at, name, slug FROM workspaces ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []*Workspace{}
+
+	for rows.Next() {
+		var ws Workspace
+		if err := rows.Scan(&ws.ID, &ws.CreatedAt, &ws.Name, &ws.Slug); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, &ws)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(workspaces)))
+
+	return workspaces, nil
+}
+
+// Delete removes a workspace and, through the foreign keys, every note, member
+// and invitation in it. The default workspace can't be deleted.
+func (m WorkspaceModel) Delete(ctx context.Context, id int64) (err error) {
+	ctx, span := startSpan(ctx, "WorkspaceModel.Delete", "delete_workspace", workspaceIDAttr(id))
+	defer func() { endSpan(span, err) }()
+
+	if id == DefaultWorkspaceID {
+		return ErrRecordNotFound
+	}
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var ws Workspace
+
+		stmt := `
+			DELETE FROM workspaces
+			WHERE id = $1
+			RETURNING id, created_at, name, slug`
+
+		err := tx.QueryRowContext(ctx, stmt, id).Scan(&ws.ID, &ws.CreatedAt, &ws.Name, &ws.Slug)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		return recordAudit(ctx, tx, AuditWorkspaceDelete, id, 0, &ws, nil)
+	})
+}
+
+// insertMember saves a member, whose token must already be set.
+func insertMember(ctx context.Context, tx *sql.Tx, member *Member) error {
+	stmt := `
+		INSERT INTO workspace_members (workspace_id, email, role, token_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	args := []any{member.WorkspaceID, member.Email, member.Role, member.tokenHash}
+
+	err := tx.QueryRowContext(ctx, stmt, args...).Scan(&member.ID, &member.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "workspace_members_workspace_id_email_key") {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	return recordAudit(ctx, tx, AuditMemberCreate, member.ID, 0, nil, member.audited())
+}
+
+// Define a MemberModel struct type which wraps a sql.DB connection pool
+type MemberModel struct {
+	DB *sql.DB
+}
+
+// GetByToken looks up the member of a workspace holding token.
+func (m MemberModel) GetByToken(ctx context.Context, workspaceID int64, token string) (_ *Member, err error) {
+	ctx, span := startSpan(ctx, "MemberModel.GetByToken", "select_member_by_token", workspaceIDAttr(workspaceID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + memberColumns + `
+		FROM workspace_members
+		WHERE token_hash = $1 AND workspace_id = $2`
+
+	var member Member
+
+	err = m.DB.QueryRowContext(ctx, stmt, hashToken(token), workspaceID).Scan(member.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &member, nil
+}
+
+// GetAllForWorkspace returns the members of a workspace in the order they joined.
+func (m MemberModel) GetAllForWorkspace(ctx context.Context, workspaceID int64) (_ []*Member, err error) {
+	ctx, span := startSpan(ctx, "MemberModel.GetAllForWorkspace", "select_members", workspaceIDAttr(workspaceID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + memberColumns + `
+		FROM workspace_members
+		WHERE workspace_id = $1
+		ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(member.scanDest()...); err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(members)))
+
+	return members, nil
+}
+
+// Get returns a single member of a workspace.
+func (m MemberModel) Get(ctx context.Context, workspaceID, id int64) (_ *Member, err error) {
+	ctx, span := startSpan(ctx, "MemberModel.Get", "select_member", workspaceIDAttr(workspaceID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + memberColumns + `
+		FROM workspace_members
+		WHERE id = $1 AND workspace_id = $2`
+
+	var member Member
+
+	err = m.DB.QueryRowContext(ctx, stmt, id, workspaceID).Scan(member.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &member, nil
+}
+
+// UpdateRole changes the role of a member. A workspace always keeps at least one
+// owner, so demoting the last one fails with ErrLastOwner.
+func (m MemberModel) UpdateRole(ctx context.Context, member *Member) (err error) {
+	ctx, span := startSpan(ctx, "MemberModel.UpdateRole", "update_member_role", workspaceIDAttr(member.WorkspaceID))
+	defer func() { endSpan(span, err) }()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		before, err := getMemberForUpdate(ctx, tx, member.WorkspaceID, member.ID)
+		if err != nil {
+			return err
+		}
+
+		if before.Role == RoleOwner && member.Role != RoleOwner {
+			if err := checkOtherOwners(ctx, tx, member.WorkspaceID, member.ID); err != nil {
+				return err
+			}
+		}
+
+		stmt := `
+			UPDATE workspace_members
+			SET role = $1
+			WHERE id = $2 AND workspace_id = $3`
+
+		if err := execOne(ctx, tx, stmt, member.Role, member.ID, member.WorkspaceID); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditMemberUpdate, member.ID, 0, before, member.audited())
+	})
+}
+
+// Delete removes a member from a workspace, which also stops their token
+// working. The last owner can't be removed.
+func (m MemberModel) Delete(ctx context.Context, workspaceID, id int64) (err error) {
+	ctx, span := startSpan(ctx, "MemberModel.Delete", "delete_member", workspaceIDAttr(workspaceID))
+	defer func() { endSpan(span, err) }()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		before, err := getMemberForUpdate(ctx, tx, workspaceID, id)
+		if err != nil {
+			return err
+		}
+
+		if before.Role == RoleOwner {
+			if err := checkOtherOwners(ctx, tx, workspaceID, id); err != nil {
+				return err
+			}
+		}
+
+		if err := execOne(ctx, tx, `DELETE FROM workspace_members WHERE id = $1 AND workspace_id = $2`, id, workspaceID); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditMemberDelete, id, 0, before, nil)
+	})
+}
+
+// getMemberForUpdate reads a member as it is before a change, locking it for the
+// rest of the transaction.
+func getMemberForUpdate(ctx context.Context, tx *sql.Tx, workspaceID, id int64) (*Member, error) {
+	var member Member
+
+	err := tx.QueryRowContext(ctx, `SELECT `+memberColumns+` FROM workspace_members WHERE id = $1 AND workspace_id = $2 FOR UPDATE`, id, workspaceID).Scan(member.scanDest()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// checkOtherOwners returns ErrLastOwner unless the workspace has an owner other
+// than the member with id. The owners are locked, so two owners can't demote each
+// other at the same time and leave none.
+func checkOtherOwners(ctx context.Context, tx *sql.Tx, workspaceID, id int64) error {
+	stmt := `
+		SELECT id
+		FROM workspace_members
+		WHERE workspace_id = $1 AND role = 'owner' AND id <> $2
+		FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, stmt, workspaceID, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	others := 0
+	for rows.Next() {
+		others++
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if others == 0 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+// Define a InvitationModel struct type which wraps a sql.DB connection pool
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+// Insert generates a token for the invitation and saves it. The plaintext token
+// is set on the invitation so it can be sent to the person invited.
+func (m InvitationModel) Insert(ctx context.Context, inv *Invitation) (err error) {
+	ctx, span := startSpan(ctx, "InvitationModel.Insert", "insert_invitation", workspaceIDAttr(inv.WorkspaceID))
+	defer func() { endSpan(span, err) }()
+
+	inv.Token, inv.tokenHash, err = newToken()
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		INSERT INTO workspace_invitations (workspace_id, email, role, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	args := []any{inv.WorkspaceID, inv.Email, inv.Role, inv.tokenHash, inv.ExpiresAt}
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, stmt, args...).Scan(&inv.ID, &inv.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		audited := *inv
+		audited.Token = ""
+
+		return recordAudit(ctx, tx, AuditInviteCreate, inv.ID, 0, nil, &audited)
+	})
+}
+
+// GetPending returns the invitations to a workspace which haven't been accepted,
+// newest first. Expired invitations are included until they're deleted.
+func (m InvitationModel) GetPending(ctx context.Context, workspaceID int64) (_ []*Invitation, err error) {
+	ctx, span := startSpan(ctx, "InvitationModel.GetPending", "select_pending_invitations", workspaceIDAttr(workspaceID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		SELECT ` + invitationColumns + `
+		FROM workspace_invitations
+		WHERE workspace_id = $1 AND accepted_at IS NULL
+		ORDER BY id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+
+	for rows.Next() {
+		var inv Invitation
+		if err := rows.Scan(inv.scanDest()...); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, &inv)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(rowsAttr(len(invitations)))
+
+	return invitations, nil
+}
+
+// Delete withdraws an invitation which hasn't been accepted yet.
+func (m InvitationModel) Delete(ctx context.Context, workspaceID, id int64) (err error) {
+	ctx, span := startSpan(ctx, "InvitationModel.Delete", "delete_invitation", workspaceIDAttr(workspaceID))
+	defer func() { endSpan(span, err) }()
+
+	stmt := `
+		DELETE FROM workspace_invitations
+		WHERE id = $1 AND workspace_id = $2 AND accepted_at IS NULL
+		RETURNING ` + invitationColumns
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var inv Invitation
+
+		err := tx.QueryRowContext(ctx, stmt, id, workspaceID).Scan(inv.scanDest()...)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		return recordAudit(ctx, tx, AuditInviteDelete, id, 0, &inv, nil)
+	})
+}
+
+// Accept uses up the invitation with token, adding the person invited to its
+// workspace with a new member token. Invitations that are unknown, expired or
+// already accepted return ErrRecordNotFound, and ErrDuplicateEmail is returned if
+// the email address is already a member.
+func (m InvitationModel) Accept(ctx context.Context, token string, now time.Time) (_ *Member, err error) {
+	ctx, span := startSpan(ctx, "InvitationModel.Accept", "accept_invitation")
+	defer func() { endSpan(span, err) }()
+
+	member := &Member{}
+
+	member.Token, member.tokenHash, err = newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		stmt := `
+			SELECT ` + invitationColumns + `
+			FROM workspace_invitations
+			WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > $2
+			FOR UPDATE`
+
+		var inv Invitation
+
+		err := tx.QueryRowContext(ctx, stmt, hashToken(token), now).Scan(inv.scanDest()...)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		span.SetAttributes(workspaceIDAttr(inv.WorkspaceID))
+
+		// whoever holds the token is the person invited
+		ctx := WithAuditActor(ctx, inv.Email)
+
+		before := inv
+
+		inv.AcceptedAt = &now
+		if err := execOne(ctx, tx, `UPDATE workspace_invitations SET accepted_at = $1 WHERE id = $2`, now, inv.ID); err != nil {
+			return err
+		}
+
+		if err := recordAudit(ctx, tx, AuditInviteAccept, inv.ID, 0, &before, &inv); err != nil {
+			return err
+		}
+
+		member.WorkspaceID = inv.WorkspaceID
+		member.Email = inv.Email
+		member.Role = inv.Role
+
+		return insertMember(ctx, tx, member)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
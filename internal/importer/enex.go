@@ -0,0 +1,112 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+// Evernote writes its timestamps in a compact ISO 8601 format, always in UTC.
+const enexTimeLayout = "20060102T150405Z"
+
+type enexExport struct {
+	Notes []enexNote `xml:"note"`
+}
+
+type enexNote struct {
+	Title   string   `xml:"title"`
+	Content string   `xml:"content"`
+	Created string   `xml:"created"`
+	Updated string   `xml:"updated"`
+	Tags    []string `xml:"tag"`
+}
+
+// ParseENEX reads every note out of an Evernote .enex export.
+func ParseENEX(r io.Reader) ([]*data.Note, error) {
+	var export enexExport
+
+	dec := xml.NewDecoder(r)
+	// ENEX files carry a DOCTYPE and HTML entities that the strict decoder rejects
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	if err := dec.Decode(&export); err != nil {
+		return nil, err
+	}
+
+	notes := make([]*data.Note, 0, len(export.Notes))
+
+	for _, en := range export.Notes {
+		content, err := enmlText(en.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		note := &data.Note{
+			Title:        strings.TrimSpace(en.Title),
+			Content:      content,
+			Tags:         en.Tags,
+			CreatedAt:    parseENEXTime(en.Created),
+			LastUpdateAt: parseENEXTime(en.Updated),
+		}
+
+		notes = append(notes, note)
+	}
+
+	return notes, nil
+}
+
+// enmlText flattens the ENML (a restricted XHTML) body of a note into plain text,
+// starting a new line at the end of each block level element.
+func enmlText(enml string) (string, error) {
+	if strings.TrimSpace(enml) == "" {
+		return "", nil
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(enml))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	dec.AutoClose = xml.HTMLAutoClose
+
+	var sb strings.Builder
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			sb.Write(t)
+		case xml.StartElement:
+			if t.Name.Local == "br" {
+				sb.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "div", "p", "li", "h1", "h2", "h3", "h4", "h5", "h6", "tr":
+				sb.WriteByte('\n')
+			}
+		}
+	}
+
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// parseENEXTime returns the zero time if the value is missing or malformed, which
+// lets the database fill in the current time instead.
+func parseENEXTime(value string) time.Time {
+	t, err := time.Parse(enexTimeLayout, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
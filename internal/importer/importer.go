@@ -0,0 +1,134 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported file format")
+	ErrArchiveTooLarge   = fmt.Errorf("archive expands to more than %d MB", maxZipBytes>>20)
+)
+
+// Limits on how much a ZIP archive may expand to, since the upload limit only
+// bounds its compressed size.
+const (
+	maxZipEntryBytes = 32 << 20
+	maxZipBytes      = 128 << 20
+)
+
+// File is a single uploaded file waiting to be imported. The contents are held in
+// memory so that the import can carry on after the request has finished.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Entry is a note parsed out of an import file. Source names the file (and the
+// position within it for formats that can hold more than one note) so errors can
+// be reported back against it.
+type Entry struct {
+	Source string
+	Note   *data.Note
+}
+
+// Parse reads the notes out of a file based on its extension. ZIP archives are
+// expanded and every supported file inside of them is parsed in turn.
+func Parse(file File) ([]Entry, error) {
+	switch strings.ToLower(path.Ext(file.Name)) {
+	case ".md", ".markdown":
+		note, err := ParseMarkdown(file.Name, file.Data)
+		if err != nil {
+			return nil, err
+		}
+		return []Entry{{Source: file.Name, Note: note}}, nil
+
+	case ".enex":
+		notes, err := ParseENEX(bytes.NewReader(file.Data))
+		if err != nil {
+			return nil, err
+		}
+		return entries(file.Name, notes), nil
+
+	case ".json":
+		notes, err := ParseJSON(bytes.NewReader(file.Data))
+		if err != nil {
+			return nil, err
+		}
+		return entries(file.Name, notes), nil
+
+	case ".zip":
+		return parseZip(file)
+
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// parseZip expands an archive and parses each file inside of it. Directories and
+// files in unsupported formats are skipped, while any other failure is returned
+// with the name of the file that caused it.
+func parseZip(file File) ([]Entry, error) {
+	zr, err := zip.NewReader(bytes.NewReader(file.Data), int64(len(file.Data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Entry
+	var total int64
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() || strings.ToLower(path.Ext(zf.Name)) == ".zip" {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+
+		// the sizes in the archive's headers can't be trusted, so the limits are
+		// applied while reading instead
+		limit := min(int64(maxZipEntryBytes), maxZipBytes-total)
+		contents, err := io.ReadAll(io.LimitReader(rc, limit+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		if int64(len(contents)) > limit {
+			if limit < maxZipEntryBytes {
+				return nil, ErrArchiveTooLarge
+			}
+			return nil, fmt.Errorf("%s: file expands to more than %d MB", zf.Name, maxZipEntryBytes>>20)
+		}
+		total += int64(len(contents))
+
+		parsed, err := Parse(File{Name: file.Name + "/" + zf.Name, Data: contents})
+		if err != nil {
+			if errors.Is(err, ErrUnsupportedFormat) {
+				continue
+			}
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+
+		result = append(result, parsed...)
+	}
+
+	return result, nil
+}
+
+// entries labels each note from a multi-note file with its position in the file.
+func entries(name string, notes []*data.Note) []Entry {
+	result := make([]Entry, len(notes))
+	for i, note := range notes {
+		result[i] = Entry{Source: fmt.Sprintf("%s#%d", name, i+1), Note: note}
+	}
+	return result
+}
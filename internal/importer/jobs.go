@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Possible states of an import job.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// FileError reports why a file, or a single note within a file, was not imported.
+// Errors holds the validator messages when the note failed ValidateNote.
+type FileError struct {
+	File   string            `json:"file"`
+	Error  string            `json:"error,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Job tracks the progress of a single import. All access to it goes through its
+// methods since the import runs in the background while clients poll for status.
+type Job struct {
+	mu sync.Mutex
+
+	ID          string      `json:"id"`
+	WorkspaceID int64       `json:"-"` // workspace the notes are imported into, which alone can see the job
+	Status      string      `json:"status"`
+	CreatedAt   time.Time   `json:"created_at"`
+	FinishedAt  *time.Time  `json:"finished_at,omitempty"`
+	Files       int         `json:"files"`
+	Total       int         `json:"total"`
+	Processed   int         `json:"processed"`
+	Imported    int         `json:"imported"`
+	Failed      int         `json:"failed"`
+	NoteIDs     []int64     `json:"note_ids,omitempty"`
+	Report      []FileError `json:"errors,omitempty"`
+}
+
+// Start marks the job as running.
+func (j *Job) Start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Status = StatusRunning
+}
+
+// AddTotal increases the number of notes the job expects to process.
+func (j *Job) AddTotal(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Total += n
+}
+
+// Succeeded records a note that was imported.
+func (j *Job) Succeeded(id int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Processed++
+	j.Imported++
+	j.NoteIDs = append(j.NoteIDs, id)
+}
+
+// Fail records an error against a file. count is the number of notes the error
+// accounts for, which is zero when the file could not be parsed at all.
+func (j *Job) Fail(fe FileError, count int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Processed += count
+	j.Failed += count
+	j.Report = append(j.Report, fe)
+}
+
+// Finish marks the job as done. A job only fails outright if nothing was imported
+// and something went wrong along the way.
+func (j *Job) Finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	j.FinishedAt = &now
+
+	if j.Imported == 0 && len(j.Report) > 0 {
+		j.Status = StatusFailed
+	} else {
+		j.Status = StatusCompleted
+	}
+}
+
+// Snapshot returns a copy of the job that is safe to encode while the import is
+// still running.
+func (j *Job) Snapshot() *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return &Job{
+		ID:          j.ID,
+		WorkspaceID: j.WorkspaceID,
+		Status:      j.Status,
+		CreatedAt:   j.CreatedAt,
+		FinishedAt:  j.FinishedAt,
+		Files:       j.Files,
+		Total:       j.Total,
+		Processed:   j.Processed,
+		Imported:    j.Imported,
+		Failed:      j.Failed,
+		NoteIDs:     append([]int64(nil), j.NoteIDs...),
+		Report:      append([]FileError(nil), j.Report...),
+	}
+}
+
+// Jobs is an in-memory registry of import jobs. Finished jobs are kept around for
+// the retention period so clients have time to fetch the final report.
+type Jobs struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	retention time.Duration
+}
+
+// NewJobs returns an empty registry which forgets finished jobs after retention.
+func NewJobs(retention time.Duration) *Jobs {
+	return &Jobs{
+		jobs:      make(map[string]*Job),
+		retention: retention,
+	}
+}
+
+// New registers a pending job importing the given number of uploaded files into
+// a workspace.
+func (js *Jobs) New(workspaceID int64, files int) (*Job, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:          hex.EncodeToString(b),
+		WorkspaceID: workspaceID,
+		Status:      StatusPending,
+		CreatedAt:   time.Now(),
+		Files:       files,
+	}
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	js.prune()
+	js.jobs[job.ID] = job
+
+	return job, nil
+}
+
+// Get looks up a job by id.
+func (js *Jobs) Get(id string) (*Job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	job, ok := js.jobs[id]
+	return job, ok
+}
+
+// prune drops finished jobs older than the retention period. It must be called
+// with the lock held.
+func (js *Jobs) prune() {
+	cutoff := time.Now().Add(-js.retention)
+
+	for id, job := range js.jobs {
+		job.mu.Lock()
+		expired := job.FinishedAt != nil && job.FinishedAt.Before(cutoff)
+		job.mu.Unlock()
+
+		if expired {
+			delete(js.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+// ParseJSON reads notes from the API's own JSON format. It accepts the
+// {"notes": [...]} envelope used by the listing endpoint, a single {"note": {...}}
+// envelope as returned by GET /v1/notes/:id, or a bare array of notes.
+func ParseJSON(r io.Reader) ([]*data.Note, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	contents = bytes.TrimSpace(contents)
+	if len(contents) == 0 {
+		return nil, errors.New("file must not be empty")
+	}
+
+	var notes []*data.Note
+
+	if contents[0] == '[' {
+		if err := json.Unmarshal(contents, &notes); err != nil {
+			return nil, err
+		}
+		return checkNotes(notes)
+	}
+
+	var env struct {
+		Notes []*data.Note `json:"notes"`
+		Note  *data.Note   `json:"note"`
+	}
+
+	if err := json.Unmarshal(contents, &env); err != nil {
+		return nil, err
+	}
+
+	notes = env.Notes
+	if env.Note != nil {
+		notes = append(notes, env.Note)
+	}
+
+	if len(notes) == 0 {
+		return nil, errors.New(`file must contain a "notes" array or a "note" object`)
+	}
+
+	return checkNotes(notes)
+}
+
+// checkNotes makes sure none of the notes were null in the JSON.
+func checkNotes(notes []*data.Note) ([]*data.Note, error) {
+	for i, note := range notes {
+		if note == nil {
+			return nil, fmt.Errorf("note %d must be an object, not null", i+1)
+		}
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatter holds the fields we understand from the YAML block at the top of a
+// markdown file. Anything else in the block is ignored.
+type frontMatter struct {
+	Title         string    `yaml:"title"`
+	Tags          []string  `yaml:"tags"`
+	CreatedAt     time.Time `yaml:"created_at"`
+	Created       time.Time `yaml:"created"`
+	LastUpdatedAt time.Time `yaml:"last_updated_at"`
+	Updated       time.Time `yaml:"updated"`
+}
+
+// ParseMarkdown turns a markdown file into a note. The title comes from the front
+// matter if there is one, then the first level one heading, and finally the name
+// of the file itself.
+func ParseMarkdown(name string, contents []byte) (*data.Note, error) {
+	var fm frontMatter
+
+	body := contents
+	if block, rest, ok := splitFrontMatter(contents); ok {
+		if err := yaml.Unmarshal(block, &fm); err != nil {
+			return nil, fmt.Errorf("invalid front matter: %w", err)
+		}
+		body = rest
+	}
+
+	content := strings.TrimSpace(string(body))
+
+	title := strings.TrimSpace(fm.Title)
+	if title == "" {
+		title, content = headingTitle(content)
+	}
+	if title == "" {
+		title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+
+	note := &data.Note{
+		Title:        title,
+		Content:      content,
+		Tags:         fm.Tags,
+		CreatedAt:    firstTime(fm.CreatedAt, fm.Created),
+		LastUpdateAt: firstTime(fm.LastUpdatedAt, fm.Updated),
+	}
+
+	return note, nil
+}
+
+// splitFrontMatter separates a leading "---" delimited block from the rest of the
+// file. ok is false when the file does not start with front matter.
+func splitFrontMatter(contents []byte) (block, rest []byte, ok bool) {
+	contents = bytes.TrimPrefix(contents, []byte("\ufeff"))
+	contents = bytes.ReplaceAll(contents, []byte("\r\n"), []byte("\n"))
+
+	if !bytes.HasPrefix(contents, []byte("---\n")) {
+		return nil, contents, false
+	}
+
+	block, rest, found := bytes.Cut(contents[4:], []byte("\n---"))
+	if !found {
+		return nil, contents, false
+	}
+
+	// drop whatever is left on the closing delimiter line
+	if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[i+1:]
+	} else {
+		rest = nil
+	}
+
+	return block, rest, true
+}
+
+// headingTitle pulls a "# Title" line off the top of the content.
+func headingTitle(content string) (string, string) {
+	first, rest, _ := strings.Cut(content, "\n")
+	if !strings.HasPrefix(first, "# ") {
+		return "", content
+	}
+	return strings.TrimSpace(first[2:]), strings.TrimSpace(rest)
+}
+
+// firstTime returns the first of the given times which has been set.
+func firstTime(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
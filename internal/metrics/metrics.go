@@ -0,0 +1,397 @@
+// Package metrics keeps a small set of counters, gauges and histograms, and writes
+// them out in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are histogram buckets in seconds suited to HTTP request latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric is implemented by everything that can be added to a Registry.
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+	snapshot() any
+}
+
+// Registry holds a set of metrics, in the order they were added.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (reg *Registry) add(m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for _, existing := range reg.metrics {
+		if existing.name() == m.name() {
+			panic(fmt.Sprintf("metrics: %s registered twice", m.name()))
+		}
+	}
+
+	reg.metrics = append(reg.metrics, m)
+}
+
+// WritePrometheus writes every metric in the registry to w in the Prometheus
+// text format.
+func (reg *Registry) WritePrometheus(w io.Writer) error {
+	reg.mu.Lock()
+	metrics := append([]metric(nil), reg.metrics...)
+	reg.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// Snapshot returns the current value of every metric keyed by name, in a form
+// that can be encoded as JSON (and so published through expvar).
+func (reg *Registry) Snapshot() map[string]any {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	values := make(map[string]any, len(reg.metrics))
+	for _, m := range reg.metrics {
+		values[m.name()] = m.snapshot()
+	}
+
+	return values
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	desc
+	value atomic.Uint64
+}
+
+func (reg *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{desc: desc{n: name, help: help, typ: "counter"}}
+	reg.add(c)
+	return c
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w)
+	fmt.Fprintf(w, "%s %d\n", c.n, c.value.Load())
+}
+
+func (c *Counter) snapshot() any {
+	return c.value.Load()
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	desc
+	value atomic.Int64
+}
+
+func (reg *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{n: name, help: help, typ: "gauge"}}
+	reg.add(g)
+	return g
+}
+
+func (g *Gauge) Inc() {
+	g.value.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.value.Add(-1)
+}
+
+func (g *Gauge) Set(n int64) {
+	g.value.Store(n)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %d\n", g.n, g.value.Load())
+}
+
+func (g *Gauge) snapshot() any {
+	return g.value.Load()
+}
+
+// GaugeFunc is a gauge, or counter, whose value is read from fn each time the
+// metrics are collected. It's meant for values that are tracked elsewhere, such
+// as the stats of a connection pool.
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func (reg *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{n: name, help: help, typ: "gauge"}, fn: fn}
+	reg.add(g)
+	return g
+}
+
+// NewCounterFunc is like NewGaugeFunc, for values which only ever go up.
+func (reg *Registry) NewCounterFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{n: name, help: help, typ: "counter"}, fn: fn}
+	reg.add(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.n, formatFloat(g.fn()))
+}
+
+func (g *GaugeFunc) snapshot() any {
+	return g.fn()
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	desc
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       uint64
+}
+
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{n: name, help: help, typ: "counter"},
+		labels: labels,
+		series: make(map[string]*counterSeries),
+	}
+	reg.add(c)
+	return c
+}
+
+// Inc adds one to the counter with the given label values, which must be given in
+// the same order as the labels the vec was created with.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := seriesKey(c.n, c.labels, labelValues)
+
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: labelValues}
+		c.series[key] = s
+	}
+
+	s.value++
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(w)
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %d\n", c.n, formatLabels(c.labels, s.labelValues, "", ""), s.value)
+	}
+}
+
+func (c *CounterVec) snapshot() any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make(map[string]uint64, len(c.series))
+	for _, s := range c.series {
+		values[strings.Join(s.labelValues, " ")] = s.value
+	}
+
+	return values
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	desc
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec creates a histogram with the given upper bounds for its buckets,
+// which must be sorted. The +Inf bucket is added automatically.
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets for %s are not sorted", name))
+	}
+
+	h := &HistogramVec{
+		desc:    desc{n: name, help: help, typ: "histogram"},
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	reg.add(h)
+	return h
+}
+
+// Observe records value in the histogram with the given label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := seriesKey(h.n, h.labels, labelValues)
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	// values above the last bucket only show up in the +Inf bucket, which is count
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.n, formatLabels(h.labels, s.labelValues, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.n, formatLabels(h.labels, s.labelValues, "le", "+Inf"), s.count)
+
+		labels := formatLabels(h.labels, s.labelValues, "", "")
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.n, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.n, labels, s.count)
+	}
+}
+
+func (h *HistogramVec) snapshot() any {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	values := make(map[string]any, len(h.series))
+	for _, s := range h.series {
+		values[strings.Join(s.labelValues, " ")] = map[string]any{"count": s.count, "sum": s.sum}
+	}
+
+	return values
+}
+
+// desc is the name, help text and type shared by every metric.
+type desc struct {
+	n    string
+	help string
+	typ  string
+}
+
+func (d desc) name() string {
+	return d.n
+}
+
+func (d desc) header(w *bufio.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.n, help, d.n, d.typ)
+}
+
+func seriesKey(name string, labels, labelValues []string) string {
+	if len(labels) != len(labelValues) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", name, len(labels), len(labelValues)))
+	}
+
+	return strings.Join(labelValues, "\xff")
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders {name="value",...}, with an optional extra label on the
+// end for the le label of histogram buckets.
+func formatLabels(labels, labelValues []string, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, label, labelValueEscaper.Replace(labelValues[i]))
+	}
+
+	if extraName != "" {
+		if len(labels) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extraName, extraValue)
+	}
+
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
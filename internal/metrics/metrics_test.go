@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func writeString(t *testing.T, reg *Registry) string {
+	t.Helper()
+
+	var b strings.Builder
+	if err := reg.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	reg := NewRegistry()
+
+	c := reg.NewCounter("requests_total", "Requests received.")
+	c.Inc()
+	c.Add(2)
+
+	g := reg.NewGauge("in_flight", "Requests in flight.")
+	g.Set(5)
+	g.Dec()
+
+	reg.NewGaugeFunc("ratio", "A ratio.", func() float64 { return 0.25 })
+
+	want := `# HELP requests_total Requests received.
+# TYPE requests_total counter
+requests_total 3
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 4
+# HELP ratio A ratio.
+# TYPE ratio gauge
+ratio 0.25
+`
+	if got := writeString(t, reg); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHelpEscaping(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("escaped_total", "Backslash \\ and\nnewline.")
+
+	want := `# HELP escaped_total Backslash \\ and\nnewline.
+# TYPE escaped_total counter
+escaped_total 0
+`
+	if got := writeString(t, reg); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCounterVecLabels(t *testing.T) {
+	reg := NewRegistry()
+
+	c := reg.NewCounterVec("errors_total", "Errors.", "path", "code")
+	c.Inc("/b", "500")
+	c.Inc("/a", "404")
+	c.Inc("/a", "404")
+	c.Inc(`C:\dir "quoted"`+"\nline", "400")
+
+	want := `# HELP errors_total Errors.
+# TYPE errors_total counter
+errors_total{path="/a",code="404"} 2
+errors_total{path="/b",code="500"} 1
+errors_total{path="C:\\dir \"quoted\"\nline",code="400"} 1
+`
+	if got := writeString(t, reg); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	reg := NewRegistry()
+
+	h := reg.NewHistogramVec("duration_seconds", "Durations.", []float64{0.1, 0.5, 1}, "method")
+	h.Observe(0.05, "GET")
+	h.Observe(0.1, "GET") // on a bucket boundary, le is inclusive
+	h.Observe(0.7, "GET")
+	h.Observe(3, "GET") // above every bucket, only counted in +Inf
+	h.Observe(0.2, "POST")
+
+	want := `# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{method="GET",le="0.1"} 2
+duration_seconds_bucket{method="GET",le="0.5"} 2
+duration_seconds_bucket{method="GET",le="1"} 3
+duration_seconds_bucket{method="GET",le="+Inf"} 4
+duration_seconds_sum{method="GET"} 3.85
+duration_seconds_count{method="GET"} 4
+duration_seconds_bucket{method="POST",le="0.1"} 0
+duration_seconds_bucket{method="POST",le="0.5"} 1
+duration_seconds_bucket{method="POST",le="1"} 1
+duration_seconds_bucket{method="POST",le="+Inf"} 1
+duration_seconds_sum{method="POST"} 0.2
+duration_seconds_count{method="POST"} 1
+`
+	if got := writeString(t, reg); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	reg := NewRegistry()
+
+	h := reg.NewHistogramVec("size_bytes", "Sizes.", []float64{100})
+	h.Observe(1000)
+
+	want := `# HELP size_bytes Sizes.
+# TYPE size_bytes histogram
+size_bytes_bucket{le="100"} 0
+size_bytes_bucket{le="+Inf"} 1
+size_bytes_sum 1000
+size_bytes_count 1
+`
+	if got := writeString(t, reg); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering the same name twice did not panic")
+		}
+	}()
+
+	reg := NewRegistry()
+	reg.NewCounter("dup_total", "")
+	reg.NewGauge("dup_total", "")
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"sync"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+// Bus is an in-process event bus. Every reminder published to it is handed to
+// each current subscriber, such as a client of the reminder stream. Nothing is
+// kept for later, so a reminder fired while nobody is subscribed goes to no one.
+// A subscriber whose buffer fills up is dropped rather than holding up the
+// scheduler, in the same way as with Changes.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan data.Reminder]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan data.Reminder]struct{})}
+}
+
+// Subscribe returns a channel of reminders along with a function that must be
+// called to unsubscribe once the caller is done with it. The channel being closed
+// before then means the subscriber fell behind and was dropped.
+func (b *Bus) Subscribe(buffer int) (<-chan data.Reminder, func()) {
+	ch := make(chan data.Reminder, buffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(ch)
+	}
+
+	return ch, unsubscribe
+}
+
+func (b *Bus) Publish(reminder data.Reminder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- reminder:
+		default:
+			b.drop(ch)
+		}
+	}
+}
+
+// drop removes and closes a subscriber's channel, unless that was already done.
+// b.mu must be held.
+func (b *Bus) drop(ch chan data.Reminder) {
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
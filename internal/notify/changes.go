@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"sync"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+// ChangeType is what happened to a note.
+type ChangeType string
+
+const (
+	NoteCreated ChangeType = "created"
+	NoteUpdated ChangeType = "updated"
+	NoteDeleted ChangeType = "deleted"
+)
+
+// NoteChange is a note that was created, updated or deleted. Note is nil for
+// deletions.
+type NoteChange struct {
+	Type        ChangeType
+	NoteID      int64
+	WorkspaceID int64
+	Note        *data.Note
+}
+
+// Changes hands every note change published to it to each current subscriber.
+// A subscriber whose buffer fills up is dropped rather than holding up the
+// request that made the change: its channel is closed without it unsubscribing,
+// so it can tell it missed changes and start over.
+type Changes struct {
+	mu          sync.Mutex
+	subscribers map[chan NoteChange]struct{}
+}
+
+func NewChanges() *Changes {
+	return &Changes{subscribers: make(map[chan NoteChange]struct{})}
+}
+
+// Subscribe returns a channel of changes along with a function that must be
+// called to unsubscribe once the caller is done with it. The channel being closed
+// before then means the subscriber fell behind and was dropped.
+func (c *Changes) Subscribe(buffer int) (<-chan NoteChange, func()) {
+	ch := make(chan NoteChange, buffer)
+
+	c.mu.Lock()
+	c.subscribers[ch] = struct{}{}
+	c.mu.Unlock()
+
+	unsubscribe := func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.drop(ch)
+	}
+
+	return ch, unsubscribe
+}
+
+func (c *Changes) Publish(change NoteChange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for ch := range c.subscribers {
+		select {
+		case ch <- change:
+		default:
+			c.drop(ch)
+		}
+	}
+}
+
+// drop removes and closes a subscriber's channel, unless that was already done.
+// c.mu must be held.
+func (c *Changes) drop(ch chan NoteChange) {
+	if _, ok := c.subscribers[ch]; ok {
+		delete(c.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+// Notifier delivers a reminder that has come due.
+type Notifier interface {
+	Notify(ctx context.Context, reminder data.Reminder) error
+}
+
+// Sink is a Notifier with a name. Deliveries are queued and tracked for each sink
+// by its name, so a sink that is down is retried on its own without the others
+// sending the same reminder again.
+type Sink struct {
+	Name string
+	Notifier
+}
+
+// Names returns the name of every sink.
+func Names(sinks []Sink) []string {
+	names := make([]string, len(sinks))
+	for i, sink := range sinks {
+		names[i] = sink.Name
+	}
+
+	return names
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/KevuTheDev/notes-backend-api/internal/data"
+)
+
+// SMTP emails each reminder to a single recipient, and can send other mail such
+// as workspace invitations with Send. Leaving the username empty sends without
+// authentication, which is what local mail catchers such as MailHog or Mailpit
+// expect.
+type SMTP struct {
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	Sender    string
+	Recipient string
+}
+
+func (s *SMTP) Notify(ctx context.Context, reminder data.Reminder) error {
+	subject := fmt.Sprintf("Reminder: %s", reminder.Title)
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Your reminder for \"%s\" is due at %s.\r\n", reminder.Title, reminder.RemindAt.Format(time.RFC1123))
+	fmt.Fprintf(&body, "\r\nNote: /v1/notes/%d\r\n", reminder.NoteID)
+
+	return s.Send(ctx, s.Recipient, subject, body.String())
+}
+
+// Send emails a plain text message to a single address.
+func (s *SMTP) Send(ctx context.Context, to, subject, body string) error {
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+
+	// the sender can have a display name, as in "Notebook <no-reply@example.com>",
+	// which belongs in the From header but not in the envelope's MAIL FROM
+	from, err := mail.ParseAddress(s.Sender)
+	if err != nil {
+		return fmt.Errorf("smtp sender %q: %w", s.Sender, err)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.Sender)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	msg.WriteString(body)
+
+	// smtp.SendMail doesn't take a context, so run it in the background and give up
+	// waiting on it if the context is done first
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(addr, auth, from.Address, []string{to}, msg.Bytes())
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
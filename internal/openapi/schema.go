@@ -0,0 +1,212 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema, as used by OpenAPI 3.1.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+
+	// Closed objects don't allow properties other than the ones listed. It is
+	// written out as "additionalProperties": false.
+	Closed bool `json:"-"`
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type plain Schema
+	if !s.Closed || s.AdditionalProperties != nil {
+		return json.Marshal((*plain)(s))
+	}
+
+	return json.Marshal(struct {
+		*plain
+		AdditionalProperties bool `json:"additionalProperties"`
+	}{plain: (*plain)(s)})
+}
+
+// Types is the type keyword, which holds one type name or a list of them. A
+// single type is written out as a plain string.
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+
+	return json.Marshal([]string(t))
+}
+
+// Ref returns a schema pointing at the named schema in the components.
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Object returns a closed object schema with every property required.
+func Object(properties map[string]*Schema) *Schema {
+	s := &Schema{Type: Types{"object"}, Properties: properties, Closed: true}
+	for name := range properties {
+		s.Required = append(s.Required, name)
+	}
+	sort.Strings(s.Required)
+
+	return s
+}
+
+func String() *Schema  { return &Schema{Type: Types{"string"}} }
+func Integer() *Schema { return &Schema{Type: Types{"integer"}} }
+func Boolean() *Schema { return &Schema{Type: Types{"boolean"}} }
+
+// DateTime is an RFC 3339 timestamp.
+func DateTime() *Schema { return &Schema{Type: Types{"string"}, Format: "date-time"} }
+
+// ArrayOf returns an array schema of items.
+func ArrayOf(items *Schema) *Schema { return &Schema{Type: Types{"array"}, Items: items} }
+
+// MapOf returns an object schema with any properties, all matching values.
+func MapOf(values *Schema) *Schema {
+	return &Schema{Type: Types{"object"}, AdditionalProperties: values}
+}
+
+// Nullable returns a copy of s which also allows null.
+func Nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return &Schema{OneOf: []*Schema{s, {Type: Types{"null"}}}}
+	}
+
+	c := *s
+	c.Type = append(Types{}, s.Type...)
+	c.Type = append(c.Type, "null")
+
+	return &c
+}
+
+// Generator builds schemas from Go types, adding every named struct it comes
+// across to the components of a document and referring to it from there.
+type Generator struct {
+	doc *Document
+}
+
+func NewGenerator(doc *Document) *Generator {
+	return &Generator{doc: doc}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaFor returns the schema of the JSON encoding of v's type.
+func (g *Generator) SchemaFor(v any) *Schema {
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return DateTime()
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := g.doc.Components.Schemas[t.Name()]; !ok {
+			// a placeholder goes in first, so types which refer to themselves don't
+			// recurse forever
+			g.doc.Components.Schemas[t.Name()] = &Schema{}
+			*g.doc.Components.Schemas[t.Name()] = *g.structSchema(t)
+		}
+		return Ref(t.Name())
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return g.structSchema(t)
+	case reflect.String:
+		return String()
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Integer()
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.Slice, reflect.Array:
+		return ArrayOf(g.schema(t.Elem()))
+	case reflect.Map:
+		return MapOf(g.schema(t.Elem()))
+	default:
+		// interfaces can hold anything
+		return &Schema{}
+	}
+}
+
+// structSchema follows the rules of encoding/json: embedded structs are
+// flattened, omitempty fields are optional, and pointers and slices which are
+// always written out can be null.
+func (g *Generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: Types{"object"}, Properties: make(map[string]*Schema), Closed: true}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		omitEmpty := strings.Contains(opts, "omitempty")
+
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := g.structSchema(embedded)
+				for prop, schema := range inner.Properties {
+					s.Properties[prop] = schema
+				}
+				s.Required = append(s.Required, inner.Required...)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := g.schema(f.Type)
+
+		kind := f.Type.Kind()
+		if !omitEmpty && (kind == reflect.Pointer || kind == reflect.Slice || kind == reflect.Map) {
+			schema = Nullable(schema)
+		}
+
+		s.Properties[name] = schema
+		if !omitEmpty {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	sort.Strings(s.Required)
+
+	return s
+}
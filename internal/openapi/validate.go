@@ -0,0 +1,216 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Violation is a place where a value doesn't match its schema. Path is where in
+// the value it is, such as body.note.tags[2].
+type Violation struct {
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// Validate checks a value decoded by encoding/json against s, resolving any
+// references against the components of d.
+func (d *Document) Validate(s *Schema, value any, path string) []Violation {
+	var violations []Violation
+	d.validate(s, value, path, &violations)
+	return violations
+}
+
+func (d *Document) validate(s *Schema, value any, path string, violations *[]Violation) {
+	if s == nil {
+		return
+	}
+
+	if s.Ref != "" {
+		d.validate(d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")], value, path, violations)
+		return
+	}
+
+	add := func(format string, args ...any) {
+		*violations = append(*violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, option := range s.OneOf {
+			if len(d.Validate(option, value, path)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			add("must match exactly one schema of oneOf, matched %d", matched)
+		}
+		return
+	}
+
+	if len(s.Type) > 0 && !matchesType(s.Type, value) {
+		add("must be %s, not %s", strings.Join(s.Type, " or "), typeOf(value))
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		add("must be one of %v", s.Enum)
+	}
+
+	switch value := value.(type) {
+	case string:
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				add("must be a RFC 3339 date-time")
+			}
+		}
+
+	case float64:
+		if s.Minimum != nil && value < *s.Minimum {
+			add("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			add("must be at most %v", *s.Maximum)
+		}
+
+	case []any:
+		for i, item := range value {
+			d.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				add("%q is required", name)
+			}
+		}
+
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			child := path + "." + name
+			switch prop, ok := s.Properties[name]; {
+			case ok:
+				d.validate(prop, value[name], child, violations)
+			case s.AdditionalProperties != nil:
+				d.validate(s.AdditionalProperties, value[name], child, violations)
+			case s.Closed:
+				*violations = append(*violations, Violation{Path: child, Message: "is not allowed"})
+			}
+		}
+	}
+}
+
+func matchesType(types Types, value any) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateParameter checks the text of a path, query or header parameter,
+// after converting it to the type in the parameter's schema. Arrays are comma
+// separated.
+func (d *Document) ValidateParameter(p *Parameter, raw string) []Violation {
+	path := p.In + "." + p.Name
+
+	value, ok := parseParameter(p.Schema, raw)
+	if !ok {
+		return []Violation{{Path: path, Message: fmt.Sprintf("must be %s", strings.Join(p.Schema.Type, " or "))}}
+	}
+
+	return d.Validate(p.Schema, value, path)
+}
+
+func parseParameter(s *Schema, raw string) (any, bool) {
+	if len(s.Type) == 0 {
+		return raw, true
+	}
+
+	switch s.Type[0] {
+	case "integer", "number":
+		f, err := strconv.ParseFloat(raw, 64)
+		return f, err == nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		return b, err == nil
+	case "array":
+		var items []any
+		for _, item := range strings.Split(raw, ",") {
+			value, ok := parseParameter(s.Items, item)
+			if !ok {
+				return nil, false
+			}
+			items = append(items, value)
+		}
+		return items, true
+	default:
+		return raw, true
+	}
+}
@@ -2,6 +2,7 @@ package validator
 
 import (
 	"regexp"
+	"sort"
 )
 
 // Declare a regular expression for sanity checking the format of email addresses (we'll
@@ -13,14 +14,29 @@ var (
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 )
 
-// Define a new Validator type which contains a map of validation errors.
+// Codes for the kinds of validation error, so clients can tell them apart without
+// parsing the messages. These are part of the API and must not change.
+const (
+	CodeRequired      = "required"       // the value is missing or empty
+	CodeTooLong       = "too_long"       // the value is longer than allowed
+	CodeTooSmall      = "too_small"      // the value is below the minimum
+	CodeTooLarge      = "too_large"      // the value is above the maximum
+	CodeDuplicate     = "duplicate"      // a list holds the same value more than once
+	CodeNotPermitted  = "not_permitted"  // the value is not one of the allowed values
+	CodeInvalidFormat = "invalid_format" // the value could not be parsed
+	CodeInvalid       = "invalid"        // the value is well formed but not acceptable
+)
+
+// Define a new Validator type which contains a map of validation errors, and the
+// code for each of them.
 type Validator struct {
 	Errors map[string]string
+	Codes  map[string]string
 }
 
-// New is a helper which creates a new Validator instance with an empty errors map.
+// New is a helper which creates a new Validator instance with empty errors maps.
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{Errors: make(map[string]string), Codes: make(map[string]string)}
 }
 
 // Valid returns true if the errors map doesn't contain any entries.
@@ -28,21 +44,41 @@ func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-// AddError adds an error message to the map (so long as no entry already exists for
-// the given key).
-func (v *Validator) AddError(key, message string) {
+// AddError adds an error message and its code to the maps (so long as no entry already
+// exists for the given key).
+func (v *Validator) AddError(key, code, message string) {
 	if _, exists := v.Errors[key]; !exists {
 		v.Errors[key] = message
+		v.Codes[key] = code
 	}
 }
 
 // Check adds an error message to the map only if a validation check is not 'ok'.
-func (v *Validator) Check(ok bool, key, message string) {
+func (v *Validator) Check(ok bool, key, code, message string) {
 	if !ok {
-		v.AddError(key, message)
+		v.AddError(key, code, message)
 	}
 }
 
+// FieldError is a single validation error.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// FieldErrors returns the errors as a list sorted by field.
+func (v *Validator) FieldErrors() []FieldError {
+	errors := make([]FieldError, 0, len(v.Errors))
+	for field, message := range v.Errors {
+		errors = append(errors, FieldError{Field: field, Code: v.Codes[field], Message: message})
+	}
+
+	sort.Slice(errors, func(i, j int) bool { return errors[i].Field < errors[j].Field })
+
+	return errors
+}
+
 // Generic function which returns true if a specific value is in a list.
 func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	for i := range permittedValues {
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS note_attachments;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS note_attachments (
+    id bigserial PRIMARY KEY,
+    note_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    filename text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    checksum text NOT NULL,
+    storage_key text NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS note_attachments_note_id_idx ON note_attachments (note_id);
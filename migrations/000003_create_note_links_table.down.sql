@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS notes_lower_title_idx;
+DROP TABLE IF EXISTS note_links;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS note_links (
+    source_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    kind text NOT NULL,
+    target_id bigint,
+    target_title text,
+    CHECK ((kind = 'wiki' AND target_title IS NOT NULL) OR (kind = 'id' AND target_id IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS note_links_source_id_idx ON note_links (source_id);
+CREATE INDEX IF NOT EXISTS note_links_target_id_idx ON note_links (target_id);
+CREATE INDEX IF NOT EXISTS note_links_target_title_idx ON note_links (lower(target_title));
+CREATE INDEX IF NOT EXISTS notes_lower_title_idx ON notes (lower(title));
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS notes_tags_idx;
+DROP INDEX IF EXISTS notes_search_idx;
+DROP INDEX IF EXISTS notes_archived_pinned_idx;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS color;
+ALTER TABLE notes DROP COLUMN IF EXISTS archived;
+ALTER TABLE notes DROP COLUMN IF EXISTS pinned;
@@ -0,0 +1,7 @@
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS pinned boolean NOT NULL DEFAULT false;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS archived boolean NOT NULL DEFAULT false;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS color text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS notes_archived_pinned_idx ON notes (archived, pinned);
+CREATE INDEX IF NOT EXISTS notes_search_idx ON notes USING GIN (to_tsvector('simple', title || ' ' || content));
+CREATE INDEX IF NOT EXISTS notes_tags_idx ON notes USING GIN (tags);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS notes_remind_at_idx;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS reminder_count;
+ALTER TABLE notes DROP COLUMN IF EXISTS recurrence;
+ALTER TABLE notes DROP COLUMN IF EXISTS remind_at;
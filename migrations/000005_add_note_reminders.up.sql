@@ -0,0 +1,5 @@
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS remind_at timestamp(0) with time zone;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS recurrence text NOT NULL DEFAULT '';
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS reminder_count integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS notes_remind_at_idx ON notes (remind_at) WHERE remind_at IS NOT NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS note_items;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS note_items (
+    id bigserial PRIMARY KEY,
+    note_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    text text NOT NULL,
+    checked boolean NOT NULL DEFAULT false,
+    position integer NOT NULL,
+    due_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS note_items_note_id_position_idx ON note_items (note_id, position);
+CREATE INDEX IF NOT EXISTS note_items_checked_due_at_idx ON note_items (checked, due_at);
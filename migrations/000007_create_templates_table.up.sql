@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS templates (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    tags text[] NOT NULL,
+    counter bigint NOT NULL DEFAULT 0,
+    version integer NOT NULL DEFAULT 1
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS public_links (
+    id bigserial PRIMARY KEY,
+    note_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    token_hash bytea NOT NULL UNIQUE,
+    expires_at timestamp(0) with time zone,
+    max_views integer,
+    views integer NOT NULL DEFAULT 0,
+    password_hash bytea,
+    last_accessed_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS public_links_note_id_idx ON public_links (note_id);
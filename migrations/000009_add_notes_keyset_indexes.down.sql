@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS notes_archived_created_at_id_idx;
+DROP INDEX IF EXISTS notes_archived_last_updated_at_id_idx;
+DROP INDEX IF EXISTS notes_archived_title_id_idx;
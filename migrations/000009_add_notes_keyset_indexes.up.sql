@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS notes_archived_created_at_id_idx ON notes (archived, created_at, id);
+CREATE INDEX IF NOT EXISTS notes_archived_last_updated_at_id_idx ON notes (archived, last_updated_at, id);
+CREATE INDEX IF NOT EXISTS notes_archived_title_id_idx ON notes (archived, title, id);
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS workspaces (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    slug text NOT NULL UNIQUE
+);
+
+-- notes written before workspaces existed all belong to the default workspace
+INSERT INTO workspaces (id, name, slug) VALUES (1, 'Default', 'default') ON CONFLICT DO NOTHING;
+SELECT setval('workspaces_id_seq', (SELECT max(id) FROM workspaces));
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    id bigserial PRIMARY KEY,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    email text NOT NULL,
+    role text NOT NULL CHECK (role IN ('owner', 'admin', 'editor', 'viewer')),
+    token_hash bytea NOT NULL UNIQUE,
+    UNIQUE (workspace_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+    id bigserial PRIMARY KEY,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    email text NOT NULL,
+    role text NOT NULL CHECK (role IN ('owner', 'admin', 'editor', 'viewer')),
+    token_hash bytea NOT NULL UNIQUE,
+    expires_at timestamp(0) with time zone NOT NULL,
+    accepted_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS workspace_invitations_workspace_id_idx ON workspace_invitations (workspace_id);
+
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS workspace_id bigint NOT NULL DEFAULT 1 REFERENCES workspaces ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS notes_workspace_id_idx ON notes (workspace_id, id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS reminder_deliveries (
+    id bigserial PRIMARY KEY,
+    note_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    sink text NOT NULL,
+    title text NOT NULL,
+    remind_at timestamp(0) with time zone NOT NULL,
+    recurrence text NOT NULL DEFAULT '',
+    occurrence integer NOT NULL,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_error text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS reminder_deliveries_pending_idx ON reminder_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS reminder_deliveries_note_id_idx ON reminder_deliveries (note_id);
@@ -0,0 +1,3 @@
+ALTER TABLE templates ADD COLUMN IF NOT EXISTS workspace_id bigint NOT NULL DEFAULT 1 REFERENCES workspaces ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS templates_workspace_id_idx ON templates (workspace_id);
@@ -0,0 +1,2 @@
+ALTER TABLE public_links DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE public_links DROP COLUMN IF EXISTS failed_attempts;
@@ -0,0 +1,2 @@
+ALTER TABLE public_links ADD COLUMN IF NOT EXISTS failed_attempts integer NOT NULL DEFAULT 0;
+ALTER TABLE public_links ADD COLUMN IF NOT EXISTS locked_until timestamp(0) with time zone;
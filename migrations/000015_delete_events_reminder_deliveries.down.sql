@@ -0,0 +1 @@
+-- the deleted deliveries were never going to be sent, so there is nothing to put back
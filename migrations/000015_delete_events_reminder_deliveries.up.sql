@@ -0,0 +1,2 @@
+-- fired reminders are published to the event bus directly, without a delivery
+DELETE FROM reminder_deliveries WHERE sink = 'events';
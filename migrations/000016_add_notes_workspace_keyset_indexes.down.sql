@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS notes_workspace_archived_pinned_created_at_id_idx;
+DROP INDEX IF EXISTS notes_workspace_archived_pinned_last_updated_at_id_idx;
+DROP INDEX IF EXISTS notes_workspace_archived_pinned_title_id_idx;
+
+CREATE INDEX IF NOT EXISTS notes_archived_created_at_id_idx ON notes (archived, created_at, id);
+CREATE INDEX IF NOT EXISTS notes_archived_last_updated_at_id_idx ON notes (archived, last_updated_at, id);
+CREATE INDEX IF NOT EXISTS notes_archived_title_id_idx ON notes (archived, title, id);
@@ -0,0 +1,9 @@
+-- note listings are filtered by workspace and archived, and list pinned notes
+-- first by default, so the keyset indexes lead with those columns
+DROP INDEX IF EXISTS notes_archived_created_at_id_idx;
+DROP INDEX IF EXISTS notes_archived_last_updated_at_id_idx;
+DROP INDEX IF EXISTS notes_archived_title_id_idx;
+
+CREATE INDEX IF NOT EXISTS notes_workspace_archived_pinned_created_at_id_idx ON notes (workspace_id, archived, pinned, created_at, id);
+CREATE INDEX IF NOT EXISTS notes_workspace_archived_pinned_last_updated_at_id_idx ON notes (workspace_id, archived, pinned, last_updated_at, id);
+CREATE INDEX IF NOT EXISTS notes_workspace_archived_pinned_title_id_idx ON notes (workspace_id, archived, pinned, title, id);
@@ -0,0 +1,19 @@
+-- the response to the first request sent with each Idempotency-Key, so a retry of
+-- it gets the same response instead of making the change again. status is NULL
+-- while the first request is still being handled.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id bigserial PRIMARY KEY,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    member_id bigint NOT NULL DEFAULT 0,
+    key text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    method text NOT NULL,
+    path text NOT NULL,
+    request_hash bytea,
+    status integer,
+    headers jsonb NOT NULL DEFAULT '{}',
+    body bytea,
+    UNIQUE (workspace_id, member_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
@@ -0,0 +1,333 @@
+// Package client is a Go client for the notes API.
+//
+//	c, err := client.New("http://localhost:4000", client.WithToken(token), client.WithRetries(3))
+//	if err != nil {
+//		return err
+//	}
+//	note, err := c.CreateNote(ctx, client.NoteInput{Title: "Groceries"})
+//
+// Error responses are returned as an *APIError, or a *ValidationError when
+// fields failed validation. Missing notes and edit conflicts can be told apart
+// with errors.Is and ErrNotFound or ErrEditConflict.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client makes requests to the notes API. It is safe for concurrent use.
+type Client struct {
+	baseURL         *url.URL
+	httpClient      *http.Client
+	tokenSource     TokenSource
+	userAgent       string
+	workspace       string
+	retry           RetryPolicy
+	idempotencyKeys bool
+}
+
+// TokenSource returns the token to authenticate a request with. It is called
+// for every request, so a source can refresh tokens as they expire.
+type TokenSource func(ctx context.Context) (string, error)
+
+// RetryPolicy decides how failed requests are retried. Requests are retried
+// after network errors and 429, 502, 503 and 504 responses, waiting twice as
+// long after each attempt, or as long as the Retry-After header asks.
+//
+// Only requests which are safe to repeat are retried: GET, HEAD, PUT and DELETE,
+// along with POST and PATCH requests sent with an idempotency key, which the API
+// applies only once. Other POST and PATCH requests are never retried, since a
+// retry could apply the change twice.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts in all, including the first. 1 or less turns retries off
+	MinBackoff  time.Duration // wait before the first retry
+	MaxBackoff  time.Duration // longest wait between attempts
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client requests are sent with. The default is
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithToken sends token as a bearer token in the Authorization header of every
+// request.
+func WithToken(token string) Option {
+	return WithTokenSource(func(context.Context) (string, error) { return token, nil })
+}
+
+// WithTokenSource gets the bearer token of each request from source.
+func WithTokenSource(source TokenSource) Option {
+	return func(c *Client) { c.tokenSource = source }
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// WithWorkspace sends every request to the workspace with the given slug or
+// id, in the X-Workspace header. Use WithToken to pass the member token of the
+// workspace. Without it requests go to the default workspace.
+func WithWorkspace(workspace string) Option {
+	return func(c *Client) { c.workspace = workspace }
+}
+
+// WithRetries retries requests up to maxAttempts times in all, starting with a
+// wait of 100ms and backing off to at most 5s.
+func WithRetries(maxAttempts int) Option {
+	return WithRetryPolicy(RetryPolicy{MaxAttempts: maxAttempts, MinBackoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second})
+}
+
+// WithRetryPolicy sets how failed requests are retried.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) { c.retry = policy }
+}
+
+// WithIdempotencyKeys sends a random Idempotency-Key header with every POST
+// and PATCH request, so they can be retried without the change being applied
+// twice. A key of your own can be given to a single request with IdempotencyKey.
+func WithIdempotencyKeys() Option {
+	return func(c *Client) { c.idempotencyKeys = true }
+}
+
+type idempotencyKeyContextKey struct{}
+
+// IdempotencyKey returns a context which sends key as the Idempotency-Key of
+// the POST and PATCH requests made with it. Use it to keep the same key when a
+// request is repeated after a restart. The API sends back the response to the
+// first request with a key for 24 hours, as long as the request is the same.
+func IdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// New returns a client for the API served at baseURL, such as
+// "https://notes.example.com". A trailing /v1 is optional.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1"))
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("client: base URL %q must be http or https", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		userAgent:  "notes-go-client",
+		retry:      RetryPolicy{MaxAttempts: 1},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// url resolves path, such as /v1/notes/1, against the base URL.
+func (c *Client) url(path string, query url.Values) string {
+	u := *c.baseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// newRequest builds a request for path. A non-nil body is sent as JSON unless it
+// is an io.Reader, which is sent as it is.
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body any) (*http.Request, error) {
+	return c.newRequestURL(ctx, method, c.url(path, query), body)
+}
+
+func (c *Client) newRequestURL(ctx context.Context, method, u string, body any) (*http.Request, error) {
+	var r io.Reader
+	contentType := ""
+
+	switch body := body.(type) {
+	case nil:
+	case io.Reader:
+		r = body
+	default:
+		js, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		// a bytes.Reader lets the request be sent again when it's retried
+		r = bytes.NewReader(js)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// problem details have the same shape for every error, validation included
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.workspace != "" {
+		req.Header.Set("X-Workspace", c.workspace)
+	}
+
+	if c.tokenSource != nil {
+		token, err := c.tokenSource(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("client: getting a token: %w", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	if method == http.MethodPost || method == http.MethodPatch {
+		key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+		if key == "" && c.idempotencyKeys {
+			key = randomKey()
+		}
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+	}
+
+	return req, nil
+}
+
+// do sends req, retrying it as the retry policy allows, and decodes the JSON
+// response into dst if it isn't nil. Error responses are returned as an
+// *APIError or *ValidationError.
+func (c *Client) do(req *http.Request, dst any) (*http.Response, error) {
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp, decodeError(resp)
+	}
+
+	if dst != nil {
+		err = json.NewDecoder(resp.Body).Decode(dst)
+		if err != nil {
+			return resp, fmt.Errorf("client: decoding %s %s: %w", req.Method, req.URL.Path, err)
+		}
+	}
+
+	return resp, nil
+}
+
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.httpClient.Do(req)
+
+		if attempt >= c.retry.MaxAttempts || !retryable(req, resp, err) {
+			return resp, err
+		}
+
+		wait := c.backoff(attempt, resp)
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether a request which failed with resp or err can be
+// sent again.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	// a body which can't be replayed can't be sent again
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	case http.MethodPost, http.MethodPatch:
+		// the API applies a request only once for each key
+		if req.Header.Get("Idempotency-Key") == "" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff returns how long to wait before the attempt after the given one. A
+// Retry-After header in seconds is honoured, up to the MaxBackoff.
+func (c *Client) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, c.retry.MaxBackoff)
+		}
+	}
+
+	wait := c.retry.MinBackoff << (attempt - 1)
+	if wait <= 0 || wait > c.retry.MaxBackoff {
+		wait = c.retry.MaxBackoff
+	}
+
+	// jitter keeps clients which failed together from retrying together
+	if wait > 0 {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(wait/2)+1))
+		if err == nil {
+			wait = wait/2 + time.Duration(n.Int64())
+		}
+	}
+
+	return wait
+}
+
+func randomKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNotFound matches the error of a 404 response, with errors.Is.
+	ErrNotFound = errors.New("client: not found")
+
+	// ErrEditConflict matches the error of a 409 response, which the API sends
+	// when a note was changed since the version an update was made against.
+	ErrEditConflict = errors.New("client: edit conflict")
+)
+
+// APIError is an error response from the API.
+type APIError struct {
+	StatusCode int
+	Code       string // such as "not_found" or "validation_failed"
+	Message    string
+	RequestID  string // the X-Request-Id of the request, for finding it in the logs
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("notes api: %d %s", e.StatusCode, e.Message)
+}
+
+// Is lets errors.Is match ErrNotFound and ErrEditConflict.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrEditConflict:
+		return e.StatusCode == http.StatusConflict
+	default:
+		return false
+	}
+}
+
+// ValidationError is the error of a 422 response. Fields holds the message for
+// each field which failed validation, as in the validator's map on the server.
+type ValidationError struct {
+	APIError
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	msg := e.APIError.Error()
+	for _, field := range fields {
+		msg += fmt.Sprintf("; %s %s", field, e.Fields[field])
+	}
+
+	return msg
+}
+
+// Unwrap gives errors.As access to the *APIError.
+func (e *ValidationError) Unwrap() error {
+	return &e.APIError
+}
+
+// decodeError reads the problem details of an error response into an *APIError,
+// or a *ValidationError for a 422. Anything that isn't problem details, such as
+// a proxy's HTML error page, is reported by its status alone.
+func decodeError(resp *http.Response) error {
+	apiErr := APIError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.ToLower(http.StatusText(resp.StatusCode)),
+		RequestID:  resp.Header.Get("X-Request-Id"),
+	}
+
+	var problem struct {
+		Code   string `json:"code"`
+		Detail string `json:"detail"`
+		Errors []struct {
+			Field   string `json:"field"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err == nil && json.Unmarshal(body, &problem) == nil {
+		apiErr.Code = problem.Code
+		if problem.Detail != "" {
+			apiErr.Message = problem.Detail
+		}
+	}
+
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		return &apiErr
+	}
+
+	fields := make(map[string]string, len(problem.Errors))
+	for _, fe := range problem.Errors {
+		fields[fe.Field] = fe.Message
+	}
+
+	return &ValidationError{APIError: apiErr, Fields: fields}
+}
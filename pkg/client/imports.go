@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+)
+
+// ImportFile is a file to import notes from. The format is picked from the
+// extension of Name: Markdown (.md), Evernote (.enex), JSON (.json) or a .zip of
+// any of those.
+type ImportFile struct {
+	Name string
+	Data io.Reader
+}
+
+// ImportJob is the progress of an import running on the server.
+type ImportJob struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"` // pending, running, completed or failed
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Files      int           `json:"files"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	Imported   int           `json:"imported"`
+	Failed     int           `json:"failed"`
+	NoteIDs    []int64       `json:"note_ids,omitempty"`
+	Errors     []ImportError `json:"errors,omitempty"`
+}
+
+// Done reports whether the job has finished, successfully or not.
+func (j *ImportJob) Done() bool {
+	return j.Status == "completed" || j.Status == "failed"
+}
+
+// ImportError is why a file, or a note in it, wasn't imported. Errors holds the
+// message for each field of a note which failed validation.
+type ImportError struct {
+	File   string            `json:"file"`
+	Error  string            `json:"error,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Import uploads files and starts importing the notes in them. The import runs
+// in the background, see ImportJob and WaitForImport.
+func (c *Client) Import(ctx context.Context, files ...ImportFile) (*ImportJob, error) {
+	// the form is streamed through a pipe so large files aren't held in memory
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		for _, file := range files {
+			part, err := form.CreateFormFile("files", file.Name)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			_, err = io.Copy(part, file.Data)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+
+		pw.CloseWithError(form.Close())
+	}()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/v1/import", nil, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	var env struct {
+		Job *ImportJob `json:"job"`
+	}
+	_, err = c.do(req, &env)
+	if err != nil {
+		pr.CloseWithError(err)
+		return nil, err
+	}
+
+	return env.Job, nil
+}
+
+// ImportJob fetches the progress of an import.
+func (c *Client) ImportJob(ctx context.Context, id string) (*ImportJob, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/import/"+id, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var env struct {
+		Job *ImportJob `json:"job"`
+	}
+	_, err = c.do(req, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Job, nil
+}
+
+// WaitForImport polls an import every interval until it is done, or ctx ends.
+func (c *Client) WaitForImport(ctx context.Context, id string, interval time.Duration) (*ImportJob, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job, err := c.ImportJob(ctx, id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
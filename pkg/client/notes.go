@@ -0,0 +1,339 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Note is a note as the API returns it.
+type Note struct {
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastUpdatedAt time.Time  `json:"last_updated_at"`
+	Title         string     `json:"title"`
+	Content       string     `json:"content,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	Pinned        bool       `json:"pinned"`
+	Archived      bool       `json:"archived"`
+	Color         string     `json:"color,omitempty"`
+	RemindAt      *time.Time `json:"remind_at,omitempty"`
+	Recurrence    string     `json:"recurrence,omitempty"`
+	Version       int32      `json:"version"`
+}
+
+// NoteInput holds the fields of a new note. Only the title is required.
+type NoteInput struct {
+	Title      string     `json:"title"`
+	Content    string     `json:"content,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Pinned     bool       `json:"pinned,omitempty"`
+	Archived   bool       `json:"archived,omitempty"`
+	Color      string     `json:"color,omitempty"`
+	RemindAt   *time.Time `json:"remind_at,omitempty"`
+	Recurrence string     `json:"recurrence,omitempty"`
+}
+
+// NoteUpdate holds the changes to a note. Fields left nil are not changed.
+type NoteUpdate struct {
+	Title      *string
+	Content    *string
+	Tags       []string
+	Pinned     *bool
+	Archived   *bool
+	Color      *string
+	RemindAt   *time.Time
+	Recurrence *string
+
+	// ClearRemindAt removes the reminder of the note.
+	ClearRemindAt bool
+
+	// Version is the version of the note the changes were made against. When it
+	// is set, the update fails with an edit conflict if the note has changed
+	// since.
+	Version int32
+
+	// RewriteLinks updates [[title]] links in other notes when the title changes.
+	RewriteLinks bool
+}
+
+func (u NoteUpdate) MarshalJSON() ([]byte, error) {
+	body := map[string]any{}
+
+	set := func(name string, value any, ok bool) {
+		if ok {
+			body[name] = value
+		}
+	}
+
+	set("title", u.Title, u.Title != nil)
+	set("content", u.Content, u.Content != nil)
+	set("tags", u.Tags, u.Tags != nil)
+	set("pinned", u.Pinned, u.Pinned != nil)
+	set("archived", u.Archived, u.Archived != nil)
+	set("color", u.Color, u.Color != nil)
+	set("remind_at", u.RemindAt, u.RemindAt != nil || u.ClearRemindAt)
+	set("recurrence", u.Recurrence, u.Recurrence != nil)
+	set("version", u.Version, u.Version != 0)
+
+	return json.Marshal(body)
+}
+
+// CreateNote creates a note.
+func (c *Client) CreateNote(ctx context.Context, input NoteInput) (*Note, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, "/v1/notes", nil, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var env struct {
+		Note *Note `json:"note"`
+	}
+	_, err = c.do(req, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Note, nil
+}
+
+// GetNote fetches the note with the given id.
+func (c *Client) GetNote(ctx context.Context, id int64) (*Note, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, notePath(id), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var env struct {
+		Note *Note `json:"note"`
+	}
+	_, err = c.do(req, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Note, nil
+}
+
+// UpdateNote changes the fields of a note given in update.
+func (c *Client) UpdateNote(ctx context.Context, id int64, update NoteUpdate) (*Note, error) {
+	query := url.Values{}
+	if update.RewriteLinks {
+		query.Set("rewrite_links", "true")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch, notePath(id), query, update)
+	if err != nil {
+		return nil, err
+	}
+
+	var env struct {
+		Note *Note `json:"note"`
+	}
+	_, err = c.do(req, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Note, nil
+}
+
+// DeleteNote deletes a note along with its attachments.
+func (c *Client) DeleteNote(ctx context.Context, id int64) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, notePath(id), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(req, nil)
+	return err
+}
+
+// ListOptions filters, sorts and pages a listing of notes. The zero value lists
+// the first page of unarchived notes, most recently updated first.
+type ListOptions struct {
+	Query    string   // full text search
+	Tags     []string // notes with all of these tags
+	Archived bool     // list archived notes instead
+	Pinned   *bool    // only pinned, or only unpinned, notes
+
+	// PinnedFirst lists pinned notes before the rest. It is on unless set to
+	// false.
+	PinnedFirst *bool
+
+	Sort     string // such as "title" or "-created_at"
+	Page     int
+	PageSize int
+}
+
+func (o ListOptions) values() url.Values {
+	query := url.Values{}
+
+	if o.Query != "" {
+		query.Set("q", o.Query)
+	}
+	if len(o.Tags) > 0 {
+		query.Set("tags", strings.Join(o.Tags, ","))
+	}
+	if o.Archived {
+		query.Set("archived", "true")
+	}
+	if o.Pinned != nil {
+		query.Set("pinned", strconv.FormatBool(*o.Pinned))
+	}
+	if o.PinnedFirst != nil {
+		query.Set("pinned_first", strconv.FormatBool(*o.PinnedFirst))
+	}
+	if o.Sort != "" {
+		query.Set("sort", o.Sort)
+	}
+	if o.Page > 0 {
+		query.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PageSize > 0 {
+		query.Set("page_size", strconv.Itoa(o.PageSize))
+	}
+
+	return query
+}
+
+// Metadata describes a page of a listing. Next and Prev link to the pages
+// either side of it, when there are any.
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	Next         string `json:"next,omitempty"`
+	Prev         string `json:"prev,omitempty"`
+}
+
+// NotePage is one page of a listing of notes.
+type NotePage struct {
+	Notes    []*Note  `json:"notes"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// ListNotesPage fetches a single page of notes.
+func (c *Client) ListNotesPage(ctx context.Context, opts ListOptions) (*NotePage, error) {
+	return c.listNotes(ctx, c.url("/v1/notes", opts.values()))
+}
+
+func (c *Client) listNotes(ctx context.Context, u string) (*NotePage, error) {
+	req, err := c.newRequestURL(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var page NotePage
+	_, err = c.do(req, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// ListNotes returns an iterator over every note matching opts, starting from
+// opts.Page. Pages are fetched as they are needed by following the cursor of
+// the page before, so notes added or removed meanwhile don't cause any to be
+// skipped or repeated.
+//
+//	it := c.ListNotes(ctx, client.ListOptions{Tags: []string{"work"}})
+//	for it.Next() {
+//		fmt.Println(it.Note().Title)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+func (c *Client) ListNotes(ctx context.Context, opts ListOptions) *NoteIterator {
+	return &NoteIterator{c: c, ctx: ctx, next: c.url("/v1/notes", opts.values())}
+}
+
+// NoteIterator steps through a listing of notes.
+type NoteIterator struct {
+	c    *Client
+	ctx  context.Context
+	next string // URL of the next page, empty after the last one
+
+	page *NotePage
+	i    int
+	note *Note
+	err  error
+}
+
+// Next advances to the next note, fetching the next page when the current one
+// runs out. It returns false at the end of the listing, or after an error.
+func (it *NoteIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	for it.page == nil || it.i >= len(it.page.Notes) {
+		if it.next == "" {
+			it.note = nil
+			return false
+		}
+
+		page, err := it.c.listNotes(it.ctx, it.next)
+		if err != nil {
+			it.err = err
+			it.note = nil
+			return false
+		}
+
+		it.page, it.i = page, 0
+		it.next = ""
+		if page.Metadata.Next != "" && len(page.Notes) > 0 {
+			// the link is relative to the API, which may not be at the root of
+			// the base URL
+			next, err := url.Parse(page.Metadata.Next)
+			if err != nil {
+				it.err = fmt.Errorf("client: invalid next link: %w", err)
+				return false
+			}
+			it.next = it.c.url(next.Path, next.Query())
+		}
+	}
+
+	it.note = it.page.Notes[it.i]
+	it.i++
+
+	return true
+}
+
+// Note returns the note Next advanced to.
+func (it *NoteIterator) Note() *Note {
+	return it.note
+}
+
+// Page returns the page the current note came from, for its metadata. It is nil
+// until Next has been called.
+func (it *NoteIterator) Page() *NotePage {
+	return it.page
+}
+
+// Err returns the error which stopped the iterator, if any.
+func (it *NoteIterator) Err() error {
+	return it.err
+}
+
+// All collects every remaining note of the listing.
+func (it *NoteIterator) All() ([]*Note, error) {
+	var notes []*Note
+	for it.Next() {
+		notes = append(notes, it.Note())
+	}
+
+	return notes, it.Err()
+}
+
+func notePath(id int64) string {
+	return fmt.Sprintf("/v1/notes/%d", id)
+}